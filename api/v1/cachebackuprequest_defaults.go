@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// SpecDefaults holds the operator-wide values used for omitted CacheBackupRequestSpec fields
+type SpecDefaults struct {
+	// SharedHomePVCName is used as is when set, otherwise it is derived from the instance or StatefulSet name
+	SharedHomePVCName string
+	// Product is applied when neither the request nor its Helm release names one
+	Product        Product
+	SharedHomePath string
+	// LocalHomePath is used as is when set, otherwise it is the local home path of the product's Helm chart
+	LocalHomePath string
+	ConfigMapName string
+	// Interval is applied when neither an interval nor a cron expression is set
+	Interval time.Duration
+	// PodRequests are applied when the pod template sets neither requests nor limits
+	PodRequests corev1.ResourceList
+	// PVCStorageRequest is applied when pvc.create is true and the PVC is not created from a volumeClaimTemplate
+	PVCStorageRequest string
+}
+
+// DefaultSafetySnapshotRetain is the number of safety snapshots kept for each PVC when safetySnapshot.retain is omitted
+const DefaultSafetySnapshotRetain = 3
+
+// ConfluenceDefaults returns defaults matching the Atlassian Helm charts, for Confluence unless a request sets spec.product
+func ConfluenceDefaults() SpecDefaults {
+	return SpecDefaults{
+		Product:        ProductConfluence,
+		SharedHomePath: "/var/atlassian/application-data/shared-home",
+		Interval:       30 * time.Minute,
+		PodRequests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+		PVCStorageRequest: "1Gi",
+	}
+}
+
+// Apply fills the omitted fields of a CacheBackupRequest spec, fields that are set are never changed.
+// The fields a Helm release provides are left to the release when helmReleaseRef is set.
+// Most defaults depend on other fields, e.g. the paths on the product, so they are applied to the
+// spec read by the reconciler and never stored: the defaulting webhook only stores those of ApplyPlain
+func (d SpecDefaults) Apply(r *CacheBackupRequest) {
+	spec := &r.Spec
+	ApplyPlain(spec)
+	if spec.HelmReleaseRef == nil {
+		d.ApplyInstance(spec)
+	}
+	if spec.ConfigMapName == "" {
+		spec.ConfigMapName = d.ConfigMapName
+	}
+	if spec.Schedule.Interval.Duration == 0 && spec.Schedule.Cron == "" {
+		spec.Schedule.Interval.Duration = d.Interval
+	}
+	if len(spec.PodTemplate.Resources.Requests) == 0 && len(spec.PodTemplate.Resources.Limits) == 0 && len(d.PodRequests) > 0 {
+		spec.PodTemplate.Resources.Requests = d.PodRequests.DeepCopy()
+	}
+	if spec.PVC.Create && !spec.PVC.FromVolumeClaimTemplate && spec.PVC.StorageRequest == "" {
+		spec.PVC.StorageRequest = d.PVCStorageRequest
+	}
+}
+
+// ApplyPlain fills the omitted fields whose default depends on no other field, the only defaults
+// the defaulting webhook stores
+func ApplyPlain(spec *CacheBackupRequestSpec) {
+	if spec.SafetySnapshot != nil && spec.SafetySnapshot.Retain == 0 {
+		spec.SafetySnapshot.Retain = DefaultSafetySnapshotRetain
+	}
+}
+
+// ApplyInstance fills the omitted product, shared home PVC, home paths and snapshot layout, the fields describing the instance
+func (d SpecDefaults) ApplyInstance(spec *CacheBackupRequestSpec) {
+	if spec.Product == "" {
+		spec.Product = d.Product
+	}
+	profile := ProfileOf(spec.Product)
+	if spec.SharedHomePVCName == "" {
+		spec.SharedHomePVCName = d.SharedHomePVCName
+		// claim name created by the Atlassian Helm charts, which name the StatefulSet after the release
+		if spec.SharedHomePVCName == "" && spec.Target.InstanceName != "" {
+			spec.SharedHomePVCName = spec.Target.InstanceName + "-shared-home"
+		} else if spec.SharedHomePVCName == "" && spec.StatefulSetRef != nil && spec.StatefulSetRef.Name != "" {
+			spec.SharedHomePVCName = spec.StatefulSetRef.Name + "-shared-home"
+		}
+	}
+	if spec.SharedHomePath == "" {
+		spec.SharedHomePath = d.SharedHomePath
+	}
+	if spec.LocalHomePath == "" {
+		spec.LocalHomePath = d.LocalHomePath
+	}
+	if spec.LocalHomePath == "" {
+		spec.LocalHomePath = profile.LocalHomePath
+	}
+	if spec.IndexSnapshotsPath == "" && spec.SharedHomePath != "" {
+		spec.IndexSnapshotsPath = path.Join(spec.SharedHomePath, profile.SnapshotsPath)
+	}
+	spec.SnapshotLayout.Default(profile.SnapshotLayout)
+}
+
+// Default fills the omitted patterns of a layout from d
+func (l *SnapshotLayout) Default(d SnapshotLayout) {
+	for _, p := range []struct {
+		set   *string
+		value string
+	}{
+		{&l.MainIndex, d.MainIndex},
+		{&l.ChangeIndex, d.ChangeIndex},
+		{&l.EdgeIndex, d.EdgeIndex},
+		{&l.MainIndexJournalID, d.MainIndexJournalID},
+		{&l.ChangeIndexJournalID, d.ChangeIndexJournalID},
+		{&l.EdgeIndexJournalID, d.EdgeIndexJournalID},
+	} {
+		if *p.set == "" {
+			*p.set = p.value
+		}
+	}
+}
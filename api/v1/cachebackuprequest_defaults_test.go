@@ -0,0 +1,179 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestDefaultFillsMinimalSpec(t *testing.T) {
+	r := &CacheBackupRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "local-home-1", Namespace: "default"},
+		Spec: CacheBackupRequestSpec{
+			Target: TargetSpec{InstanceName: "confluence", Ordinal: 1},
+			PVC:    PVCSpec{Create: true},
+		},
+	}
+	defaulter := &CacheBackupRequestDefaulter{}
+	assert.NoError(t, defaulter.Default(context.TODO(), r))
+	// the stored spec only gets the defaults depending on no other field
+	assert.Empty(t, r.Spec.SharedHomePath)
+	assert.Empty(t, r.Spec.Product)
+	assert.Empty(t, r.Spec.IndexSnapshotsPath)
+	assert.Zero(t, r.Spec.Schedule.Interval.Duration)
+	validator := &CacheBackupRequestValidator{Defaults: ConfluenceDefaults()}
+	assert.NoError(t, validator.ValidateCreate(context.TODO(), r))
+
+	ConfluenceDefaults().Apply(r)
+	assert.Equal(t, "confluence-shared-home", r.Spec.SharedHomePVCName)
+	assert.Equal(t, "/var/atlassian/application-data/shared-home", r.Spec.SharedHomePath)
+	assert.Equal(t, ProductConfluence, r.Spec.Product)
+	assert.Equal(t, "/var/atlassian/application-data/confluence", r.Spec.LocalHomePath)
+	assert.Equal(t, "/var/atlassian/application-data/shared-home/index-snapshots", r.Spec.IndexSnapshotsPath)
+	assert.Equal(t, "IndexSnapshot_main_index_*.zip", r.Spec.SnapshotLayout.MainIndex)
+	assert.Equal(t, "IndexSnapshot_edge_index_journal_id", r.Spec.SnapshotLayout.EdgeIndexJournalID)
+	assert.Empty(t, r.Spec.ConfigMapName)
+	assert.Equal(t, 30*time.Minute, r.Spec.Schedule.Interval.Duration)
+	assert.Equal(t, "1Gi", r.Spec.PVC.StorageRequest)
+	assert.Equal(t, resource.MustParse("1"), r.Spec.PodTemplate.Resources.Requests[corev1.ResourceCPU])
+	assert.Empty(t, r.ValidateSpec())
+}
+
+func TestValidatorRejectsInvalidDefaultedSpec(t *testing.T) {
+	r := &CacheBackupRequest{Spec: CacheBackupRequestSpec{
+		Target:             TargetSpec{InstanceName: "confluence"},
+		IndexSnapshotsPath: "/index-snapshots",
+	}}
+	validator := &CacheBackupRequestValidator{Defaults: ConfluenceDefaults()}
+	err := validator.ValidateUpdate(context.TODO(), r.DeepCopy(), r)
+	assert.Regexp(t, "spec.indexSnapshotsPath: Invalid value: \"/index-snapshots\": must be in sharedHomePath", err)
+	// the request itself is left as is
+	assert.Empty(t, r.Spec.SharedHomePath)
+}
+
+func TestDefaultKeepsSetFields(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.PodTemplate.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")}
+	expected := r.Spec.DeepCopy()
+
+	defaults := ConfluenceDefaults()
+	defaults.SharedHomePVCName = "shared-home"
+	defaults.Interval = time.Hour
+	defaults.Apply(r)
+	assert.Equal(t, *expected, r.Spec)
+}
+
+func TestDefaultUsesOperatorOverrides(t *testing.T) {
+	r := &CacheBackupRequest{Spec: CacheBackupRequestSpec{Target: TargetSpec{InstanceName: "confluence"}}}
+	defaults := ConfluenceDefaults()
+	defaults.SharedHomePVCName = "shared-home"
+	defaults.Interval = time.Hour
+	defaults.Apply(r)
+
+	assert.Equal(t, "shared-home", r.Spec.SharedHomePVCName)
+	assert.Equal(t, time.Hour, r.Spec.Schedule.Interval.Duration)
+	// existing PVCs are not resized
+	assert.Empty(t, r.Spec.PVC.StorageRequest)
+}
+
+func TestDefaultDoesNotAddIntervalToCronSchedule(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.Schedule = ScheduleSpec{Cron: "@daily"}
+	ConfluenceDefaults().Apply(r)
+	assert.Zero(t, r.Spec.Schedule.Interval.Duration)
+	assert.Empty(t, r.ValidateSpec())
+}
+
+func TestDefaultLeavesVolumeClaimTemplateStorageRequest(t *testing.T) {
+	r := &CacheBackupRequest{Spec: CacheBackupRequestSpec{
+		Target: TargetSpec{InstanceName: "confluence"},
+		PVC:    PVCSpec{Create: true, FromVolumeClaimTemplate: true},
+	}}
+	ConfluenceDefaults().Apply(r)
+	assert.Empty(t, r.Spec.PVC.StorageRequest)
+	assert.Empty(t, r.ValidateSpec())
+}
+
+func TestDefaultSafetySnapshotRetain(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.SafetySnapshot = &SafetySnapshotSpec{VolumeSnapshotClassName: "csi-snapclass"}
+	ConfluenceDefaults().Apply(r)
+	assert.Equal(t, int32(DefaultSafetySnapshotRetain), r.Spec.SafetySnapshot.Retain)
+
+	r.Spec.SafetySnapshot.Retain = 1
+	ConfluenceDefaults().Apply(r)
+	assert.Equal(t, int32(1), r.Spec.SafetySnapshot.Retain)
+}
+
+func TestDefaultLeavesInstanceFieldsToHelmRelease(t *testing.T) {
+	r := &CacheBackupRequest{Spec: CacheBackupRequestSpec{
+		HelmReleaseRef: &HelmReleaseRef{Name: "wiki"},
+		PVC:            PVCSpec{Create: true},
+	}}
+	ConfluenceDefaults().Apply(r)
+	assert.Empty(t, r.Spec.SharedHomePVCName)
+	assert.Empty(t, r.Spec.SharedHomePath)
+	assert.Empty(t, r.Spec.LocalHomePath)
+	assert.Equal(t, 30*time.Minute, r.Spec.Schedule.Interval.Duration)
+	assert.Equal(t, "1Gi", r.Spec.PVC.StorageRequest)
+	assert.Empty(t, r.ValidateSpec())
+}
+
+func TestDefaultStampsRunNowRequest(t *testing.T) {
+	now := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+	old := newValidRequest()
+	old.Annotations = map[string]string{
+		RunNowAnnotation:            "1",
+		RunNowRequestedByAnnotation: "alice",
+		RunNowRequestedAtAnnotation: "2023-02-01T10:00:00Z",
+	}
+	oldRaw, err := json.Marshal(old)
+	assert.NoError(t, err)
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Update,
+		UserInfo:  authenticationv1.UserInfo{Username: "bob"},
+		OldObject: runtime.RawExtension{Raw: oldRaw},
+	}}
+
+	// the same token keeps who requested it, whatever the client sends
+	r := old.DeepCopy()
+	r.Annotations[RunNowRequestedByAnnotation] = "mallory"
+	assert.NoError(t, stampRunRequest(r, req, now))
+	assert.Equal(t, "alice", r.Annotations[RunNowRequestedByAnnotation])
+	assert.Equal(t, "2023-02-01T10:00:00Z", r.Annotations[RunNowRequestedAtAnnotation])
+
+	// a new token is stamped with the requesting user
+	r.Annotations[RunNowAnnotation] = "2"
+	assert.NoError(t, stampRunRequest(r, req, now))
+	assert.Equal(t, "bob", r.Annotations[RunNowRequestedByAnnotation])
+	assert.Equal(t, "2023-03-01T10:00:00Z", r.Annotations[RunNowRequestedAtAnnotation])
+
+	// removing the token removes the stamp
+	delete(r.Annotations, RunNowAnnotation)
+	assert.NoError(t, stampRunRequest(r, req, now))
+	assert.NotContains(t, r.Annotations, RunNowRequestedByAnnotation)
+	assert.NotContains(t, r.Annotations, RunNowRequestedAtAnnotation)
+}
+
+func TestDefaultStampsRunNowRequestOnCreate(t *testing.T) {
+	r := newValidRequest()
+	r.Annotations = map[string]string{RunNowAnnotation: "1"}
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		UserInfo:  authenticationv1.UserInfo{Username: "bob"},
+	}}
+	defaulter := &CacheBackupRequestDefaulter{}
+	assert.NoError(t, defaulter.Default(admission.NewContextWithRequest(context.TODO(), req), r))
+	assert.Equal(t, "bob", r.Annotations[RunNowRequestedByAnnotation])
+	assert.Contains(t, r.Annotations, RunNowRequestedAtAnnotation)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// Profile holds what differs between the products the operator pre-warms
+type Profile struct {
+	// LocalHomePath is the local home mount path of the Atlassian Helm chart of the product
+	LocalHomePath string
+	// IndexPath is the local index directory, relative to the local home
+	IndexPath string
+	// SnapshotsPath is the directory the product writes index snapshots to, relative to the shared home
+	SnapshotsPath string
+	// SnapshotLayout names the index snapshot files the product writes
+	SnapshotLayout SnapshotLayout
+	// UID is the UID and GID of the product user in the Atlassian images
+	UID int64
+	// ScriptImage runs the index restore script of spec.configMapName when the request sets no image
+	ScriptImage string
+}
+
+var profiles = map[Product]Profile{
+	ProductConfluence: {
+		LocalHomePath: "/var/atlassian/application-data/confluence",
+		IndexPath:     "index",
+		SnapshotsPath: "index-snapshots",
+		SnapshotLayout: SnapshotLayout{
+			MainIndex:            "IndexSnapshot_main_index_*.zip",
+			ChangeIndex:          "IndexSnapshot_change_index_*.zip",
+			EdgeIndex:            "IndexSnapshot_edge_index_*.zip",
+			MainIndexJournalID:   "IndexSnapshot_main_index_journal_id",
+			ChangeIndexJournalID: "IndexSnapshot_change_index_journal_id",
+			EdgeIndexJournalID:   "IndexSnapshot_edge_index_journal_id",
+		},
+		UID:         2002,
+		ScriptImage: "atlassian/confluence:8.0.3",
+	},
+	// Jira snapshots its whole index to a single archive, it must be written as a zip file
+	ProductJira: {
+		LocalHomePath: "/var/atlassian/application-data/jira",
+		IndexPath:     "caches/indexesV1",
+		SnapshotsPath: "export/indexsnapshots",
+		SnapshotLayout: SnapshotLayout{
+			MainIndex: "IndexSnapshot_*.zip",
+		},
+		UID:         2001,
+		ScriptImage: "atlassian/jira-software:9.4.3",
+	},
+}
+
+// Known returns true if the operator has a profile for the product
+func (p Product) Known() bool {
+	_, ok := profiles[p]
+	return ok
+}
+
+// ProfileOf returns the profile of a product, Confluence's when the product is omitted or unknown
+func ProfileOf(product Product) Profile {
+	if profile, ok := profiles[product]; ok {
+		return profile
+	}
+	return profiles[ProductConfluence]
+}
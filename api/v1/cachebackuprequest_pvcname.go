@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// PVCNameTemplateData is what spec.pvcNameTemplate is executed with
+type PVCNameTemplateData struct {
+	// InstanceName is target.instanceName, or the statefulSetRef name
+	InstanceName string
+	// Ordinal of the pod in the StatefulSet
+	Ordinal int32
+	// Namespace of the request
+	Namespace string
+}
+
+// PVCName executes spec.pvcNameTemplate for an ordinal and returns the name of its local home PVC
+func (r *CacheBackupRequest) PVCName(ordinal int32) (string, error) {
+	tmpl, err := template.New("pvcNameTemplate").Option("missingkey=error").Parse(r.Spec.PVCNameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	data := PVCNameTemplateData{
+		InstanceName: r.Spec.Target.InstanceName,
+		Ordinal:      ordinal,
+		Namespace:    r.Namespace,
+	}
+	if r.Spec.StatefulSetRef != nil {
+		data.InstanceName = r.Spec.StatefulSetRef.Name
+	}
+	var name strings.Builder
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+	if errs := validation.IsDNS1123Subdomain(name.String()); len(errs) > 0 {
+		return "", fmt.Errorf("%q is not a valid PVC name: %s", name.String(), strings.Join(errs, ", "))
+	}
+	return name.String(), nil
+}
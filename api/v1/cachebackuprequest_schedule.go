@@ -0,0 +1,69 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"time"
+
+	"bianchi2/dc-cache-backup-operator/internal/schedule"
+)
+
+// RunSchedule returns the schedule pre-warming runs start on
+func (s *CacheBackupRequestSpec) RunSchedule() (*schedule.Schedule, error) {
+	sched := &schedule.Schedule{
+		Interval: s.Schedule.Interval.Duration,
+		Location: time.UTC,
+	}
+	var err error
+	if s.Schedule.Cron != "" {
+		if sched.Cron, err = schedule.ParseCron(s.Schedule.Cron); err != nil {
+			return nil, err
+		}
+	}
+	if s.Schedule.TimeZone != "" {
+		if sched.Location, err = time.LoadLocation(s.Schedule.TimeZone); err != nil {
+			return nil, err
+		}
+	}
+	if sched.Maintenance, err = parseWindows(s.MaintenanceWindows); err != nil {
+		return nil, err
+	}
+	if sched.Blackout, err = parseWindows(s.BlackoutWindows); err != nil {
+		return nil, err
+	}
+	return sched, nil
+}
+
+func parseWindows(windows []TimeWindow) ([]schedule.Window, error) {
+	var parsed []schedule.Window
+	for _, w := range windows {
+		window, err := schedule.ParseWindow(daysOfWeek(w.Days), w.Start, w.End)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, window)
+	}
+	return parsed, nil
+}
+
+func daysOfWeek(days []DayOfWeek) []string {
+	var names []string
+	for _, day := range days {
+		names = append(names, string(day))
+	}
+	return names
+}
@@ -0,0 +1,620 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CacheBackupRequestSpec defines the desired state of CacheBackupRequest
+type CacheBackupRequestSpec struct {
+	// Product selects how index snapshots are found, restored and compared with the local index.
+	// Jira Service Management is pre-warmed as jira. Defaults to the operator default product, confluence
+	// +optional
+	Product Product `json:"product,omitempty"`
+	// Target identifies the StatefulSet pod whose local home is pre-warmed
+	Target TargetSpec `json:"target,omitempty"`
+	// HelmReleaseRef fills the omitted fields of the request from the values of an Atlassian Helm chart release
+	// in the request namespace: statefulSetRef, the home paths, the shared home PVC and the pre-warmer image.
+	// Releases are stored in Secrets, which the operator may only list in namespaces granted the Role of
+	// config/rbac/helm_release_reader_role.yaml
+	// +optional
+	HelmReleaseRef *HelmReleaseRef `json:"helmReleaseRef,omitempty"`
+	// StatefulSetRef pre-warms the local home of every ordinal of a StatefulSet in the request
+	// namespace instead of target.ordinal. PVCs are named after the volumeClaimTemplate mounted at localHomePath
+	// +optional
+	StatefulSetRef *StatefulSetRef `json:"statefulSetRef,omitempty"`
+	// PVCNameTemplate is a Go template for the local home PVC name of an ordinal, e.g. "data-{{ .InstanceName }}-{{ .Ordinal }}".
+	// .InstanceName is target.instanceName or the statefulSetRef name, .Ordinal the pod ordinal and .Namespace the request namespace.
+	// When omitted the name is derived from the StatefulSet volumeClaimTemplate mounted at localHomePath,
+	// and falls back to local-home-<instanceName>-<ordinal> when target.instanceName is not the name of a StatefulSet
+	// +optional
+	PVCNameTemplate string `json:"pvcNameTemplate,omitempty"`
+	// Schedule defines when the pre-warming job runs
+	Schedule ScheduleSpec `json:"schedule,omitempty"`
+	// MaintenanceWindows, if any, are the only times a pre-warming run may start
+	// +optional
+	MaintenanceWindows []TimeWindow `json:"maintenanceWindows,omitempty"`
+	// BlackoutWindows are times a pre-warming run never starts, e.g. business peak hours.
+	// They take precedence over maintenance windows. A run started before a blackout window is not interrupted.
+	// +optional
+	BlackoutWindows []TimeWindow `json:"blackoutWindows,omitempty"`
+
+	// SharedHomePVCName is the name of a shared home PVC that will be mounted
+	SharedHomePVCName string `json:"sharedHomePVCName,omitempty"`
+	// SharedHomePath is the shared-home mount path
+	SharedHomePath string `json:"sharedHomePath,omitempty"`
+	// LocalHomePath is the local-home mount path
+	LocalHomePath string `json:"localHomePath,omitempty"`
+	// IndexSnapshotsPath is the path to index snapshots in shared home, sharedHomePath/index-snapshots by default
+	IndexSnapshotsPath string `json:"indexSnapshotsPath,omitempty"`
+	// SnapshotLayout names the files of the index snapshots in indexSnapshotsPath
+	// +optional
+	SnapshotLayout SnapshotLayout `json:"snapshotLayout,omitempty"`
+	// RequireManifest fails runs restoring a snapshot without a manifest, written by the manifest subcommand
+	// of the operator. Snapshots with a manifest are always verified, before and after they are extracted.
+	// Restore scripts of configMapName do not verify snapshots
+	// +optional
+	RequireManifest bool `json:"requireManifest,omitempty"`
+	// VerifyIndex checks the restored Lucene indexes: every file referenced by their segments_N file exists with the
+	// expected size. The previous index is kept if the check fails. Restore scripts of configMapName are not checked
+	// +optional
+	VerifyIndex bool `json:"verifyIndex,omitempty"`
+	// KeepPreviousIndexes is the number of generations of the index and journal ids replaced by restores that are kept
+	// in the local home, as index.prev, index.prev.2 and so on, for rollbackTo. Restores extract snapshots to
+	// index.staging and only replace the index once it is verified, whether or not previous indexes are kept
+	// +optional
+	KeepPreviousIndexes int32 `json:"keepPreviousIndexes,omitempty"`
+	// RollbackTo requests a run putting back a kept index instead of restoring the snapshot in shared home. The snapshot
+	// of the index it replaces is not restored again, restores resume with the next snapshot
+	// +optional
+	RollbackTo *RollbackRequest `json:"rollbackTo,omitempty"`
+	// Verification requires snapshot manifests signed with a trusted key
+	// +optional
+	Verification *VerificationSpec `json:"verification,omitempty"`
+	// SafetySnapshot takes a CSI VolumeSnapshot of the local home PVC before a pre-warmer pod overwrites it.
+	// The pod is only created once the snapshot is ready to use
+	// +optional
+	SafetySnapshot *SafetySnapshotSpec `json:"safetySnapshot,omitempty"`
+	// RestoreSafetySnapshot recreates the local home PVC of an ordinal from one of its safety snapshots, once the PVC
+	// is no longer used. Pre-warming is held until the PVC is recreated, which is done even if the request is suspended:
+	// suspend it to keep the next run from restoring the snapshot in shared home over the recreated PVC
+	// +optional
+	RestoreSafetySnapshot *SafetySnapshotRestoreRequest `json:"restoreSafetySnapshot,omitempty"`
+	// ConfigMap with a copy-index.sh script that copies/unpacks indexes instead of the restore built into the
+	// operator. The script runs in the product image unless podTemplate.image is set
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// Suspend stops new pre-warmer pods from being created, the status and the local home PVC are kept.
+	// A pod that is already running is not deleted, its status is still recorded and it is deleted once it succeeds
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// InheritFromStatefulSet takes the security contexts, image pull secrets, node selector, tolerations and node
+	// affinity of the pre-warmer pod from the first container of the StatefulSet pod template, the StatefulSet being
+	// statefulSetRef or the one named after target.instanceName, and its image and pull policy when configMapName is
+	// set. The SHARED_HOME and LOCAL_HOME container env override sharedHomePath and localHomePath, the StatefulSet
+	// shared home volume is mounted and the sub paths of both home mounts are kept. The users, groups and seccomp
+	// profile of the security contexts are set over the restricted defaults, which are never loosened. SELinux options
+	// are not inherited. Fields set in podTemplate take precedence
+	// +optional
+	InheritFromStatefulSet bool `json:"inheritFromStatefulSet,omitempty"`
+
+	// PodTemplate customizes the pre-warmer pod. It is laid out like a pod template but only has some of its fields:
+	// labels and annotations of the metadata, image, resources, nodeSelector, tolerations, affinity and
+	// topologySpreadConstraints. Any other pod spec field, e.g. serviceAccountName, imagePullSecrets,
+	// priorityClassName, securityContext, initContainers, volumes or sidecar containers, is set in podTemplate.spec
+	PodTemplate PreWarmerPodTemplate `json:"podTemplate,omitempty"`
+	// PVC defines the local home PVC created when it is missing
+	PVC PVCSpec `json:"pvc,omitempty"`
+}
+
+// TargetSpec identifies the StatefulSet pod whose local home is pre-warmed
+type TargetSpec struct {
+	// Name of the Helm release, e.g. confluence, jira
+	InstanceName string `json:"instanceName,omitempty"`
+	// Ordinal of the pod in the StatefulSet
+	Ordinal int32 `json:"ordinal,omitempty"`
+}
+
+// SnapshotLayout holds the glob patterns, relative to indexSnapshotsPath, of the index snapshot files.
+// The omitted patterns are those of the product. Jira has a single index, it only uses mainIndex
+type SnapshotLayout struct {
+	// MainIndex matches the archives of the main index. The snapshot id is the part of the newest archive
+	// name matched by the pattern's wildcard
+	// +optional
+	MainIndex string `json:"mainIndex,omitempty"`
+	// ChangeIndex matches the archives of the change index
+	// +optional
+	ChangeIndex string `json:"changeIndex,omitempty"`
+	// EdgeIndex matches the archives of the edge index
+	// +optional
+	EdgeIndex string `json:"edgeIndex,omitempty"`
+	// MainIndexJournalID matches the file holding the journal id of the main index snapshot
+	// +optional
+	MainIndexJournalID string `json:"mainIndexJournalId,omitempty"`
+	// ChangeIndexJournalID matches the file holding the journal id of the change index snapshot
+	// +optional
+	ChangeIndexJournalID string `json:"changeIndexJournalId,omitempty"`
+	// EdgeIndexJournalID matches the file holding the journal id of the edge index snapshot
+	// +optional
+	EdgeIndexJournalID string `json:"edgeIndexJournalId,omitempty"`
+}
+
+// VerificationSpec selects the key snapshot manifests must be signed with
+type VerificationSpec struct {
+	// PublicKeySecretRef selects the PEM-encoded ed25519 public key, in a Secret of the request namespace.
+	// Snapshots without a manifest signed with the matching private key are not restored
+	PublicKeySecretRef *corev1.SecretKeySelector `json:"publicKeySecretRef,omitempty"`
+}
+
+// RollbackRequest puts back an index kept by a previous restore
+type RollbackRequest struct {
+	// Generation of the kept index, 1 is the index replaced by the last restore
+	Generation int32 `json:"generation"`
+	// Token identifies the request, the rollback runs once for each token. Set it to a new value, e.g. the
+	// current time, to roll back again
+	Token string `json:"token"`
+}
+
+// SafetySnapshotSpec selects how local home PVCs are snapshotted before they are pre-warmed
+type SafetySnapshotSpec struct {
+	// VolumeSnapshotClassName of the snapshots, its driver must be the CSI driver of the local home PVCs
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName"`
+	// Retain is the number of ready safety snapshots kept for each PVC, older ones are deleted. Defaults to 3 when
+	// omitted or 0
+	// +optional
+	Retain int32 `json:"retain,omitempty"`
+}
+
+// SafetySnapshotRestoreRequest recreates a local home PVC from a safety snapshot
+type SafetySnapshotRestoreRequest struct {
+	// VolumeSnapshotName is the name of a safety snapshot in the request namespace, such as
+	// status.ordinals[].safetySnapshot.name. The PVC it was taken of is recreated
+	VolumeSnapshotName string `json:"volumeSnapshotName"`
+	// Token identifies the request, the PVC is recreated once for each token. Set it to a new value, e.g. the
+	// current time, to restore again
+	Token string `json:"token"`
+}
+
+// HelmReleaseRef references a Helm v3 release
+type HelmReleaseRef struct {
+	// Name of the release
+	Name string `json:"name"`
+}
+
+// StatefulSetRef selects the ordinals of a StatefulSet to pre-warm
+type StatefulSetRef struct {
+	// Name of the StatefulSet, required unless set by a ClusterCacheBackupPolicy
+	// +optional
+	Name string `json:"name,omitempty"`
+	// IncludeOrdinals are the ordinals to pre-warm instead of those below the StatefulSet replicas,
+	// e.g. to pre-warm ordinals ahead of a scale up
+	// +optional
+	IncludeOrdinals []int32 `json:"includeOrdinals,omitempty"`
+	// ExcludeOrdinals are never pre-warmed
+	// +optional
+	ExcludeOrdinals []int32 `json:"excludeOrdinals,omitempty"`
+}
+
+// ScheduleSpec defines when the pre-warming job runs. A request that has never
+// succeeded runs as soon as the maintenance and blackout windows allow it.
+type ScheduleSpec struct {
+	// Interval between two pre-warming runs, e.g. 30m. Must not be set together with cron
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Cron is a five field cron expression, e.g. "0 2 * * *", one of @hourly, @daily, @weekly, @monthly, @yearly
+	// or "@every <duration>", e.g. "@every 6h"
+	// +optional
+	Cron string `json:"cron,omitempty"`
+	// TimeZone is the IANA name of the time zone cron and the windows are evaluated in, e.g. Europe/Amsterdam. Defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// DayOfWeek is an abbreviated day of the week
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type DayOfWeek string
+
+// TimeWindow is a time of day range repeated on some days of the week, e.g. Mon-Fri 08:00-18:00
+type TimeWindow struct {
+	// Days the window opens on, every day when empty
+	// +optional
+	Days []DayOfWeek `json:"days,omitempty"`
+	// Start is the time of day the window opens, HH:MM
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// End is the time of day the window closes, HH:MM. A window that ends before it starts closes the next day,
+	// one that ends when it starts lasts the whole day
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end"`
+}
+
+// PreWarmerPodTemplate customizes the pre-warmer pod, laid out like a PodTemplateSpec: labels and annotations
+// are the pod metadata and spec is merged over the generated pod spec. It is not a corev1.PodTemplateSpec because
+// its schema requires spec.containers, each with a name and an image, where an override only sets the fields it
+// changes. The other fields keep the v1beta1 pod settings typed and validated
+type PreWarmerPodTemplate struct {
+	// Image of the pre-warmer container. Defaults to the operator image, which runs the built-in restore, or
+	// to the product image (e.g. atlassian/confluence:8.0.3) when configMapName runs the restore script instead
+	// +optional
+	Image                     string                            `json:"image,omitempty"`
+	Labels                    map[string]string                 `json:"labels,omitempty"`
+	Annotations               map[string]string                 `json:"annotations,omitempty"`
+	Resources                 corev1.ResourceRequirements       `json:"resources,omitempty"`
+	NodeSelector              map[string]string                 `json:"nodeSelector,omitempty"`
+	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *corev1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// Spec is strategically merged over the generated pod spec after the fields above, like kubectl patch does:
+	// containers, init containers, volumes and env are merged by name, so the pre-warmer container is
+	// named pre-warmer. Use it for serviceAccountName, imagePullSecrets, priorityClassName, sidecars and the like
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec *corev1.PodSpec `json:"spec,omitempty"`
+}
+
+// PVCSpec defines the local home PVC created when it is missing
+type PVCSpec struct {
+	// Create a new PVC if missing
+	Create bool `json:"create,omitempty"`
+	// FromVolumeClaimTemplate creates the PVC from the spec, labels and annotations of the StatefulSet
+	// volumeClaimTemplate mounted at localHomePath, as the StatefulSet controller would.
+	// The other fields, when set, override the template
+	// +optional
+	FromVolumeClaimTemplate bool `json:"fromVolumeClaimTemplate,omitempty"`
+	// AccessModes of the PVC, ReadWriteOnce unless set here or in the volumeClaimTemplate
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+	Labels      map[string]string                   `json:"labels,omitempty"`
+	Annotations map[string]string                   `json:"annotations,omitempty"`
+	// Local home PVC storage request, e.g. 200Gi
+	StorageRequest string `json:"storageRequest,omitempty"`
+	// Local home PVC storage class
+	StorageClassName string                       `json:"storageClassName,omitempty"`
+	VolumeName       string                       `json:"volumeName,omitempty"`
+	VolumeMode       *corev1.PersistentVolumeMode `json:"volumeMode,omitempty"`
+	Selector         *metav1.LabelSelector        `json:"selector,omitempty"`
+}
+
+const (
+	// RunNowAnnotation requests a pre-warming run regardless of the schedule and the maintenance and blackout
+	// windows, but not while the request is suspended. Setting it to a new token, e.g. the current time, requests another run
+	RunNowAnnotation = "cache.atlassian.com/run-now"
+	// RunNowRequestedByAnnotation is set by the defaulting webhook to the user that set the run-now token
+	RunNowRequestedByAnnotation = "cache.atlassian.com/run-now-requested-by"
+	// RunNowRequestedAtAnnotation is set by the defaulting webhook to when the run-now token was set, in RFC 3339
+	RunNowRequestedAtAnnotation = "cache.atlassian.com/run-now-requested-at"
+)
+
+// Product is an Atlassian Data Center product whose local home index is pre-warmed
+// +kubebuilder:validation:Enum=confluence;jira
+type Product string
+
+const (
+	// ProductConfluence restores the main, change and edge indexes and compares their journal ids
+	ProductConfluence Product = "confluence"
+	// ProductJira restores the Jira index snapshot and compares it with the snapshot last restored
+	ProductJira Product = "jira"
+)
+
+// CacheBackupRequestPhase is a high-level summary of where a CacheBackupRequest is in its lifecycle
+// +kubebuilder:validation:Enum=Pending;Waiting;Running;Succeeded;Restored;PartiallyRestored;RolledBack;Skipped;Failed
+type CacheBackupRequestPhase string
+
+const (
+	// PhasePending means the pre-warmer pod has been created but has not started yet
+	PhasePending CacheBackupRequestPhase = "Pending"
+	// PhaseWaiting means the local home PVC is missing or used by another pod
+	PhaseWaiting CacheBackupRequestPhase = "Waiting"
+	// PhaseRunning means the pre-warmer pod is restoring the index
+	PhaseRunning CacheBackupRequestPhase = "Running"
+	// PhaseSucceeded means the pre-warmer pod has succeeded without reporting a result, e.g. a restore script
+	PhaseSucceeded CacheBackupRequestPhase = "Succeeded"
+	// PhaseRestored means the index has been restored from shared home
+	PhaseRestored CacheBackupRequestPhase = "Restored"
+	// PhasePartiallyRestored means the main index has been restored but the snapshot of another index was missing
+	PhasePartiallyRestored CacheBackupRequestPhase = "PartiallyRestored"
+	// PhaseRolledBack means a kept index has been put back for spec.rollbackTo
+	PhaseRolledBack CacheBackupRequestPhase = "RolledBack"
+	// PhaseSkipped means the local home index was more recent than the snapshot in shared home
+	PhaseSkipped CacheBackupRequestPhase = "Skipped"
+	// PhaseFailed means the pre-warmer pod has failed
+	PhaseFailed CacheBackupRequestPhase = "Failed"
+)
+
+// Condition types reported in CacheBackupRequestStatus.Conditions
+const (
+	// ConditionReady is True when the last pre-warming run has completed successfully
+	ConditionReady = "Ready"
+	// ConditionPVCAvailable is True when the local home PVC exists and is not used by another pod
+	ConditionPVCAvailable = "PVCAvailable"
+	// ConditionRestoring is True while the pre-warmer pod is pending or running
+	ConditionRestoring = "Restoring"
+	// ConditionDegraded is True when pre-warming cannot make progress without intervention
+	ConditionDegraded = "Degraded"
+	// ConditionSuspended is True when pre-warming is suspended by .spec.suspend or the operator emergency stop
+	ConditionSuspended = "Suspended"
+	// ConditionSnapshotVerified is True when the last snapshot restored was signed with the key of .spec.verification
+	ConditionSnapshotVerified = "SnapshotVerified"
+	// ConditionIndexVerified is True when the last index restored passed the check of .spec.verifyIndex
+	ConditionIndexVerified = "IndexVerified"
+	// ConditionSafetySnapshotReady is True when the local home PVC was snapshotted for .spec.safetySnapshot before the last run
+	ConditionSafetySnapshotReady = "SafetySnapshotReady"
+)
+
+// Condition reasons
+const (
+	ReasonPVCFound              = "PVCFound"
+	ReasonPVCNotFound           = "PVCNotFound"
+	ReasonPVCInUse              = "PVCInUse"
+	ReasonPodPending            = "PodPending"
+	ReasonPodRunning            = "PodRunning"
+	ReasonRestoreSucceeded      = "RestoreSucceeded"
+	ReasonRestoreSkipped        = "RestoreSkipped"
+	ReasonRestorePartial        = "RestorePartial"
+	ReasonRolledBack            = "RolledBack"
+	ReasonSignatureValid        = "SignatureValid"
+	ReasonSignatureInvalid      = "SignatureInvalid"
+	ReasonIndexIntact           = "IndexIntact"
+	ReasonIndexCorrupt          = "IndexCorrupt"
+	ReasonSafetySnapshotPending = "SafetySnapshotPending"
+	ReasonSafetySnapshotReady   = "SafetySnapshotReady"
+	ReasonSafetySnapshotFailed  = "SafetySnapshotFailed"
+	ReasonPodFailed             = "PodFailed"
+	ReasonInvalidSpec           = "InvalidSpec"
+	ReasonAsExpected            = "AsExpected"
+	ReasonSuspended             = "Suspended"
+	ReasonEmergencyStop         = "EmergencyStop"
+
+	ReasonHelmReleaseNotFound         = "HelmReleaseNotFound"
+	ReasonHelmReleaseForbidden        = "HelmReleaseForbidden"
+	ReasonStatefulSetNotFound         = "StatefulSetNotFound"
+	ReasonVolumeClaimTemplateNotFound = "VolumeClaimTemplateNotFound"
+	ReasonSafetySnapshotNotFound      = "SafetySnapshotNotFound"
+)
+
+// CacheBackupRequestStatus defines the observed state of CacheBackupRequest
+type CacheBackupRequestStatus struct {
+	// ObservedGeneration is the .metadata.generation the status was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase of the last pre-warming run, the most pressing one when several ordinals are pre-warmed
+	Phase CacheBackupRequestPhase `json:"phase,omitempty"`
+	// Name of the PVC, when a single ordinal is pre-warmed
+	PVCName string `json:"pvcName,omitempty"`
+	// Conditions describe the current state of the request
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// LastSuccessfulTime is when the index of any ordinal was last restored or found to be up to date
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// NextScheduledTime is when the next pre-warming run of any ordinal is due
+	NextScheduledTime *metav1.Time `json:"nextScheduledTime,omitempty"`
+
+	IndexRestoreDurationSeconds int `json:"indexRestoreDurationSeconds,omitempty"`
+
+	// Ordinals reports the pre-warming of each ordinal
+	// +listType=map
+	// +listMapKey=ordinal
+	Ordinals []OrdinalStatus `json:"ordinals,omitempty"`
+
+	// LastRunRequest acknowledges the last on-demand run started for the run-now annotation
+	LastRunRequest *RunRequest `json:"lastRunRequest,omitempty"`
+
+	// LastRollback acknowledges the last rollback started for spec.rollbackTo
+	LastRollback *RollbackStatus `json:"lastRollback,omitempty"`
+
+	// LastSafetySnapshotRestore reports the last PVC recreated for spec.restoreSafetySnapshot
+	LastSafetySnapshotRestore *SafetySnapshotRestoreStatus `json:"lastSafetySnapshotRestore,omitempty"`
+
+	// HelmRelease reports the values inherited from the release referenced by helmReleaseRef
+	HelmRelease *HelmReleaseStatus `json:"helmRelease,omitempty"`
+}
+
+// HelmReleaseStatus reports the values a request inherited from a Helm release
+type HelmReleaseStatus struct {
+	// Name of the release
+	Name string `json:"name"`
+	// Revision of the release the values were read from
+	Revision int `json:"revision"`
+	// Chart name and version of the release
+	Chart string `json:"chart,omitempty"`
+	// Inherited are the spec fields filled from the release values, e.g. spec.localHomePath
+	Inherited []string `json:"inherited,omitempty"`
+}
+
+// OrdinalStatus is the observed state of the pre-warming of one StatefulSet ordinal
+type OrdinalStatus struct {
+	// Ordinal of the pod in the StatefulSet
+	Ordinal int32 `json:"ordinal"`
+	// Name of the local home PVC
+	PVCName string `json:"pvcName,omitempty"`
+	// Phase of the last pre-warming run
+	Phase CacheBackupRequestPhase `json:"phase,omitempty"`
+	// Conditions describe the current state of the ordinal, the request conditions summarize them
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastSuccessfulTime is when the index was last restored or found to be up to date
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// NextScheduledTime is when the next pre-warming run is due
+	NextScheduledTime *metav1.Time `json:"nextScheduledTime,omitempty"`
+
+	IndexRestoreDurationSeconds int `json:"indexRestoreDurationSeconds,omitempty"`
+
+	// LastRestore is the result reported by the pre-warmer pod of the last run
+	LastRestore *RestoreResult `json:"lastRestore,omitempty"`
+
+	// SafetySnapshot is the VolumeSnapshot of the local home PVC taken before the current or last run
+	SafetySnapshot *SafetySnapshotStatus `json:"safetySnapshot,omitempty"`
+}
+
+// SafetySnapshotStatus is a VolumeSnapshot of a local home PVC taken for spec.safetySnapshot
+type SafetySnapshotStatus struct {
+	// Name of the VolumeSnapshot
+	Name string `json:"name"`
+	// CreationTime is when the snapshot was requested
+	CreationTime metav1.Time `json:"creationTime"`
+	// ReadyToUse is true once the snapshot can be restored, the pre-warmer pod is created then
+	ReadyToUse bool `json:"readyToUse,omitempty"`
+}
+
+// SafetySnapshotRestoreStatus is a PVC recreated for spec.restoreSafetySnapshot
+type SafetySnapshotRestoreStatus struct {
+	// VolumeSnapshotName is the safety snapshot restored
+	VolumeSnapshotName string `json:"volumeSnapshotName"`
+	// Token of the restore request
+	Token string `json:"token"`
+	// PVCName is the name of the PVC recreated
+	PVCName string `json:"pvcName"`
+	// StartedAt is when the PVC was deleted to be recreated
+	StartedAt metav1.Time `json:"startedAt"`
+	// CompletedAt is when the PVC was recreated from the snapshot
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+}
+
+// RestoreOutcome is how a restore ended
+// +kubebuilder:validation:Enum=Restored;PartiallyRestored;RolledBack;Skipped;Failed
+type RestoreOutcome string
+
+const (
+	RestoreOutcomeRestored          RestoreOutcome = "Restored"
+	RestoreOutcomePartiallyRestored RestoreOutcome = "PartiallyRestored"
+	RestoreOutcomeRolledBack        RestoreOutcome = "RolledBack"
+	RestoreOutcomeSkipped           RestoreOutcome = "Skipped"
+	RestoreOutcomeFailed            RestoreOutcome = "Failed"
+)
+
+// RestoreResult is the result the pre-warmer container writes as JSON to its termination message
+type RestoreResult struct {
+	// Outcome of the restore
+	Outcome RestoreOutcome `json:"outcome"`
+	// SnapshotID identifies the main index snapshot in shared home, from its file name
+	SnapshotID string `json:"snapshotId,omitempty"`
+	// BytesRestored is the size of the files extracted from the snapshots
+	BytesRestored int64 `json:"bytesRestored,omitempty"`
+	// FilesRestored is the number of files extracted from the snapshots
+	FilesRestored int64 `json:"filesRestored,omitempty"`
+	// Indexes reports the journal ids and the restore of each index
+	Indexes []IndexRestoreResult `json:"indexes,omitempty"`
+	// Signature reports the verification of the snapshot manifest signature, when the request requires one
+	Signature *SignatureResult `json:"signature,omitempty"`
+	// IndexVerification reports the check of the restored Lucene indexes, when the request requires one
+	IndexVerification *IndexVerificationResult `json:"indexVerification,omitempty"`
+	// Reason explains the outcome
+	Reason string `json:"reason,omitempty"`
+}
+
+// SignatureResult is the verification of a snapshot manifest signature
+type SignatureResult struct {
+	// Valid is true if the manifest was signed with the private key of the public key
+	Valid bool `json:"valid"`
+	// Signer is the signer recorded in the signed manifest
+	Signer string `json:"signer,omitempty"`
+	// KeyFingerprint is the SHA-256 fingerprint of the public key
+	KeyFingerprint string `json:"keyFingerprint"`
+}
+
+// IndexVerificationResult is the check of the Lucene indexes restored to the local home
+type IndexVerificationResult struct {
+	// Valid is true if every file referenced by the latest commit of each index exists with the expected size
+	Valid bool `json:"valid"`
+	// Indexes is the number of Lucene indexes checked
+	Indexes int32 `json:"indexes,omitempty"`
+	// Segments is the number of segments of the indexes
+	Segments int32 `json:"segments,omitempty"`
+	// Files is the number of files referenced by the indexes
+	Files int32 `json:"files,omitempty"`
+	// RolledBack is true if the index failed the check and the previous index was kept
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// IndexRestoreResult is the restore of one index
+type IndexRestoreResult struct {
+	// Name of the index, e.g. main_index
+	Name string `json:"name"`
+	// SnapshotJournalID is the journal id of the index snapshot in shared home
+	SnapshotJournalID int64 `json:"snapshotJournalId,omitempty"`
+	// LocalJournalID is the journal id of the local home index before the restore
+	LocalJournalID int64 `json:"localJournalId,omitempty"`
+	BytesRestored  int64 `json:"bytesRestored,omitempty"`
+	FilesRestored  int64 `json:"filesRestored,omitempty"`
+	// Duration of the extraction
+	Duration metav1.Duration `json:"duration"`
+}
+
+// RunRequest is an on-demand pre-warming run requested with the run-now annotation
+type RunRequest struct {
+	// Token is the value of the run-now annotation
+	Token string `json:"token"`
+	// RequestedBy is the user that set the annotation
+	RequestedBy string `json:"requestedBy,omitempty"`
+	// RequestedAt is when the annotation was set
+	RequestedAt *metav1.Time `json:"requestedAt,omitempty"`
+	// StartedAt is when the pre-warmer pod for the request was created
+	StartedAt metav1.Time `json:"startedAt"`
+}
+
+// RollbackStatus is a rollback started for spec.rollbackTo
+type RollbackStatus struct {
+	// Generation of the kept index put back
+	Generation int32 `json:"generation"`
+	// Token of the rollback request
+	Token string `json:"token"`
+	// StartedAt is when the pre-warmer pod for the rollback was created
+	StartedAt metav1.Time `json:"startedAt"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:resource:shortName=cbr
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="PVC",type=string,JSONPath=`.status.pvcName`
+//+kubebuilder:printcolumn:name="Suspended",type=string,JSONPath=`.status.conditions[?(@.type=="Suspended")].status`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessfulTime`
+//+kubebuilder:printcolumn:name="Next Run",type=date,JSONPath=`.status.nextScheduledTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CacheBackupRequest is the Schema for the cachebackuprequests API
+type CacheBackupRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CacheBackupRequestSpec   `json:"spec,omitempty"`
+	Status CacheBackupRequestStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CacheBackupRequestList contains a list of CacheBackupRequest
+type CacheBackupRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CacheBackupRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CacheBackupRequest{}, &CacheBackupRequestList{})
+}
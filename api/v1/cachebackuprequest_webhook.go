@@ -0,0 +1,420 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"bianchi2/dc-cache-backup-operator/internal/schedule"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var cachebackuprequestlog = logf.Log.WithName("cachebackuprequest-resource")
+
+// SetupWebhookWithManager registers the CacheBackupRequest webhooks, including the
+// /convert endpoint serving conversion between v1 and v1beta1
+func (r *CacheBackupRequest) SetupWebhookWithManager(mgr ctrl.Manager, defaults SpecDefaults) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithDefaulter(&CacheBackupRequestDefaulter{}).
+		WithValidator(&CacheBackupRequestValidator{Defaults: defaults}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-cache-atlassian-com-v1-cachebackuprequest,mutating=true,failurePolicy=fail,sideEffects=None,groups=cache.atlassian.com,resources=cachebackuprequests,verbs=create;update,versions=v1,name=mcachebackuprequest.kb.io,admissionReviewVersions=v1
+
+// CacheBackupRequestDefaulter fills the omitted spec fields whose default depends on no other field.
+// The operator-wide defaults are applied by the reconciler instead, for the object to follow changes
+// of the fields they depend on, e.g. spec.product or spec.sharedHomePath
+type CacheBackupRequestDefaulter struct{}
+
+var _ admission.CustomDefaulter = &CacheBackupRequestDefaulter{}
+
+// Default implements admission.CustomDefaulter so a webhook will be registered for the type
+func (d *CacheBackupRequestDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*CacheBackupRequest)
+	if !ok {
+		return fmt.Errorf("expected a CacheBackupRequest but got a %T", obj)
+	}
+	cachebackuprequestlog.Info("default", "name", r.Name)
+	ApplyPlain(&r.Spec)
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return nil
+	}
+	return stampRunRequest(r, req, time.Now())
+}
+
+// stampRunRequest records who set the run-now token and when. Values set by
+// clients are replaced, so that they can be trusted by the reconciler
+func stampRunRequest(r *CacheBackupRequest, req admission.Request, now time.Time) error {
+	old := &CacheBackupRequest{}
+	if len(req.OldObject.Raw) > 0 {
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return err
+		}
+	}
+
+	token := r.Annotations[RunNowAnnotation]
+	delete(r.Annotations, RunNowRequestedByAnnotation)
+	delete(r.Annotations, RunNowRequestedAtAnnotation)
+	if token == "" {
+		return nil
+	}
+	if token == old.Annotations[RunNowAnnotation] {
+		for _, key := range []string{RunNowRequestedByAnnotation, RunNowRequestedAtAnnotation} {
+			if value, ok := old.Annotations[key]; ok {
+				r.Annotations[key] = value
+			}
+		}
+		return nil
+	}
+	r.Annotations[RunNowRequestedByAnnotation] = req.UserInfo.Username
+	r.Annotations[RunNowRequestedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-cache-atlassian-com-v1-cachebackuprequest,mutating=false,failurePolicy=fail,sideEffects=None,groups=cache.atlassian.com,resources=cachebackuprequests,verbs=create;update,versions=v1,name=vcachebackuprequest.kb.io,admissionReviewVersions=v1
+
+// CacheBackupRequestValidator validates requests with the operator-wide defaults applied, the way the
+// reconciler reads them
+type CacheBackupRequestValidator struct {
+	Defaults SpecDefaults
+}
+
+var _ admission.CustomValidator = &CacheBackupRequestValidator{}
+
+// ValidateCreate implements admission.CustomValidator so a webhook will be registered for the type
+func (v *CacheBackupRequestValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	r, ok := obj.(*CacheBackupRequest)
+	if !ok {
+		return fmt.Errorf("expected a CacheBackupRequest but got a %T", obj)
+	}
+	return v.defaulted(r).ValidateCreate()
+}
+
+// ValidateUpdate implements admission.CustomValidator so a webhook will be registered for the type
+func (v *CacheBackupRequestValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	r, ok := newObj.(*CacheBackupRequest)
+	if !ok {
+		return fmt.Errorf("expected a CacheBackupRequest but got a %T", newObj)
+	}
+	return v.defaulted(r).ValidateUpdate(oldObj)
+}
+
+// ValidateDelete implements admission.CustomValidator so a webhook will be registered for the type
+func (v *CacheBackupRequestValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (v *CacheBackupRequestValidator) defaulted(r *CacheBackupRequest) *CacheBackupRequest {
+	r = r.DeepCopy()
+	v.Defaults.Apply(r)
+	return r
+}
+
+var _ webhook.Validator = &CacheBackupRequest{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *CacheBackupRequest) ValidateCreate() error {
+	cachebackuprequestlog.Info("validate create", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *CacheBackupRequest) ValidateUpdate(old runtime.Object) error {
+	cachebackuprequestlog.Info("validate update", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *CacheBackupRequest) ValidateDelete() error {
+	return nil
+}
+
+func (r *CacheBackupRequest) validate() error {
+	allErrs := r.ValidateSpec()
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("CacheBackupRequest").GroupKind(), r.Name, allErrs)
+}
+
+// ValidateSpec returns every problem with the spec that would prevent the
+// pre-warmer pod or the local home PVC from being created
+func (r *CacheBackupRequest) ValidateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	// a Helm release provides the instance fields the request omits
+	fromRelease := r.Spec.HelmReleaseRef != nil
+	if fromRelease && r.Spec.HelmReleaseRef.Name == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("helmReleaseRef", "name"), ""))
+	}
+
+	targetPath := specPath.Child("target")
+	if r.Spec.StatefulSetRef == nil {
+		if r.Spec.Target.InstanceName == "" && !fromRelease {
+			allErrs = append(allErrs, field.Required(targetPath.Child("instanceName"), "name of the Helm release is required"))
+		}
+		if r.Spec.Target.Ordinal < 0 {
+			allErrs = append(allErrs, field.Invalid(targetPath.Child("ordinal"), r.Spec.Target.Ordinal, "must be greater than or equal to 0"))
+		}
+	} else {
+		allErrs = append(allErrs, validateStatefulSetRef(specPath.Child("statefulSetRef"), r.Spec.StatefulSetRef)...)
+	}
+
+	if r.Spec.PVCNameTemplate != "" {
+		if _, err := r.PVCName(0); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("pvcNameTemplate"), r.Spec.PVCNameTemplate, err.Error()))
+		}
+	}
+
+	if r.Spec.PodTemplate.Spec != nil {
+		allErrs = append(allErrs, validatePodSpecOverride(specPath.Child("podTemplate", "spec"), r.Spec.PodTemplate.Spec)...)
+	}
+
+	allErrs = append(allErrs, validateSchedule(specPath.Child("schedule"), r.Spec.Schedule)...)
+	allErrs = append(allErrs, validateWindows(specPath.Child("maintenanceWindows"), r.Spec.MaintenanceWindows)...)
+	allErrs = append(allErrs, validateWindows(specPath.Child("blackoutWindows"), r.Spec.BlackoutWindows)...)
+
+	if r.Spec.SharedHomePVCName == "" && !fromRelease {
+		allErrs = append(allErrs, field.Required(specPath.Child("sharedHomePVCName"), ""))
+	}
+	allErrs = append(allErrs, validateAbsolutePath(specPath.Child("sharedHomePath"), r.Spec.SharedHomePath, !fromRelease)...)
+	allErrs = append(allErrs, validateAbsolutePath(specPath.Child("localHomePath"), r.Spec.LocalHomePath, !fromRelease)...)
+	allErrs = append(allErrs, validateAbsolutePath(specPath.Child("indexSnapshotsPath"), r.Spec.IndexSnapshotsPath, false)...)
+	if path.IsAbs(r.Spec.IndexSnapshotsPath) && path.IsAbs(r.Spec.SharedHomePath) && !withinDir(r.Spec.IndexSnapshotsPath, r.Spec.SharedHomePath) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("indexSnapshotsPath"), r.Spec.IndexSnapshotsPath, "must be in sharedHomePath, the pre-warmer pod only mounts shared home"))
+	}
+	allErrs = append(allErrs, validateSnapshotLayout(specPath.Child("snapshotLayout"), r.Spec.SnapshotLayout)...)
+	if r.Spec.Product == ProductJira {
+		layoutPath := specPath.Child("snapshotLayout")
+		for name, pattern := range map[string]string{
+			"changeIndex":          r.Spec.SnapshotLayout.ChangeIndex,
+			"edgeIndex":            r.Spec.SnapshotLayout.EdgeIndex,
+			"mainIndexJournalId":   r.Spec.SnapshotLayout.MainIndexJournalID,
+			"changeIndexJournalId": r.Spec.SnapshotLayout.ChangeIndexJournalID,
+			"edgeIndexJournalId":   r.Spec.SnapshotLayout.EdgeIndexJournalID,
+		} {
+			if pattern != "" {
+				allErrs = append(allErrs, field.Forbidden(layoutPath.Child(name), "Jira has a single index without journal id, only mainIndex is used"))
+			}
+		}
+	}
+	if r.Spec.VerifyIndex && r.Spec.ConfigMapName != "" {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("verifyIndex"), "restore scripts of configMapName do not check the index, remove configMapName to use the built-in restore"))
+	}
+	if r.Spec.KeepPreviousIndexes < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("keepPreviousIndexes"), r.Spec.KeepPreviousIndexes, "must be greater than or equal to 0"))
+	}
+	if r.Spec.RollbackTo != nil {
+		rollbackPath := specPath.Child("rollbackTo")
+		if r.Spec.RollbackTo.Generation < 1 {
+			allErrs = append(allErrs, field.Invalid(rollbackPath.Child("generation"), r.Spec.RollbackTo.Generation, "must be greater than or equal to 1"))
+		}
+		if r.Spec.RollbackTo.Token == "" {
+			allErrs = append(allErrs, field.Required(rollbackPath.Child("token"), ""))
+		}
+		if r.Spec.ConfigMapName != "" {
+			allErrs = append(allErrs, field.Forbidden(rollbackPath, "restore scripts of configMapName do not keep previous indexes, remove configMapName to use the built-in restore"))
+		}
+	}
+	if r.Spec.SafetySnapshot != nil {
+		snapshotPath := specPath.Child("safetySnapshot")
+		if r.Spec.SafetySnapshot.VolumeSnapshotClassName == "" {
+			allErrs = append(allErrs, field.Required(snapshotPath.Child("volumeSnapshotClassName"), ""))
+		}
+		if r.Spec.SafetySnapshot.Retain < 0 {
+			allErrs = append(allErrs, field.Invalid(snapshotPath.Child("retain"), r.Spec.SafetySnapshot.Retain, "must be greater than or equal to 0, 0 keeping the default number of snapshots"))
+		}
+	}
+	if r.Spec.RestoreSafetySnapshot != nil {
+		restorePath := specPath.Child("restoreSafetySnapshot")
+		if r.Spec.RestoreSafetySnapshot.VolumeSnapshotName == "" {
+			allErrs = append(allErrs, field.Required(restorePath.Child("volumeSnapshotName"), ""))
+		}
+		if r.Spec.RestoreSafetySnapshot.Token == "" {
+			allErrs = append(allErrs, field.Required(restorePath.Child("token"), ""))
+		}
+		if !r.Spec.PVC.Create {
+			allErrs = append(allErrs, field.Forbidden(restorePath, "the PVC is recreated from spec.pvc, which requires pvc.create to be true"))
+		}
+	}
+	if r.Spec.Verification != nil {
+		allErrs = append(allErrs, validateVerification(specPath.Child("verification"), r.Spec.Verification, r.Spec.ConfigMapName)...)
+	}
+	if r.Spec.SharedHomePath != "" && path.Clean(r.Spec.SharedHomePath) == path.Clean(r.Spec.LocalHomePath) {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("localHomePath"), r.Spec.LocalHomePath, "must not be the same as sharedHomePath"))
+	}
+
+	pvcPath := specPath.Child("pvc")
+	if r.Spec.PVC.StorageRequest != "" {
+		if _, err := resource.ParseQuantity(r.Spec.PVC.StorageRequest); err != nil {
+			allErrs = append(allErrs, field.Invalid(pvcPath.Child("storageRequest"), r.Spec.PVC.StorageRequest, err.Error()))
+		}
+	} else if r.Spec.PVC.Create && !r.Spec.PVC.FromVolumeClaimTemplate {
+		allErrs = append(allErrs, field.Required(pvcPath.Child("storageRequest"), "required when pvc.create is true, unless pvc.fromVolumeClaimTemplate is"))
+	}
+	return allErrs
+}
+
+func validateVerification(fldPath *field.Path, verification *VerificationSpec, configMapName string) field.ErrorList {
+	var allErrs field.ErrorList
+	refPath := fldPath.Child("publicKeySecretRef")
+	ref := verification.PublicKeySecretRef
+	if ref == nil {
+		return append(allErrs, field.Required(refPath, ""))
+	}
+	if ref.Name == "" {
+		allErrs = append(allErrs, field.Required(refPath.Child("name"), ""))
+	}
+	if ref.Key == "" {
+		allErrs = append(allErrs, field.Required(refPath.Child("key"), ""))
+	}
+	if configMapName != "" {
+		allErrs = append(allErrs, field.Forbidden(refPath, "restore scripts of configMapName do not verify signatures, remove configMapName to use the built-in restore"))
+	}
+	return allErrs
+}
+
+func validateStatefulSetRef(fldPath *field.Path, ref *StatefulSetRef) field.ErrorList {
+	var allErrs field.ErrorList
+	if ref.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	}
+	for i, ordinal := range ref.IncludeOrdinals {
+		if ordinal < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("includeOrdinals").Index(i), ordinal, "must be greater than or equal to 0"))
+		}
+	}
+	for i, ordinal := range ref.ExcludeOrdinals {
+		if ordinal < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("excludeOrdinals").Index(i), ordinal, "must be greater than or equal to 0"))
+		}
+	}
+	return allErrs
+}
+
+// validatePodSpecOverride checks the names the pod spec is merged by, the schema does not require them
+func validatePodSpecOverride(fldPath *field.Path, spec *corev1.PodSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, container := range spec.InitContainers {
+		if container.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("initContainers").Index(i).Child("name"), ""))
+		}
+	}
+	for i, container := range spec.Containers {
+		if container.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("containers").Index(i).Child("name"), ""))
+		}
+	}
+	for i, volume := range spec.Volumes {
+		if volume.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("volumes").Index(i).Child("name"), ""))
+		}
+	}
+	return allErrs
+}
+
+// validateSnapshotLayout checks the patterns are well-formed and match files in indexSnapshotsPath
+func validateSnapshotLayout(fldPath *field.Path, layout SnapshotLayout) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, p := range []struct{ name, pattern string }{
+		{"mainIndex", layout.MainIndex},
+		{"changeIndex", layout.ChangeIndex},
+		{"edgeIndex", layout.EdgeIndex},
+		{"mainIndexJournalId", layout.MainIndexJournalID},
+		{"changeIndexJournalId", layout.ChangeIndexJournalID},
+		{"edgeIndexJournalId", layout.EdgeIndexJournalID},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		if _, err := path.Match(p.pattern, ""); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(p.name), p.pattern, err.Error()))
+		} else if path.IsAbs(p.pattern) || !strings.HasPrefix(path.Join("/snapshots", p.pattern), "/snapshots/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(p.name), p.pattern, "must be relative to indexSnapshotsPath"))
+		}
+	}
+	return allErrs
+}
+
+func validateSchedule(fldPath *field.Path, spec ScheduleSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.Cron != "" {
+		if _, err := schedule.ParseCron(spec.Cron); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("cron"), spec.Cron, err.Error()))
+		}
+		if spec.Interval.Duration != 0 {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("interval"), "must not be set together with cron"))
+		}
+	} else if spec.Interval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("interval"), spec.Interval.Duration.String(), "must be greater than 0"))
+	}
+	if spec.TimeZone != "" {
+		if _, err := time.LoadLocation(spec.TimeZone); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("timeZone"), spec.TimeZone, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+func validateWindows(fldPath *field.Path, windows []TimeWindow) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, w := range windows {
+		if _, err := schedule.ParseWindow(daysOfWeek(w.Days), w.Start, w.End); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), w, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// withinDir returns true if the absolute path p is dir or is in dir
+func withinDir(p, dir string) bool {
+	p, dir = path.Clean(p), path.Clean(dir)
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func validateAbsolutePath(fldPath *field.Path, value string, required bool) field.ErrorList {
+	if value == "" {
+		if required {
+			return field.ErrorList{field.Required(fldPath, "")}
+		}
+		return nil
+	}
+	if !path.IsAbs(value) {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be an absolute path")}
+	}
+	return nil
+}
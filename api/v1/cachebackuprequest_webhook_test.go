@@ -0,0 +1,242 @@
+package v1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newValidRequest() *CacheBackupRequest {
+	return &CacheBackupRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "local-home-1",
+			Namespace: "default",
+		},
+		Spec: CacheBackupRequestSpec{
+			Product: ProductConfluence,
+			Target: TargetSpec{
+				InstanceName: "confluence",
+				Ordinal:      1,
+			},
+			Schedule: ScheduleSpec{
+				Interval: metav1.Duration{Duration: 30 * time.Minute},
+			},
+			SharedHomePVCName:  "confluence-shared-home-pvc",
+			SharedHomePath:     "/var/atlassian/application-data/shared-home",
+			LocalHomePath:      "/var/atlassian/application-data/confluence",
+			IndexSnapshotsPath: "/var/atlassian/application-data/shared-home/index-snapshots",
+			SnapshotLayout:     ProfileOf(ProductConfluence).SnapshotLayout,
+			ConfigMapName:      "copy-index",
+			PVC: PVCSpec{
+				Create:         true,
+				StorageRequest: "200Gi",
+			},
+		},
+	}
+}
+
+func TestValidateCreateAcceptsValidSpec(t *testing.T) {
+	assert.NoError(t, newValidRequest().ValidateCreate())
+}
+
+func TestValidateRejectsInvalidSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(r *CacheBackupRequest)
+		field  string
+	}{
+		{"missing instance name", func(r *CacheBackupRequest) { r.Spec.Target.InstanceName = "" }, "spec.target.instanceName"},
+		{"negative ordinal", func(r *CacheBackupRequest) { r.Spec.Target.Ordinal = -1 }, "spec.target.ordinal"},
+		{"statefulSetRef without name", func(r *CacheBackupRequest) { r.Spec.StatefulSetRef = &StatefulSetRef{} }, "spec.statefulSetRef.name"},
+		{"negative excluded ordinal", func(r *CacheBackupRequest) {
+			r.Spec.StatefulSetRef = &StatefulSetRef{Name: "confluence", ExcludeOrdinals: []int32{0, -1}}
+		}, "spec.statefulSetRef.excludeOrdinals[1]"},
+		{"helmReleaseRef without name", func(r *CacheBackupRequest) { r.Spec.HelmReleaseRef = &HelmReleaseRef{} }, "spec.helmReleaseRef.name"},
+		{"pod template container without name", func(r *CacheBackupRequest) {
+			r.Spec.PodTemplate.Spec = &corev1.PodSpec{Containers: []corev1.Container{{Name: "pre-warmer"}, {Image: "exporter"}}}
+		}, "spec.podTemplate.spec.containers[1].name"},
+		{"unparsable PVC name template", func(r *CacheBackupRequest) { r.Spec.PVCNameTemplate = "data-{{ .Ordinal" }, "spec.pvcNameTemplate"},
+		{"unknown PVC name template field", func(r *CacheBackupRequest) { r.Spec.PVCNameTemplate = "data-{{ .Release }}" }, "spec.pvcNameTemplate"},
+		{"invalid PVC name", func(r *CacheBackupRequest) { r.Spec.PVCNameTemplate = "Data_{{ .Ordinal }}" }, "spec.pvcNameTemplate"},
+		{"zero interval", func(r *CacheBackupRequest) { r.Spec.Schedule.Interval.Duration = 0 }, "spec.schedule.interval"},
+		{"invalid cron", func(r *CacheBackupRequest) { r.Spec.Schedule = ScheduleSpec{Cron: "0 25 * * *"} }, "spec.schedule.cron"},
+		{"cron and interval", func(r *CacheBackupRequest) { r.Spec.Schedule.Cron = "@daily" }, "spec.schedule.interval"},
+		{"unknown time zone", func(r *CacheBackupRequest) { r.Spec.Schedule.TimeZone = "Mars/Olympus_Mons" }, "spec.schedule.timeZone"},
+		{"invalid maintenance window", func(r *CacheBackupRequest) {
+			r.Spec.MaintenanceWindows = []TimeWindow{{Start: "01:00", End: "05:00"}, {Start: "8am", End: "10:00"}}
+		}, "spec.maintenanceWindows[1]"},
+		{"invalid blackout day", func(r *CacheBackupRequest) {
+			r.Spec.BlackoutWindows = []TimeWindow{{Days: []DayOfWeek{"Someday"}, Start: "08:00", End: "18:00"}}
+		}, "spec.blackoutWindows[0]"},
+		{"missing shared home PVC", func(r *CacheBackupRequest) { r.Spec.SharedHomePVCName = "" }, "spec.sharedHomePVCName"},
+		{"relative shared home", func(r *CacheBackupRequest) { r.Spec.SharedHomePath = "shared-home" }, "spec.sharedHomePath"},
+		{"missing local home", func(r *CacheBackupRequest) { r.Spec.LocalHomePath = "" }, "spec.localHomePath"},
+		{"relative snapshots path", func(r *CacheBackupRequest) { r.Spec.IndexSnapshotsPath = "index-snapshots" }, "spec.indexSnapshotsPath"},
+		{"snapshots outside shared home", func(r *CacheBackupRequest) { r.Spec.IndexSnapshotsPath = "/var/atlassian/index-snapshots" }, "spec.indexSnapshotsPath"},
+		{"absolute snapshot pattern", func(r *CacheBackupRequest) { r.Spec.SnapshotLayout.MainIndex = "/index-snapshots/main_*.zip" }, "spec.snapshotLayout.mainIndex"},
+		{"snapshot pattern outside snapshots path", func(r *CacheBackupRequest) { r.Spec.SnapshotLayout.EdgeIndexJournalID = "../edge_journal_id" }, "spec.snapshotLayout.edgeIndexJournalId"},
+		{"malformed snapshot pattern", func(r *CacheBackupRequest) { r.Spec.SnapshotLayout.ChangeIndex = "change_[*.zip" }, "spec.snapshotLayout.changeIndex"},
+		{"Jira snapshot layout with journal id", func(r *CacheBackupRequest) {
+			r.Spec.Product = ProductJira
+			r.Spec.SnapshotLayout = SnapshotLayout{MainIndex: "IndexSnapshot_*.zip", MainIndexJournalID: "journal_id"}
+		}, "spec.snapshotLayout.mainIndexJournalId"},
+		{"verifyIndex with restore script", func(r *CacheBackupRequest) { r.Spec.VerifyIndex = true }, "spec.verifyIndex"},
+		{"verification without key", func(r *CacheBackupRequest) {
+			r.Spec.ConfigMapName = ""
+			r.Spec.Verification = &VerificationSpec{PublicKeySecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "snapshot-signing"}}}
+		}, "spec.verification.publicKeySecretRef.key"},
+		{"verification with restore script", func(r *CacheBackupRequest) {
+			r.Spec.Verification = &VerificationSpec{PublicKeySecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "snapshot-signing"},
+				Key:                  "public-key.pem",
+			}}
+		}, "spec.verification.publicKeySecretRef"},
+		{"negative keepPreviousIndexes", func(r *CacheBackupRequest) {
+			r.Spec.ConfigMapName = ""
+			r.Spec.KeepPreviousIndexes = -1
+		}, "spec.keepPreviousIndexes"},
+		{"rollback to live index", func(r *CacheBackupRequest) {
+			r.Spec.ConfigMapName = ""
+			r.Spec.RollbackTo = &RollbackRequest{Token: "1"}
+		}, "spec.rollbackTo.generation"},
+		{"rollback without token", func(r *CacheBackupRequest) {
+			r.Spec.ConfigMapName = ""
+			r.Spec.RollbackTo = &RollbackRequest{Generation: 1}
+		}, "spec.rollbackTo.token"},
+		{"rollback with restore script", func(r *CacheBackupRequest) { r.Spec.RollbackTo = &RollbackRequest{Generation: 1, Token: "1"} }, "spec.rollbackTo"},
+		{"safety snapshot without class", func(r *CacheBackupRequest) { r.Spec.SafetySnapshot = &SafetySnapshotSpec{Retain: 2} }, "spec.safetySnapshot.volumeSnapshotClassName"},
+		{"negative safety snapshot retain", func(r *CacheBackupRequest) {
+			r.Spec.SafetySnapshot = &SafetySnapshotSpec{VolumeSnapshotClassName: "csi-snapclass", Retain: -1}
+		}, "spec.safetySnapshot.retain"},
+		{"safety snapshot restore without token", func(r *CacheBackupRequest) {
+			r.Spec.RestoreSafetySnapshot = &SafetySnapshotRestoreRequest{VolumeSnapshotName: "local-home-confluence-1-20230301020000"}
+		}, "spec.restoreSafetySnapshot.token"},
+		{"safety snapshot restore of existing PVC", func(r *CacheBackupRequest) {
+			r.Spec.PVC.Create = false
+			r.Spec.RestoreSafetySnapshot = &SafetySnapshotRestoreRequest{VolumeSnapshotName: "local-home-confluence-1-20230301020000", Token: "1"}
+		}, "spec.restoreSafetySnapshot"},
+		{"same mount path", func(r *CacheBackupRequest) { r.Spec.LocalHomePath = r.Spec.SharedHomePath + "/" }, "spec.localHomePath"},
+		{"unparsable quantity", func(r *CacheBackupRequest) { r.Spec.PVC.StorageRequest = "200 GB" }, "spec.pvc.storageRequest"},
+		{"create without request", func(r *CacheBackupRequest) { r.Spec.PVC.StorageRequest = "" }, "spec.pvc.storageRequest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newValidRequest()
+			tt.mutate(r)
+			err := r.ValidateUpdate(newValidRequest())
+			assert.True(t, apierrors.IsInvalid(err))
+			statusErr := err.(*apierrors.StatusError)
+			assert.Len(t, statusErr.ErrStatus.Details.Causes, 1)
+			assert.Equal(t, tt.field, statusErr.ErrStatus.Details.Causes[0].Field)
+		})
+	}
+}
+
+func TestValidateSafetySnapshotRetain(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.SafetySnapshot = &SafetySnapshotSpec{VolumeSnapshotClassName: "csi-snapclass"}
+	// 0 keeps the default number of snapshots
+	assert.Empty(t, r.ValidateSpec())
+	r.Spec.SafetySnapshot.Retain = 1
+	assert.Empty(t, r.ValidateSpec())
+	r.Spec.SafetySnapshot.Retain = -1
+	errs := r.ValidateSpec()
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "spec.safetySnapshot.retain", errs[0].Field)
+	assert.Equal(t, "must be greater than or equal to 0, 0 keeping the default number of snapshots", errs[0].Detail)
+}
+
+func TestValidateDoesNotRequireStorageRequestForExistingPVC(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.PVC = PVCSpec{}
+	assert.NoError(t, r.ValidateCreate())
+}
+
+func TestValidateLeavesInstanceFieldsToHelmRelease(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.HelmReleaseRef = &HelmReleaseRef{Name: "wiki"}
+	r.Spec.Target = TargetSpec{}
+	r.Spec.SharedHomePVCName = ""
+	r.Spec.SharedHomePath = ""
+	r.Spec.LocalHomePath = ""
+	assert.NoError(t, r.ValidateCreate())
+
+	r.Spec.LocalHomePath = "relative"
+	assert.Error(t, r.ValidateCreate())
+}
+
+func TestValidateAcceptsCronScheduleWithWindows(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.Schedule = ScheduleSpec{Cron: "0 */2 * * *", TimeZone: "Australia/Sydney"}
+	r.Spec.MaintenanceWindows = []TimeWindow{{Days: []DayOfWeek{"Sat", "Sun"}, Start: "22:00", End: "06:00"}}
+	r.Spec.BlackoutWindows = []TimeWindow{{Start: "08:00", End: "18:00"}}
+	assert.NoError(t, r.ValidateCreate())
+
+	s, err := r.Spec.RunSchedule()
+	assert.NoError(t, err)
+	assert.NotNil(t, s.Cron)
+	assert.Equal(t, "Australia/Sydney", s.Location.String())
+	assert.Len(t, s.Maintenance, 1)
+	assert.Len(t, s.Blackout, 1)
+}
+
+func TestPVCNameTemplate(t *testing.T) {
+	r := newValidRequest()
+	r.Spec.PVCNameTemplate = "{{ .Namespace }}-data-{{ .InstanceName }}-{{ .Ordinal }}"
+	assert.NoError(t, r.ValidateCreate())
+	name, err := r.PVCName(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "default-data-confluence-3", name)
+
+	r.Spec.StatefulSetRef = &StatefulSetRef{Name: "wiki"}
+	name, err = r.PVCName(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "default-data-wiki-0", name)
+}
+
+// admit runs the defaulting and validating webhooks over a request, as the API server does before storing it
+func admit(t *testing.T, r, old *CacheBackupRequest) error {
+	assert.NoError(t, (&CacheBackupRequestDefaulter{}).Default(context.TODO(), r))
+	validator := &CacheBackupRequestValidator{Defaults: ConfluenceDefaults()}
+	if old == nil {
+		return validator.ValidateCreate(context.TODO(), r)
+	}
+	return validator.ValidateUpdate(context.TODO(), old, r)
+}
+
+func TestSharedHomePathCanChangeAfterDefaulting(t *testing.T) {
+	r := &CacheBackupRequest{Spec: CacheBackupRequestSpec{Target: TargetSpec{InstanceName: "confluence"}}}
+	assert.NoError(t, admit(t, r, nil))
+	assert.Empty(t, r.Spec.IndexSnapshotsPath)
+
+	updated := r.DeepCopy()
+	updated.Spec.SharedHomePath = "/shared"
+	assert.NoError(t, admit(t, updated, r))
+	assert.Empty(t, updated.Spec.IndexSnapshotsPath)
+
+	// the snapshots path is derived from the shared home path when the request is reconciled
+	ConfluenceDefaults().Apply(updated)
+	assert.Equal(t, "/shared/index-snapshots", updated.Spec.IndexSnapshotsPath)
+}
+
+func TestProductCanChangeAfterDefaulting(t *testing.T) {
+	r := &CacheBackupRequest{Spec: CacheBackupRequestSpec{Target: TargetSpec{InstanceName: "jira"}}}
+	assert.NoError(t, admit(t, r, nil))
+	assert.Empty(t, r.Spec.Product)
+	assert.Empty(t, r.Spec.SnapshotLayout)
+
+	updated := r.DeepCopy()
+	updated.Spec.Product = ProductJira
+	assert.NoError(t, admit(t, updated, r))
+
+	// the paths and the layout follow the product when the request is reconciled
+	ConfluenceDefaults().Apply(updated)
+	assert.Equal(t, "/var/atlassian/application-data/jira", updated.Spec.LocalHomePath)
+	assert.Equal(t, "/var/atlassian/application-data/shared-home/export/indexsnapshots", updated.Spec.IndexSnapshotsPath)
+	assert.Equal(t, SnapshotLayout{MainIndex: "IndexSnapshot_*.zip"}, updated.Spec.SnapshotLayout)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterCacheBackupPolicySpec defines the desired state of ClusterCacheBackupPolicy
+type ClusterCacheBackupPolicySpec struct {
+	// NamespaceSelector selects the namespaces StatefulSets are selected in, all namespaces when omitted
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// StatefulSetSelector selects the StatefulSets a CacheBackupRequest is created for, an empty selector selects all of them
+	StatefulSetSelector metav1.LabelSelector `json:"statefulSetSelector"`
+	// Template of the CacheBackupRequests created for the selected StatefulSets
+	Template CacheBackupRequestTemplate `json:"template"`
+}
+
+// CacheBackupRequestTemplate describes the CacheBackupRequests created by a policy
+type CacheBackupRequestTemplate struct {
+	// Labels added to the requests
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the requests
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Spec of the requests, statefulSetRef.name is set to the name of each selected StatefulSet.
+	// Changes to the spec of a created request are overwritten by the policy
+	Spec CacheBackupRequestSpec `json:"spec,omitempty"`
+}
+
+// PolicyLabel is set on the CacheBackupRequests created by a ClusterCacheBackupPolicy to the policy name
+const PolicyLabel = "cache.atlassian.com/policy"
+
+// Condition reasons of a ClusterCacheBackupPolicy
+const (
+	// ReasonRequestConflict means a CacheBackupRequest the policy would create exists and is not owned by the policy
+	ReasonRequestConflict = "RequestConflict"
+)
+
+// ClusterCacheBackupPolicyStatus defines the observed state of ClusterCacheBackupPolicy
+type ClusterCacheBackupPolicyStatus struct {
+	// ObservedGeneration is the .metadata.generation the status was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Requests is the number of CacheBackupRequests owned by the policy
+	Requests int32 `json:"requests,omitempty"`
+	// Conditions describe the current state of the policy
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,shortName=ccbp
+//+kubebuilder:printcolumn:name="Requests",type=integer,JSONPath=`.status.requests`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterCacheBackupPolicy creates a CacheBackupRequest for every selected StatefulSet
+// and deletes it when the StatefulSet is no longer selected
+type ClusterCacheBackupPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterCacheBackupPolicySpec   `json:"spec,omitempty"`
+	Status ClusterCacheBackupPolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterCacheBackupPolicyList contains a list of ClusterCacheBackupPolicy
+type ClusterCacheBackupPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCacheBackupPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCacheBackupPolicy{}, &ClusterCacheBackupPolicyList{})
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"time"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConversionDataAnnotation holds the v1 spec of an object read as v1beta1, so that
+// fields v1beta1 cannot represent survive a v1 -> v1beta1 -> v1 round trip
+const ConversionDataAnnotation = "cache.atlassian.com/conversion-data"
+
+// dateFormatLayout is the layout of status.lastTransactionTime
+const dateFormatLayout = "2006-01-02 15:04:05 -0700"
+
+// legacyPhases are the values of status.status that are also phases, the others were operator states
+var legacyPhases = map[string]bool{
+	string(PhasePending):   true,
+	string(PhaseRunning):   true,
+	string(PhaseSucceeded): true,
+	string(PhaseSkipped):   true,
+	string(PhaseFailed):    true,
+}
+
+// StatusConversionDataAnnotation holds the v1 status fields v1beta1 cannot represent,
+// e.g. status.ordinals, for the same reason
+const StatusConversionDataAnnotation = "cache.atlassian.com/status-conversion-data"
+
+// ConvertTo converts this CacheBackupRequest to the Hub version (v1)
+func (src *CacheBackupRequest) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*cachev1.CacheBackupRequest)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	// start from the v1 spec and status preserved by ConvertFrom, if any, and
+	// overwrite only the fields v1beta1 knows about
+	if err := restoreConversionData(&dst.ObjectMeta, ConversionDataAnnotation, &dst.Spec); err != nil {
+		return err
+	}
+	if err := restoreConversionData(&dst.ObjectMeta, StatusConversionDataAnnotation, &dst.Status); err != nil {
+		return err
+	}
+
+	src.Spec.DeepCopy().convertTo(&dst.Spec)
+	src.Status.DeepCopy().convertTo(&dst.Status)
+	// requests stored before status.ordinals existed keep their schedule
+	if len(dst.Status.Ordinals) == 0 && dst.Spec.StatefulSetRef == nil && dst.Status.LastSuccessfulTime != nil {
+		dst.Status.Ordinals = []cachev1.OrdinalStatus{{
+			Ordinal:                     dst.Spec.Target.Ordinal,
+			PVCName:                     dst.Status.PVCName,
+			Phase:                       dst.Status.Phase,
+			LastSuccessfulTime:          dst.Status.LastSuccessfulTime,
+			IndexRestoreDurationSeconds: dst.Status.IndexRestoreDurationSeconds,
+		}}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version
+func (dst *CacheBackupRequest) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*cachev1.CacheBackupRequest)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	spec := src.Spec.DeepCopy()
+	dst.Spec = CacheBackupRequestSpec{
+		SharedHomePVCName:     spec.SharedHomePVCName,
+		IndexSnapshotsPath:    spec.IndexSnapshotsPath,
+		SharedHomePath:        spec.SharedHomePath,
+		LocalHomePath:         spec.LocalHomePath,
+		InstanceName:          spec.Target.InstanceName,
+		StatefulSetNumber:     int(spec.Target.Ordinal),
+		BackupIntervalMinutes: intervalMinutes(spec.Schedule.Interval.Duration),
+		ConfigMapName:         spec.ConfigMapName,
+
+		PodLabels:                 spec.PodTemplate.Labels,
+		PodAnnotations:            spec.PodTemplate.Annotations,
+		PodResources:              spec.PodTemplate.Resources,
+		NodeSelector:              spec.PodTemplate.NodeSelector,
+		Tolerations:               spec.PodTemplate.Tolerations,
+		TopologySpreadConstraints: spec.PodTemplate.TopologySpreadConstraints,
+
+		CreatePVC:         spec.PVC.Create,
+		PVCLabels:         spec.PVC.Labels,
+		PVCAnnotations:    spec.PVC.Annotations,
+		PvcStorageRequest: spec.PVC.StorageRequest,
+		PvcStorageClass:   spec.PVC.StorageClassName,
+		PvcVolumeName:     spec.PVC.VolumeName,
+	}
+	if spec.PodTemplate.Affinity != nil {
+		dst.Spec.Affinity = *spec.PodTemplate.Affinity
+	}
+	if spec.PVC.VolumeMode != nil {
+		dst.Spec.PvcVolumeMode = string(*spec.PVC.VolumeMode)
+	}
+	if spec.PVC.Selector != nil {
+		dst.Spec.PvcLabelSelector = *spec.PVC.Selector
+	}
+
+	// preserve the v1 spec only if converting back would not restore it
+	var restored cachev1.CacheBackupRequestSpec
+	dst.Spec.DeepCopy().convertTo(&restored)
+	if err := preserveConversionData(&dst.ObjectMeta, ConversionDataAnnotation, src.Spec, restored); err != nil {
+		return err
+	}
+
+	status := src.Status.DeepCopy()
+	dst.Status = CacheBackupRequestStatus{
+		ObservedGeneration:          status.ObservedGeneration,
+		Phase:                       CacheBackupRequestPhase(status.Phase),
+		PVCName:                     status.PVCName,
+		Conditions:                  status.Conditions,
+		LastSuccessfulTime:          status.LastSuccessfulTime,
+		NextScheduledTime:           status.NextScheduledTime,
+		IndexRestoreDurationSeconds: status.IndexRestoreDurationSeconds,
+		Status:                      string(status.Phase),
+	}
+	if status.LastSuccessfulTime != nil {
+		dst.Status.LastTransactionTime = status.LastSuccessfulTime.Format(dateFormatLayout)
+	}
+	// the fields v1beta1 knows about are cleared from the preserved status, they are
+	// overwritten by ConvertTo anyway
+	(&CacheBackupRequestStatus{}).convertTo(status)
+	return preserveConversionData(&dst.ObjectMeta, StatusConversionDataAnnotation, *status, cachev1.CacheBackupRequestStatus{})
+}
+
+// restoreConversionData unmarshals into v the data preserved in an annotation by preserveConversionData
+// and removes the annotation
+func restoreConversionData(meta *metav1.ObjectMeta, annotation string, v interface{}) error {
+	data, ok := meta.Annotations[annotation]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return err
+	}
+	delete(meta.Annotations, annotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	return nil
+}
+
+// preserveConversionData stores v as JSON in an annotation, unless converting back restores it anyway
+func preserveConversionData(meta *metav1.ObjectMeta, annotation string, v, restored interface{}) error {
+	delete(meta.Annotations, annotation)
+	if equality.Semantic.DeepEqual(v, restored) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[annotation] = string(data)
+	return nil
+}
+
+// convertTo overwrites the fields of a v1 spec that have a v1beta1 counterpart
+func (spec *CacheBackupRequestSpec) convertTo(dst *cachev1.CacheBackupRequestSpec) {
+	dst.Target.InstanceName = spec.InstanceName
+	dst.Target.Ordinal = int32(spec.StatefulSetNumber)
+	// keep a sub-minute precision interval if it still rounds to what v1beta1 shows
+	if intervalMinutes(dst.Schedule.Interval.Duration) != spec.BackupIntervalMinutes {
+		dst.Schedule.Interval = metav1.Duration{Duration: time.Duration(spec.BackupIntervalMinutes) * time.Minute}
+	}
+	dst.SharedHomePVCName = spec.SharedHomePVCName
+	dst.SharedHomePath = spec.SharedHomePath
+	dst.LocalHomePath = spec.LocalHomePath
+	dst.IndexSnapshotsPath = spec.IndexSnapshotsPath
+	dst.ConfigMapName = spec.ConfigMapName
+
+	dst.PodTemplate.Labels = spec.PodLabels
+	dst.PodTemplate.Annotations = spec.PodAnnotations
+	dst.PodTemplate.Resources = spec.PodResources
+	dst.PodTemplate.NodeSelector = spec.NodeSelector
+	dst.PodTemplate.Tolerations = spec.Tolerations
+	dst.PodTemplate.Affinity = nil
+	if spec.Affinity != (corev1.Affinity{}) {
+		dst.PodTemplate.Affinity = &spec.Affinity
+	}
+	dst.PodTemplate.TopologySpreadConstraints = spec.TopologySpreadConstraints
+
+	dst.PVC.Create = spec.CreatePVC
+	dst.PVC.Labels = spec.PVCLabels
+	dst.PVC.Annotations = spec.PVCAnnotations
+	dst.PVC.StorageRequest = spec.PvcStorageRequest
+	dst.PVC.StorageClassName = spec.PvcStorageClass
+	dst.PVC.VolumeName = spec.PvcVolumeName
+	dst.PVC.VolumeMode = nil
+	if spec.PvcVolumeMode != "" {
+		volumeMode := corev1.PersistentVolumeMode(spec.PvcVolumeMode)
+		dst.PVC.VolumeMode = &volumeMode
+	}
+	dst.PVC.Selector = nil
+	if !isEmptyLabelSelector(spec.PvcLabelSelector) {
+		dst.PVC.Selector = &spec.PvcLabelSelector
+	}
+}
+
+// convertTo overwrites the fields of a v1 status that have a v1beta1 counterpart
+func (status *CacheBackupRequestStatus) convertTo(dst *cachev1.CacheBackupRequestStatus) {
+	dst.ObservedGeneration = status.ObservedGeneration
+	dst.Phase = cachev1.CacheBackupRequestPhase(status.Phase)
+	dst.PVCName = status.PVCName
+	dst.Conditions = status.Conditions
+	dst.LastSuccessfulTime = status.LastSuccessfulTime
+	dst.NextScheduledTime = status.NextScheduledTime
+	dst.IndexRestoreDurationSeconds = status.IndexRestoreDurationSeconds
+
+	// requests stored before the phase existed only have the status string and the time it was set at,
+	// the time of the last successful run when the status is Succeeded or Skipped
+	if dst.Phase == "" && legacyPhases[status.Status] {
+		dst.Phase = cachev1.CacheBackupRequestPhase(status.Status)
+	}
+	if dst.LastSuccessfulTime == nil && (status.Status == string(PhaseSucceeded) || status.Status == string(PhaseSkipped)) {
+		if t, err := time.Parse(dateFormatLayout, status.LastTransactionTime); err == nil {
+			lastSuccessfulTime := metav1.NewTime(t)
+			dst.LastSuccessfulTime = &lastSuccessfulTime
+		}
+	}
+}
+
+// intervalMinutes rounds an interval up to whole minutes, so that it is never shortened
+func intervalMinutes(interval time.Duration) int {
+	return int((interval + time.Minute - 1) / time.Minute)
+}
+
+func isEmptyLabelSelector(selector metav1.LabelSelector) bool {
+	return len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0
+}
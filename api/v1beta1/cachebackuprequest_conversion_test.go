@@ -0,0 +1,184 @@
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var metadataMap = map[string]string{"foo": "bar"}
+
+var v1beta1Request = CacheBackupRequest{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "local-home-1",
+		Namespace: "default",
+	},
+	Spec: CacheBackupRequestSpec{
+		SharedHomePVCName:     "confluence-shared-home-pvc",
+		IndexSnapshotsPath:    "/var/atlassian/application-data/shared-home/index-snapshots",
+		SharedHomePath:        "/var/atlassian/application-data/shared-home",
+		LocalHomePath:         "/var/atlassian/application-data/confluence",
+		InstanceName:          "confluence",
+		StatefulSetNumber:     1,
+		BackupIntervalMinutes: 30,
+		ConfigMapName:         "copy-index",
+		PodLabels:             metadataMap,
+		PodAnnotations:        metadataMap,
+		PodResources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+		NodeSelector: metadataMap,
+		Tolerations:  []corev1.Toleration{{Key: "example-key", Operator: "Equal", Value: "example-value"}},
+		Affinity: corev1.Affinity{
+			PodAffinity: &corev1.PodAffinity{},
+		},
+		CreatePVC:         true,
+		PVCLabels:         metadataMap,
+		PVCAnnotations:    metadataMap,
+		PvcStorageRequest: "200Gi",
+		PvcStorageClass:   "gp2",
+		PvcVolumeName:     "pv-1",
+		PvcVolumeMode:     "Filesystem",
+		PvcLabelSelector:  metav1.LabelSelector{MatchLabels: metadataMap},
+	},
+	Status: CacheBackupRequestStatus{
+		Phase:                       PhaseSucceeded,
+		Status:                      string(PhaseSucceeded),
+		PVCName:                     "local-home-confluence-1",
+		IndexRestoreDurationSeconds: 42,
+	},
+}
+
+func TestConvertToHub(t *testing.T) {
+	hub := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, v1beta1Request.DeepCopy().ConvertTo(hub))
+
+	assert.Equal(t, "confluence", hub.Spec.Target.InstanceName)
+	assert.Equal(t, int32(1), hub.Spec.Target.Ordinal)
+	assert.Equal(t, 30*time.Minute, hub.Spec.Schedule.Interval.Duration)
+	assert.NotNil(t, hub.Spec.PodTemplate.Affinity)
+	assert.Equal(t, "200Gi", hub.Spec.PVC.StorageRequest)
+	assert.Equal(t, corev1.PersistentVolumeFilesystem, *hub.Spec.PVC.VolumeMode)
+	assert.Equal(t, metadataMap, hub.Spec.PVC.Selector.MatchLabels)
+	assert.Equal(t, cachev1.PhaseSucceeded, hub.Status.Phase)
+}
+
+func TestV1beta1RoundTrip(t *testing.T) {
+	hub := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, v1beta1Request.DeepCopy().ConvertTo(hub))
+
+	restored := &CacheBackupRequest{}
+	assert.NoError(t, restored.ConvertFrom(hub))
+	assert.Equal(t, v1beta1Request.Spec, restored.Spec)
+	assert.Equal(t, v1beta1Request.Status, restored.Status)
+	assert.NotContains(t, restored.Annotations, ConversionDataAnnotation)
+	assert.NotContains(t, restored.Annotations, StatusConversionDataAnnotation)
+}
+
+func TestHubRoundTripKeepsSubMinuteInterval(t *testing.T) {
+	hub := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, v1beta1Request.DeepCopy().ConvertTo(hub))
+	hub.Spec.Schedule.Interval = metav1.Duration{Duration: 90 * time.Second}
+	hub.Spec.PodTemplate.Affinity = nil
+
+	spoke := &CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertFrom(hub))
+	// the interval is rounded up, never shortened
+	assert.Equal(t, 2, spoke.Spec.BackupIntervalMinutes)
+	assert.Contains(t, spoke.Annotations, ConversionDataAnnotation)
+
+	restored := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertTo(restored))
+	assert.Equal(t, hub.Spec, restored.Spec)
+	assert.NotContains(t, restored.Annotations, ConversionDataAnnotation)
+
+	// a v1beta1 client changing the interval wins over the preserved one
+	spoke.Spec.BackupIntervalMinutes = 10
+	assert.NoError(t, spoke.ConvertTo(restored))
+	assert.Equal(t, 10*time.Minute, restored.Spec.Schedule.Interval.Duration)
+}
+
+func TestHubRoundTripKeepsCronSchedule(t *testing.T) {
+	hub := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, v1beta1Request.DeepCopy().ConvertTo(hub))
+	hub.Spec.Schedule = cachev1.ScheduleSpec{Cron: "0 2 * * *", TimeZone: "Europe/Amsterdam"}
+	hub.Spec.BlackoutWindows = []cachev1.TimeWindow{{Start: "08:00", End: "18:00"}}
+
+	spoke := &CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertFrom(hub))
+	assert.Equal(t, 0, spoke.Spec.BackupIntervalMinutes)
+
+	restored := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertTo(restored))
+	assert.Equal(t, hub.Spec, restored.Spec)
+}
+
+func TestHubRoundTripKeepsV1Status(t *testing.T) {
+	hub := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, v1beta1Request.DeepCopy().ConvertTo(hub))
+	hub.Status.LastRunRequest = &cachev1.RunRequest{Token: "1", StartedAt: metav1.Unix(1677808800, 0)}
+	hub.Status.Ordinals = []cachev1.OrdinalStatus{{
+		Ordinal: 1,
+		PVCName: "local-home-confluence-1",
+		Phase:   cachev1.PhaseRestored,
+		LastRestore: &cachev1.RestoreResult{
+			Outcome: cachev1.RestoreOutcomeRestored,
+			Indexes: []cachev1.IndexRestoreResult{{Name: "main_index", SnapshotJournalID: 42}},
+		},
+	}}
+
+	spoke := &CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertFrom(hub))
+	assert.Equal(t, v1beta1Request.Status, spoke.Status)
+	assert.Contains(t, spoke.Annotations, StatusConversionDataAnnotation)
+	assert.NotContains(t, spoke.Annotations[StatusConversionDataAnnotation], "conditions")
+
+	restored := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertTo(restored))
+	assert.Equal(t, hub.Status, restored.Status)
+	assert.Nil(t, restored.Annotations)
+
+	// a v1beta1 client changing the phase wins over the preserved status
+	spoke.Status.Phase = PhaseFailed
+	assert.NoError(t, spoke.ConvertTo(restored))
+	assert.Equal(t, cachev1.PhaseFailed, restored.Status.Phase)
+	assert.Equal(t, hub.Status.Ordinals, restored.Status.Ordinals)
+}
+
+func TestConvertLegacyStatusKeepsSchedule(t *testing.T) {
+	legacy := v1beta1Request.DeepCopy()
+	legacy.Status = CacheBackupRequestStatus{
+		PVCName:             "local-home-confluence-1",
+		Status:              "Succeeded",
+		LastTransactionTime: "2023-03-01 10:00:00 +0100",
+	}
+	hub := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, legacy.ConvertTo(hub))
+	lastSuccessfulTime := time.Date(2023, 3, 1, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, cachev1.PhaseSucceeded, hub.Status.Phase)
+	assert.True(t, lastSuccessfulTime.Equal(hub.Status.LastSuccessfulTime.Time))
+	// the ordinal of the request is not run again before its interval elapsed
+	assert.Len(t, hub.Status.Ordinals, 1)
+	assert.Equal(t, int32(1), hub.Status.Ordinals[0].Ordinal)
+	assert.True(t, lastSuccessfulTime.Equal(hub.Status.Ordinals[0].LastSuccessfulTime.Time))
+
+	spoke := &CacheBackupRequest{}
+	assert.NoError(t, spoke.ConvertFrom(hub))
+	assert.Equal(t, "Succeeded", spoke.Status.Status)
+	parsed, err := time.Parse(dateFormatLayout, spoke.Status.LastTransactionTime)
+	assert.NoError(t, err)
+	assert.True(t, lastSuccessfulTime.Equal(parsed))
+
+	// operator states that are not phases, and runs that did not succeed, are not a last successful time
+	legacy.Status.Status = "PVCDoesNotExist"
+	hub = &cachev1.CacheBackupRequest{}
+	assert.NoError(t, legacy.ConvertTo(hub))
+	assert.Empty(t, hub.Status.Phase)
+	assert.Nil(t, hub.Status.LastSuccessfulTime)
+	assert.Empty(t, hub.Status.Ordinals)
+}
@@ -29,14 +29,22 @@ type CacheBackupRequestSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	SharedHomePVCName     string `json:"sharedHomePVCName,omitempty"`
-	IndexSnapshotsPath    string `json:"indexSnapshotsPath,omitempty"`
-	SharedHomePath        string `json:"sharedHomePath,omitempty"`
-	LocalHomePath         string `json:"localHomePath,omitempty"`
-	InstanceName          string `json:"instanceName,omitempty"`
-	StatefulSetNumber     int    `json:"statefulSetNumber,omitempty"`
-	BackupIntervalMinutes int    `json:"backupIntervalMinutes,omitempty"`
-	ConfigMapName         string `json:"configMapName,omitempty"`
+	// SharedHomePVCName is the name of a shared home PVC that will be mounted
+	SharedHomePVCName string `json:"sharedHomePVCName,omitempty"`
+	// IndexSnapshotsPath is the path to index snapshots in shared home
+	IndexSnapshotsPath string `json:"indexSnapshotsPath,omitempty"`
+	// SharedHomePath is the shared-home mount path
+	SharedHomePath string `json:"sharedHomePath,omitempty"`
+	// LocalHomePath is the local-home mount path
+	LocalHomePath string `json:"localHomePath,omitempty"`
+	// Name of the Helm release, e.g. confluence, jira
+	InstanceName string `json:"instanceName,omitempty"`
+	// Number of the pod in the statefulset
+	StatefulSetNumber int `json:"statefulSetNumber,omitempty"`
+	// Interval between backups
+	BackupIntervalMinutes int `json:"backupIntervalMinutes,omitempty"`
+	// ConfigMap with the script that copies/unpacks indexes
+	ConfigMapName string `json:"configMapName,omitempty"`
 
 	PodLabels                 map[string]string                 `json:"podLabels,omitempty"`
 	PodAnnotations            map[string]string                 `json:"podAnnotations,omitempty"`
@@ -46,33 +54,108 @@ type CacheBackupRequestSpec struct {
 	Affinity                  corev1.Affinity                   `json:"affinity,omitempty"`
 	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
 
-	CreatePVC         bool                 `json:"createPVC,omitempty"`
-	PVCLabels         map[string]string    `json:"pvcLabels,omitempty"`
-	PVCAnnotations    map[string]string    `json:"pvcAnnotations,omitempty"`
-	PvcStorageRequest string               `json:"pvcStorageRequest,omitempty"`
-	PvcStorageClass   string               `json:"pvcStorageClass,omitempty"`
-	PvcVolumeName     string               `json:"pvcVolumeName,omitempty"`
-	PvcVolumeMode     string               `json:"pvcVolumeMode,omitempty"`
-	PvcLabelSelector  metav1.LabelSelector `json:"pvcLabelSelector,omitempty"`
+	// Create a new PVC if missing
+	CreatePVC      bool              `json:"createPVC,omitempty"`
+	PVCLabels      map[string]string `json:"pvcLabels,omitempty"`
+	PVCAnnotations map[string]string `json:"pvcAnnotations,omitempty"`
+	// Local home PVC storage request in Gi
+	PvcStorageRequest string `json:"pvcStorageRequest,omitempty"`
+	// Local home PVC storage class
+	PvcStorageClass string `json:"pvcStorageClass,omitempty"`
+	PvcVolumeName   string `json:"pvcVolumeName,omitempty"`
+	// Local home PVC volume mode
+	PvcVolumeMode    string               `json:"pvcVolumeMode,omitempty"`
+	PvcLabelSelector metav1.LabelSelector `json:"pvcLabelSelector,omitempty"`
 }
 
+// CacheBackupRequestPhase is a high-level summary of where a CacheBackupRequest is in its lifecycle
+// +kubebuilder:validation:Enum=Pending;Waiting;Running;Succeeded;Restored;PartiallyRestored;RolledBack;Skipped;Failed
+type CacheBackupRequestPhase string
+
+const (
+	// PhasePending means the pre-warmer pod has been created but has not started yet
+	PhasePending CacheBackupRequestPhase = "Pending"
+	// PhaseWaiting means the local home PVC is missing or used by another pod
+	PhaseWaiting CacheBackupRequestPhase = "Waiting"
+	// PhaseRunning means the pre-warmer pod is restoring the index
+	PhaseRunning CacheBackupRequestPhase = "Running"
+	// PhaseSucceeded means the pre-warmer pod has succeeded without reporting a result, e.g. a restore script
+	PhaseSucceeded CacheBackupRequestPhase = "Succeeded"
+	// PhaseRestored means the index has been restored from shared home
+	PhaseRestored CacheBackupRequestPhase = "Restored"
+	// PhasePartiallyRestored means the main index has been restored but the snapshot of another index was missing
+	PhasePartiallyRestored CacheBackupRequestPhase = "PartiallyRestored"
+	// PhaseRolledBack means a kept index has been put back for spec.rollbackTo
+	PhaseRolledBack CacheBackupRequestPhase = "RolledBack"
+	// PhaseSkipped means the local home index was more recent than the snapshot in shared home
+	PhaseSkipped CacheBackupRequestPhase = "Skipped"
+	// PhaseFailed means the pre-warmer pod has failed
+	PhaseFailed CacheBackupRequestPhase = "Failed"
+)
+
+// Condition types reported in CacheBackupRequestStatus.Conditions
+const (
+	// ConditionReady is True when the last pre-warming run has completed successfully
+	ConditionReady = "Ready"
+	// ConditionPVCAvailable is True when the local home PVC exists and is not used by another pod
+	ConditionPVCAvailable = "PVCAvailable"
+	// ConditionRestoring is True while the pre-warmer pod is pending or running
+	ConditionRestoring = "Restoring"
+	// ConditionDegraded is True when pre-warming cannot make progress without intervention
+	ConditionDegraded = "Degraded"
+)
+
+// Condition reasons
+const (
+	ReasonPVCFound         = "PVCFound"
+	ReasonPVCNotFound      = "PVCNotFound"
+	ReasonPVCInUse         = "PVCInUse"
+	ReasonPodPending       = "PodPending"
+	ReasonPodRunning       = "PodRunning"
+	ReasonRestoreSucceeded = "RestoreSucceeded"
+	ReasonRestoreSkipped   = "RestoreSkipped"
+	ReasonRestorePartial   = "RestorePartial"
+	ReasonPodFailed        = "PodFailed"
+	ReasonAsExpected       = "AsExpected"
+)
+
 // CacheBackupRequestStatus defines the observed state of CacheBackupRequest
 type CacheBackupRequestStatus struct {
-
+	// ObservedGeneration is the .metadata.generation the status was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase of the last pre-warming run
+	Phase CacheBackupRequestPhase `json:"phase,omitempty"`
 	// Name of the PVC
 	PVCName string `json:"pvcName,omitempty"`
-
 	// Status of the PVC
+	// Deprecated: use phase and conditions, kept for the requests stored before they existed
 	Status string `json:"status,omitempty"`
-
 	// Timestamp for last transaction
+	// Deprecated: use lastSuccessfulTime, kept for the requests stored before it existed
 	LastTransactionTime string `json:"lastTransactionTime,omitempty"`
+	// Conditions describe the current state of the request
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// LastSuccessfulTime is when the index was last restored or found to be up to date
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// NextScheduledTime is when the next pre-warming run is due
+	NextScheduledTime *metav1.Time `json:"nextScheduledTime,omitempty"`
 
 	IndexRestoreDurationSeconds int `json:"indexRestoreDurationSeconds,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=cbr
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="PVC",type=string,JSONPath=`.status.pvcName`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessfulTime`
+//+kubebuilder:printcolumn:name="Next Run",type=date,JSONPath=`.status.nextScheduledTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // CacheBackupRequest is the Schema for the cachebackuprequests API
 type CacheBackupRequest struct {
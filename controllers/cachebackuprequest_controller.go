@@ -17,22 +17,28 @@ limitations under the License.
 package controllers
 
 import (
-	cachev1beta1 "bianchi2/dc-cache-backup-operator/api/v1beta1"
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"bianchi2/dc-cache-backup-operator/internal/schedule"
 	"context"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"strconv"
 	"time"
 )
 
-const dateFormatLayout = "2006-01-02 15:04:05 -0700"
-
 type TestSuite struct {
 	Test  bool
 	State string
@@ -44,11 +50,22 @@ type CacheBackupRequestReconciler struct {
 	Scheme    *runtime.Scheme
 	K8sClient kubernetes.Interface
 	Test      TestSuite
+	// Defaults fill omitted spec fields when the defaulting webhook is disabled
+	Defaults cachev1.SpecDefaults
+	// EmergencyStop halts pre-warming for all requests
+	EmergencyStop EmergencyStop
+	// PreWarmerImage is the operator image, run by pre-warmer pods with the built-in restore
+	PreWarmerImage string
 }
 
 //+kubebuilder:rbac:groups=cache.atlassian.com,resources=cachebackuprequests,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=cache.atlassian.com,resources=cachebackuprequests/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=cache.atlassian.com,resources=cachebackuprequests/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;create;delete
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;create;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -58,7 +75,7 @@ func (r *CacheBackupRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 
 	log := log.FromContext(ctx)
 
-	instance := &cachev1beta1.CacheBackupRequest{}
+	instance := &cachev1.CacheBackupRequest{}
 	err := r.Client.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -71,140 +88,343 @@ func (r *CacheBackupRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return reconcile.Result{}, err
 	}
 
-	if len(instance.Status.LastTransactionTime) > 0 {
-		runBackup, err := isBackupOutdated(instance)
-		if err != nil || !runBackup {
-			return ctrl.Result{RequeueAfter: 1 * time.Minute}, nil
+	// the release fills the spec of this reconciliation only, the stored spec is left as written
+	if instance.Spec.HelmReleaseRef != nil {
+		release, err := r.helmRelease(ctx, instance)
+		if targetErr, ok := err.(*targetError); ok {
+			return r.waitForTarget(ctx, req, instance, targetErr)
+		}
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		releaseStatus := applyHelmRelease(instance, release)
+		if !equality.Semantic.DeepEqual(releaseStatus, instance.Status.HelmRelease) {
+			log.Info("Inheriting " + instance.Name + " values from Helm release " + release.Name + " revision " + strconv.Itoa(release.Version))
+			crStatus := newStatus(instance)
+			crStatus.HelmRelease = releaseStatus
+			err := r.UpdateStatus(ctx, req, crStatus)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			instance.Status = *crStatus
+		}
+		r.Defaults.ApplyInstance(&instance.Spec)
+	}
+	r.Defaults.Apply(instance)
+
+	// the validating webhook rejects invalid specs, but it may be disabled or the
+	// object may have been created before it was installed
+	if validationErrs := instance.ValidateSpec(); len(validationErrs) > 0 {
+		message := validationErrs.ToAggregate().Error()
+		log.Info("Invalid spec. Waiting for " + instance.Name + " to be updated: " + message)
+		crStatus := newStatus(instance)
+		setDegraded(&crStatus.Conditions, crStatus.ObservedGeneration, cachev1.ReasonInvalidSpec, message)
+		return reconcile.Result{}, r.UpdateStatus(ctx, req, crStatus)
+	}
+
+	runSchedule, err := instance.Spec.RunSchedule()
+	if err != nil {
+		crStatus := newStatus(instance)
+		setDegraded(&crStatus.Conditions, crStatus.ObservedGeneration, cachev1.ReasonInvalidSpec, err.Error())
+		return reconcile.Result{}, r.UpdateStatus(ctx, req, crStatus)
+	}
+
+	// the ordinals are not pre-warmed while a PVC is recreated from a safety snapshot, which is done
+	// even if the request is suspended to keep the next run from pre-warming the PVC again
+	if restore := pendingSafetySnapshotRestore(instance); restore != nil {
+		targets, err := r.targets(ctx, instance)
+		if targetErr, ok := err.(*targetError); ok {
+			return r.waitForTarget(ctx, req, instance, targetErr)
+		}
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		return r.restoreSafetySnapshot(ctx, req, instance, targets, restore)
+	}
+
+	// suspended requests keep their status and PVC, and the pods already running are still observed and
+	// deleted once they succeed, but no new pre-warmer pods are created
+	reason, message, err := r.suspension(ctx, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if reason != "" {
+		crStatus := newStatus(instance)
+		setCondition(&crStatus.Conditions, crStatus.ObservedGeneration, cachev1.ConditionSuspended, metav1.ConditionTrue, reason, message)
+		if !equality.Semantic.DeepEqual(crStatus, &instance.Status) {
+			log.Info(message)
+			err := r.UpdateStatus(ctx, req, crStatus)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			instance.Status = *crStatus
+		}
+	} else if meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionSuspended) {
+		log.Info("Resuming pre-warming for " + instance.Name)
+		crStatus := newStatus(instance)
+		setCondition(&crStatus.Conditions, crStatus.ObservedGeneration, cachev1.ConditionSuspended, metav1.ConditionFalse, cachev1.ReasonAsExpected, "")
+		err := r.UpdateStatus(ctx, req, crStatus)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		instance.Status = *crStatus
+	}
+
+	targets, err := r.targets(ctx, instance)
+	if targetErr, ok := err.(*targetError); ok {
+		return r.waitForTarget(ctx, req, instance, targetErr)
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	run := &ordinalRun{
+		cr:           instance,
+		schedule:     runSchedule,
+		podSelector:  targets.podSelector,
+		statefulSet:  targets.statefulSet,
+		runRequested: pendingRunRequest(instance) != nil || pendingRollback(instance) != nil,
+		suspended:    reason != "",
+		now:          time.Now(),
+	}
+	crStatus := newStatus(instance)
+	crStatus.Ordinals = nil
+	var requeueAfter time.Duration
+	for _, target := range targets.ordinals {
+		ordinalStatus := newOrdinalStatus(instance, target)
+		ordinalRequeueAfter, err := r.reconcileOrdinal(ctx, run, target, ordinalStatus)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		crStatus.Ordinals = append(crStatus.Ordinals, *ordinalStatus)
+		if ordinalRequeueAfter > 0 && (requeueAfter == 0 || ordinalRequeueAfter < requeueAfter) {
+			requeueAfter = ordinalRequeueAfter
+		}
+	}
+	summarizeStatus(crStatus)
+
+	// a run requested while another one is in progress is started once it completes
+	if run.started {
+		if runRequest := pendingRunRequest(instance); runRequest != nil {
+			log.Info("Started pre-warming requested by " + runRequest.RequestedBy + " with token " + runRequest.Token)
+			runRequest.StartedAt = metav1.NewTime(run.now)
+			crStatus.LastRunRequest = runRequest
+		}
+		if rollback := pendingRollback(instance); rollback != nil {
+			log.Info("Started rollback to generation " + strconv.Itoa(int(rollback.Generation)) + " with token " + rollback.Token)
+			crStatus.LastRollback = &cachev1.RollbackStatus{Generation: rollback.Generation, Token: rollback.Token, StartedAt: metav1.NewTime(run.now)}
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(crStatus, &instance.Status) {
+		err := r.UpdateStatus(ctx, req, crStatus)
+		if err != nil {
+			return reconcile.Result{RequeueAfter: 1 * time.Second}, err
+		}
+	}
+
+	// we don't need a pod that has succeeded, so deleting it once its success is recorded
+	for _, pod := range run.succeededPods {
+		log.Info("Deleting pod " + pod.Name)
+		err := r.Client.Delete(ctx, pod)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: 1 * time.Second}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// waitForTarget records why the request cannot be reconciled until the cluster or the spec changes and checks back in 1 minute
+func (r *CacheBackupRequestReconciler) waitForTarget(ctx context.Context, req ctrl.Request, instance *cachev1.CacheBackupRequest, targetErr *targetError) (ctrl.Result, error) {
+	log.FromContext(ctx).Info(targetErr.message + ". Waiting 1 minute...")
+	crStatus := newStatus(instance)
+	crStatus.Phase = cachev1.PhaseWaiting
+	setDegraded(&crStatus.Conditions, crStatus.ObservedGeneration, targetErr.reason, targetErr.message)
+	if !equality.Semantic.DeepEqual(crStatus, &instance.Status) {
+		err := r.UpdateStatus(ctx, req, crStatus)
+		if err != nil {
+			return reconcile.Result{RequeueAfter: 1 * time.Minute}, nil
+		}
+	}
+	return reconcile.Result{RequeueAfter: 1 * time.Minute}, nil
+}
+
+// ordinalRun is the state shared by the ordinals of a request while it is reconciled
+type ordinalRun struct {
+	cr           *cachev1.CacheBackupRequest
+	schedule     *schedule.Schedule
+	podSelector  string
+	statefulSet  *appsv1.StatefulSet
+	runRequested bool
+	// suspended runs observe the pre-warmer pods already created but do not create any
+	suspended bool
+	now       time.Time
+	// started is true once a pre-warmer pod is created for a run requested on demand
+	started bool
+	// succeededPods are deleted once the status recording their success is saved
+	succeededPods []*corev1.Pod
+}
+
+// reconcileOrdinal moves the pre-warming of one ordinal forward and returns when it should be reconciled again,
+// zero meaning it does not need to be until the request changes
+func (r *CacheBackupRequestReconciler) reconcileOrdinal(ctx context.Context, run *ordinalRun, target ordinalTarget, ordinalStatus *cachev1.OrdinalStatus) (time.Duration, error) {
+	log := log.FromContext(ctx)
+	instance := run.cr
+	generation := instance.Generation
+	pvcName := target.pvcName
+
+	if run.suspended {
+		pod := &corev1.Pod{}
+		err := r.Client.Get(ctx, client.ObjectKey{Namespace: instance.Namespace, Name: preWarmerPodName(pvcName)}, pod)
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return r.observePreWarmerPod(ctx, run, target, ordinalStatus, pod)
+	}
+
+	// runs that are in progress or requested on demand are started regardless of the schedule
+	if !run.runRequested && ordinalStatus.Phase != cachev1.PhasePending && ordinalStatus.Phase != cachev1.PhaseRunning {
+		next := nextRunTime(ordinalStatus, run.schedule, run.now)
+		if next.IsZero() || next.After(run.now) {
+			ordinalStatus.NextScheduledTime = scheduledTime(next)
+			return requeueAfter(next, run.now), nil
 		}
 	}
 
 	// check if pvc exists and is available
-	pvcName := "local-home-" + instance.Spec.InstanceName + "-" + strconv.Itoa(instance.Spec.StatefulSetNumber)
-	exists, free, err := IsPVCExistsAndFree(instance, pvcName, r.K8sClient)
+	exists, free, err := IsPVCExistsAndFree(instance.Namespace, pvcName, run.podSelector, r.K8sClient)
 
 	// create PVC if missing
 	if !exists {
-		if instance.Spec.CreatePVC {
-			log.Info("PVC " + pvcName + " does not exist. Creating it because .spec.createPVC is " + strconv.FormatBool(instance.Spec.CreatePVC))
-			pvc := GetNewPVC(instance, pvcName)
+		if instance.Spec.PVC.Create {
+			log.Info("PVC " + pvcName + " does not exist. Creating it because .spec.createPVC is " + strconv.FormatBool(instance.Spec.PVC.Create))
+			pvc, err := GetNewPVC(instance, pvcName, target.claimTemplate)
+			if err != nil {
+				setDegraded(&ordinalStatus.Conditions, generation, cachev1.ReasonInvalidSpec, err.Error())
+				return 0, nil
+			}
 			err = r.Client.Create(ctx, pvc)
 			if err != nil && !errors.IsAlreadyExists(err) {
-				return reconcile.Result{RequeueAfter: 1 * time.Minute}, err
+				return 0, err
 			}
 		} else {
 			log.Error(err, "PVC does not exist")
-			crStatus := &cachev1beta1.CacheBackupRequestStatus{
-				PVCName:                     pvcName,
-				Status:                      "PVCDoesNotExist",
-				LastTransactionTime:         time.Now().Format(dateFormatLayout),
-				IndexRestoreDurationSeconds: 0,
-			}
-			err := r.UpdateStatus(ctx, req, crStatus)
-			if err != nil {
-				return reconcile.Result{RequeueAfter: 1 * time.Minute}, nil
-			}
-			return reconcile.Result{RequeueAfter: 1 * time.Minute}, nil
+			ordinalStatus.Phase = cachev1.PhaseWaiting
+			message := "PVC " + pvcName + " does not exist and .spec.createPVC is false"
+			setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionPVCAvailable, metav1.ConditionFalse, cachev1.ReasonPVCNotFound, message)
+			setDegraded(&ordinalStatus.Conditions, generation, cachev1.ReasonPVCNotFound, message)
+			return 1 * time.Minute, nil
 		}
 	}
 
 	if !free {
 		// this isn't really a reconciliation error but rather one of the expected scenarios
 		// so we requeue and try again later
-		if instance.Status.Status == string(corev1.PodRunning) || instance.Status.Status == string(corev1.PodPending) {
+		if ordinalStatus.Phase == cachev1.PhaseRunning || ordinalStatus.Phase == cachev1.PhasePending {
 		} else {
 			log.Info("PVC " + pvcName + " is bound to PV that is currently used by a running pod. Waiting 1 minute...")
-			return reconcile.Result{RequeueAfter: 1 * time.Minute}, nil
+			setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionPVCAvailable, metav1.ConditionFalse, cachev1.ReasonPVCInUse, err.Error())
+			return 1 * time.Minute, nil
+		}
+	}
 
+	// a PVC that was just created has nothing to lose
+	if instance.Spec.SafetySnapshot != nil && exists {
+		ready, retryAfter, err := r.takeSafetySnapshot(ctx, run, pvcName, ordinalStatus)
+		if err != nil || !ready {
+			return retryAfter, err
 		}
 	}
 
-	pod := GetNewPreWarmerPod(instance, pvcName)
+	pod, err := GetNewPreWarmerPod(instance, pvcName, run.statefulSet, r.PreWarmerImage)
+	if err != nil {
+		setDegraded(&ordinalStatus.Conditions, generation, cachev1.ReasonInvalidSpec, err.Error())
+		return 0, nil
+	}
+	// the owner reference makes pod status changes trigger a reconcile instead of waiting for them here
+	if err := controllerutil.SetControllerReference(instance, pod, r.Scheme); err != nil {
+		return 0, err
+	}
 	err = r.Client.Create(ctx, pod)
 	if err != nil && !errors.IsAlreadyExists(err) {
-		return reconcile.Result{}, err
+		return 0, err
+	}
+	if err == nil && run.runRequested {
+		run.started = true
 	}
 
-	// create a channel for receiving pod status updates
-	statusChan := make(chan string)
+	runtimePod := r.GetRuntimePreWarmerPod(pod)
+	if runtimePod == nil {
+		// the cache has not seen the pod that was just created yet
+		return 5 * time.Second, nil
+	}
+	return r.observePreWarmerPod(ctx, run, target, ordinalStatus, runtimePod)
+}
 
-	go func() {
-		status, err := WatchPodStatus(pod.Name, pod.Namespace, r.K8sClient, r.Test.State)
-		if err != nil {
-			log.Error(err, "Error watching pod status")
-			return
-		}
-		statusChan <- status
-	}()
-
-	select {
-	case status := <-statusChan:
-		_ = r.Client.Get(ctx, req.NamespacedName, instance)
-
-		// skip updating the same status
-		if status != instance.Status.Status {
-			log.Info("Pod " + pod.Name + " status changed to " + status)
-			log.Info("Updating " + instance.Name + " status from " + instance.Status.Status + " to " + status)
-
-			currentTime := time.Now()
-			indexRestoreDuration := 0
-			crStatus := &cachev1beta1.CacheBackupRequestStatus{
-				PVCName:                     pvcName,
-				Status:                      status,
-				LastTransactionTime:         currentTime.Format(dateFormatLayout),
-				IndexRestoreDurationSeconds: indexRestoreDuration,
-			}
+// observePreWarmerPod records the status of the pre-warmer pod of an ordinal and returns when it should be checked again
+func (r *CacheBackupRequestReconciler) observePreWarmerPod(ctx context.Context, run *ordinalRun, target ordinalTarget, ordinalStatus *cachev1.OrdinalStatus, pod *corev1.Pod) (time.Duration, error) {
+	log := log.FromContext(ctx)
+	instance := run.cr
+	generation := instance.Generation
 
-			// update custom resource status
-			err := r.UpdateStatus(ctx, req, crStatus)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
+	status := PreWarmerPodStatus(pod, r.Test.State)
+	if status == "" {
+		// the pod has no status yet, its first status update triggers a reconcile
+		return podStatusRequeueInterval, nil
+	}
+	phase := cachev1.CacheBackupRequestPhase(status)
+
+	// keeping failed pods will result in no more pre-warmer pods being created
+	// until the faulty pod is manually deleted (after examining logs)
+	if status == string(corev1.PodSucceeded) {
+		indexRestoreDuration := int(run.now.Sub(pod.ObjectMeta.CreationTimestamp.Time).Seconds())
+		message := "Index restored from shared home"
+
+		// the built-in restore reports whether it restored the index, a restore script does not
+		result := restoreResult(pod)
+		if result != nil && result.Outcome != cachev1.RestoreOutcomeFailed {
+			phase = cachev1.CacheBackupRequestPhase(result.Outcome)
+			message = result.Reason
 		}
+		log.Info("Updating " + instance.Name + " ordinal " + strconv.Itoa(int(target.ordinal)) + " phase from " + string(ordinalStatus.Phase) + " to " + string(phase))
+
+		next := run.schedule.Next(run.now)
+		ordinalStatus.IndexRestoreDurationSeconds = indexRestoreDuration
+		ordinalStatus.LastRestore = result
+		setSignatureCondition(ordinalStatus, generation, result)
+		setIndexCondition(ordinalStatus, generation, result)
+		setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionPVCAvailable, metav1.ConditionTrue, cachev1.ReasonPVCFound, "")
+		setSucceeded(ordinalStatus, generation, phase, message, run.now, next)
+		run.succeededPods = append(run.succeededPods, pod)
+		return requeueAfter(next, run.now), nil
+	}
 
-		// we don't need a pod that has succeeded, so deleting it
-		// keeping failed pods will result in no more pre-warmer pods being created
-		// until the faulty pod is manually deleted (after examining logs)
-		if status == string(corev1.PodSucceeded) {
-			pod := r.GetRuntimePreWarmerPod(pod)
-			indexRestoreDuration := int(time.Since(pod.ObjectMeta.CreationTimestamp.Time).Seconds())
-
-			// set Skipped status if index restore script skipped unzipping archives because the
-			// current local home index is more recent than what's in shared-home/index-snapshots
-			if indexRestoreDuration < 30 {
-				status = "Skipped"
-			}
-			currentTime := time.Now()
-			// update custom resource status
-			crStatus := &cachev1beta1.CacheBackupRequestStatus{
-				PVCName:                     pvcName,
-				Status:                      status,
-				LastTransactionTime:         currentTime.Format(dateFormatLayout),
-				IndexRestoreDurationSeconds: indexRestoreDuration,
-			}
-
-			err := r.UpdateStatus(ctx, req, crStatus)
-			if err != nil {
-				return reconcile.Result{RequeueAfter: 1 * time.Second}, err
-			}
-
-			log.Info("Deleting pod " + pod.Name)
-			err = r.Client.Delete(ctx, pod)
-			if err != nil {
-				return ctrl.Result{RequeueAfter: 1 * time.Second}, err
+	// skip updating the same status
+	if phase != ordinalStatus.Phase {
+		log.Info("Pod " + pod.Name + " status changed to " + status)
+		log.Info("Updating " + instance.Name + " ordinal " + strconv.Itoa(int(target.ordinal)) + " phase from " + string(ordinalStatus.Phase) + " to " + string(phase))
+
+		message := "Pod " + pod.Name + " is " + status
+		if phase == cachev1.PhaseFailed {
+			message = "Pod " + pod.Name + " has failed. Examine its logs and delete it to resume pre-warming"
+			if result := restoreResult(pod); result != nil {
+				message = "Pod " + pod.Name + " has failed: " + result.Reason + ". Examine its logs and delete it to resume pre-warming"
+				ordinalStatus.LastRestore = result
+				setSignatureCondition(ordinalStatus, generation, result)
+				setIndexCondition(ordinalStatus, generation, result)
 			}
-			return ctrl.Result{RequeueAfter: time.Duration(instance.Spec.BackupIntervalMinutes) * time.Minute}, nil
 		}
-
-	// this shouldn't happen - a pod should have at least some status
-	// unless pod creation ended with failure
-	case <-time.After(5 * time.Minute):
-		log.Info("Timed out waiting for pod status")
+		setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionPVCAvailable, metav1.ConditionTrue, cachev1.ReasonPVCFound, "")
+		setPhase(ordinalStatus, generation, phase, message)
 	}
-	return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	return podStatusRequeueInterval, nil
 }
 
-func (r *CacheBackupRequestReconciler) UpdateStatus(ctx context.Context, req ctrl.Request, status *cachev1beta1.CacheBackupRequestStatus) (err error) {
-	instance := &cachev1beta1.CacheBackupRequest{}
+func (r *CacheBackupRequestReconciler) UpdateStatus(ctx context.Context, req ctrl.Request, status *cachev1.CacheBackupRequestStatus) (err error) {
+	instance := &cachev1.CacheBackupRequest{}
 
 	var updateErr error
 	for i := 0; i < 5; i++ {
@@ -222,26 +442,69 @@ func (r *CacheBackupRequestReconciler) UpdateStatus(ctx context.Context, req ctr
 	return updateErr
 }
 
-func isBackupOutdated(cr *cachev1beta1.CacheBackupRequest) (outdated bool, err error) {
+// isBackupOutdated returns true if the last run of an ordinal did not complete successfully
+func isBackupOutdated(status *cachev1.OrdinalStatus) bool {
+	switch status.Phase {
+	case cachev1.PhaseSucceeded, cachev1.PhaseRestored, cachev1.PhasePartiallyRestored, cachev1.PhaseRolledBack, cachev1.PhaseSkipped:
+		return status.LastSuccessfulTime == nil
+	}
+	return true
+}
 
-	layout := dateFormatLayout
-	lastTransactionTimeStr := cr.Status.LastTransactionTime
-	lastTransactionTime, err := time.Parse(layout, lastTransactionTimeStr)
-	if err != nil {
-		return false, err
+// nextRunTime returns when the next pre-warming run of an ordinal is due, an outdated backup is due as soon as the
+// maintenance and blackout windows allow it. The zero time means no run can ever start.
+func nextRunTime(status *cachev1.OrdinalStatus, runSchedule *schedule.Schedule, now time.Time) time.Time {
+	if isBackupOutdated(status) {
+		return runSchedule.NextAllowed(now)
 	}
-	interval := time.Duration(cr.Spec.BackupIntervalMinutes) * time.Minute
-	currentTime := time.Now()
+	return runSchedule.Next(status.LastSuccessfulTime.Time)
+}
 
-	if (cr.Status.Status == "Succeeded" || cr.Status.Status == "Skipped") && currentTime.Sub(lastTransactionTime) < (interval) {
-		return false, nil
+// pendingRunRequest returns the run requested with the run-now annotation if it has not been started yet
+func pendingRunRequest(cr *cachev1.CacheBackupRequest) *cachev1.RunRequest {
+	token := cr.Annotations[cachev1.RunNowAnnotation]
+	if token == "" || (cr.Status.LastRunRequest != nil && cr.Status.LastRunRequest.Token == token) {
+		return nil
+	}
+	runRequest := &cachev1.RunRequest{
+		Token:       token,
+		RequestedBy: cr.Annotations[cachev1.RunNowRequestedByAnnotation],
 	}
-	return true, nil
+	if requestedAt, err := time.Parse(time.RFC3339, cr.Annotations[cachev1.RunNowRequestedAtAnnotation]); err == nil {
+		runRequestedAt := metav1.NewTime(requestedAt)
+		runRequest.RequestedAt = &runRequestedAt
+	}
+	return runRequest
+}
+
+// pendingRollback returns the rollback requested with spec.rollbackTo if it has not been started yet
+func pendingRollback(cr *cachev1.CacheBackupRequest) *cachev1.RollbackRequest {
+	rollback := cr.Spec.RollbackTo
+	if rollback == nil || (cr.Status.LastRollback != nil && cr.Status.LastRollback.Token == rollback.Token) {
+		return nil
+	}
+	return rollback
+}
+
+// requeueAfter returns how long to wait for the next run, checking back every hour
+// so that the windows and a changing time zone offset are picked up
+func requeueAfter(next, now time.Time) time.Duration {
+	if next.IsZero() || next.Sub(now) > time.Hour {
+		return time.Hour
+	}
+	if next.Sub(now) < time.Second {
+		return time.Second
+	}
+	return next.Sub(now)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CacheBackupRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&cachev1beta1.CacheBackupRequest{}).
-		Complete(r)
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1.CacheBackupRequest{}).
+		Owns(&corev1.Pod{})
+	if r.EmergencyStop.ConfigMap.Name != "" {
+		builder = builder.Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForEmergencyStop))
+	}
+	return builder.Complete(r)
 }
@@ -1,6 +1,9 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -22,3 +25,23 @@ func NewKubeClient() *kubernetes.Clientset {
 
 	return clientset
 }
+
+// OperatorImage returns the image of the operator container, the container of the operator pod running the manager
+func OperatorImage(ctx context.Context, clientset kubernetes.Interface, namespace, podName string) (string, error) {
+	if namespace == "" || podName == "" {
+		return "", errors.New("POD_NAMESPACE and POD_NAME are not set")
+	}
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, container := range pod.Spec.Containers {
+		if len(container.Command) > 0 && container.Command[0] == "/manager" {
+			return container.Image, nil
+		}
+	}
+	if len(pod.Spec.Containers) == 1 {
+		return pod.Spec.Containers[0].Image, nil
+	}
+	return "", errors.New("pod " + podName + " has no container running /manager")
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"context"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
+	"time"
+)
+
+// ClusterCacheBackupPolicyReconciler reconciles a ClusterCacheBackupPolicy object
+type ClusterCacheBackupPolicyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=cache.atlassian.com,resources=clustercachebackuppolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cache.atlassian.com,resources=clustercachebackuppolicies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cache.atlassian.com,resources=clustercachebackuppolicies/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+
+// Reconcile creates, updates and deletes the CacheBackupRequests owned by a policy
+// so that there is exactly one for every selected StatefulSet
+func (r *ClusterCacheBackupPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	policy := &cachev1.ClusterCacheBackupPolicy{}
+	err := r.Client.Get(ctx, req.NamespacedName, policy)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// owned requests are garbage collected
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	policyStatus := policy.Status.DeepCopy()
+	policyStatus.ObservedGeneration = policy.Generation
+
+	statefulSets, err := r.selectedStatefulSets(ctx, policy)
+	if _, ok := err.(*targetError); ok {
+		log.Info("Invalid policy " + policy.Name + ": " + err.Error())
+		setCondition(&policyStatus.Conditions, policy.Generation, cachev1.ConditionReady, metav1.ConditionFalse, cachev1.ReasonInvalidSpec, err.Error())
+		return reconcile.Result{}, r.updatePolicyStatus(ctx, policy, policyStatus)
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	existing := &cachev1.CacheBackupRequestList{}
+	err = r.Client.List(ctx, existing, client.MatchingLabels{cachev1.PolicyLabel: policy.Name})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	owned := map[types.NamespacedName]*cachev1.CacheBackupRequest{}
+	for i := range existing.Items {
+		if metav1.IsControlledBy(&existing.Items[i], policy) {
+			owned[client.ObjectKeyFromObject(&existing.Items[i])] = &existing.Items[i]
+		}
+	}
+
+	var problems []string
+	problemReason := ""
+	requests := int32(0)
+	for _, sts := range statefulSets {
+		desired := r.newPolicyRequest(policy, sts)
+		key := client.ObjectKeyFromObject(desired)
+		current, ok := owned[key]
+		delete(owned, key)
+
+		if !ok {
+			err := controllerutil.SetControllerReference(policy, desired, r.Scheme)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			log.Info("Creating CacheBackupRequest " + key.String() + " for StatefulSet " + sts.Name)
+			err = r.Client.Create(ctx, desired)
+			if errors.IsAlreadyExists(err) {
+				problems = append(problems, "CacheBackupRequest "+key.String()+" exists and is not owned by the policy")
+				problemReason = cachev1.ReasonRequestConflict
+				continue
+			}
+			if errors.IsInvalid(err) {
+				problems = append(problems, err.Error())
+				problemReason = cachev1.ReasonInvalidSpec
+				continue
+			}
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			requests++
+			continue
+		}
+
+		requests++
+		if !policyRequestChanged(current, desired) {
+			continue
+		}
+		log.Info("Updating CacheBackupRequest " + key.String() + " from policy " + policy.Name)
+		current.Spec = desired.Spec
+		if current.Labels == nil {
+			current.Labels = map[string]string{}
+		}
+		for k, v := range desired.Labels {
+			current.Labels[k] = v
+		}
+		if len(desired.Annotations) > 0 && current.Annotations == nil {
+			current.Annotations = map[string]string{}
+		}
+		for k, v := range desired.Annotations {
+			current.Annotations[k] = v
+		}
+		err := r.Client.Update(ctx, current)
+		if errors.IsInvalid(err) {
+			problems = append(problems, err.Error())
+			problemReason = cachev1.ReasonInvalidSpec
+			continue
+		}
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// requests for StatefulSets that are gone or no longer selected
+	for key, request := range owned {
+		log.Info("Deleting CacheBackupRequest " + key.String() + " no longer selected by policy " + policy.Name)
+		err := r.Client.Delete(ctx, request)
+		if err != nil && !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+	}
+
+	policyStatus.Requests = requests
+	if len(problems) > 0 {
+		setCondition(&policyStatus.Conditions, policy.Generation, cachev1.ConditionReady, metav1.ConditionFalse, problemReason, strings.Join(problems, "; "))
+	} else {
+		setCondition(&policyStatus.Conditions, policy.Generation, cachev1.ConditionReady, metav1.ConditionTrue, cachev1.ReasonAsExpected, "")
+	}
+	err = r.updatePolicyStatus(ctx, policy, policyStatus)
+	if err != nil {
+		return reconcile.Result{RequeueAfter: 1 * time.Second}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// selectedStatefulSets returns the StatefulSets a policy creates requests for, read from the cache
+func (r *ClusterCacheBackupPolicyReconciler) selectedStatefulSets(ctx context.Context, policy *cachev1.ClusterCacheBackupPolicy) ([]*appsv1.StatefulSet, error) {
+	stsSelector, err := metav1.LabelSelectorAsSelector(&policy.Spec.StatefulSetSelector)
+	if err != nil {
+		return nil, &targetError{reason: cachev1.ReasonInvalidSpec, message: "invalid statefulSetSelector: " + err.Error()}
+	}
+
+	namespaces := []string{metav1.NamespaceAll}
+	if policy.Spec.NamespaceSelector != nil {
+		nsSelector, err := metav1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, &targetError{reason: cachev1.ReasonInvalidSpec, message: "invalid namespaceSelector: " + err.Error()}
+		}
+		namespaceList := &corev1.NamespaceList{}
+		err = r.Client.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: nsSelector})
+		if err != nil {
+			return nil, err
+		}
+		namespaces = namespaces[:0]
+		for _, namespace := range namespaceList.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	var statefulSets []*appsv1.StatefulSet
+	for _, namespace := range namespaces {
+		stsList := &appsv1.StatefulSetList{}
+		err := r.Client.List(ctx, stsList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: stsSelector})
+		if err != nil {
+			return nil, err
+		}
+		for i := range stsList.Items {
+			statefulSets = append(statefulSets, &stsList.Items[i])
+		}
+	}
+	return statefulSets, nil
+}
+
+// newPolicyRequest returns the request a policy creates for a StatefulSet, with the defaults the defaulting
+// webhook stores, the others are applied when the request is reconciled. Names longer than the 253 characters
+// of an object name are truncated and suffixed with a hash
+func (r *ClusterCacheBackupPolicyReconciler) newPolicyRequest(policy *cachev1.ClusterCacheBackupPolicy, sts *appsv1.StatefulSet) *cachev1.CacheBackupRequest {
+	template := policy.Spec.Template.DeepCopy()
+	labels := template.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[cachev1.PolicyLabel] = policy.Name
+
+	request := &cachev1.CacheBackupRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        truncateName(policy.Name+"-"+sts.Name, validation.DNS1123SubdomainMaxLength),
+			Namespace:   sts.Namespace,
+			Labels:      labels,
+			Annotations: template.Annotations,
+		},
+		Spec: template.Spec,
+	}
+	if request.Spec.StatefulSetRef == nil {
+		request.Spec.StatefulSetRef = &cachev1.StatefulSetRef{}
+	}
+	request.Spec.StatefulSetRef.Name = sts.Name
+	cachev1.ApplyPlain(&request.Spec)
+	return request
+}
+
+// policyRequestChanged returns true if an owned request differs from what the policy would create,
+// labels and annotations not set by the policy are left alone
+func policyRequestChanged(current, desired *cachev1.CacheBackupRequest) bool {
+	if !equality.Semantic.DeepEqual(current.Spec, desired.Spec) {
+		return true
+	}
+	for k, v := range desired.Labels {
+		if current.Labels[k] != v {
+			return true
+		}
+	}
+	for k, v := range desired.Annotations {
+		if current.Annotations[k] != v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ClusterCacheBackupPolicyReconciler) updatePolicyStatus(ctx context.Context, policy *cachev1.ClusterCacheBackupPolicy, status *cachev1.ClusterCacheBackupPolicyStatus) error {
+	if equality.Semantic.DeepEqual(status, &policy.Status) {
+		return nil
+	}
+	policy.Status = *status
+	return r.Client.Status().Update(ctx, policy)
+}
+
+// requestsForPolicies enqueues every policy, a StatefulSet or namespace change may add or remove requests of any of them
+func (r *ClusterCacheBackupPolicyReconciler) requestsForPolicies(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	policies := &cachev1.ClusterCacheBackupPolicyList{}
+	if err := r.Client.List(ctx, policies); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to list ClusterCacheBackupPolicies after a StatefulSet or namespace change")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(policies.Items))
+	for _, policy := range policies.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: policy.Name}})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager. Policy status updates are ignored, and StatefulSets
+// and namespaces only matter when they are created, deleted or relabelled as that is all selection depends on
+func (r *ClusterCacheBackupPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&cachev1.ClusterCacheBackupPolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&cachev1.CacheBackupRequest{}).
+		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForPolicies), builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForPolicies), builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Complete(r)
+}
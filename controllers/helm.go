@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"bianchi2/dc-cache-backup-operator/internal/helm"
+	"context"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// helmRelease returns the release referenced by spec.helmReleaseRef, the latest deployed revision
+// or else the latest revision if none is deployed, e.g. while an upgrade is pending
+func (r *CacheBackupRequestReconciler) helmRelease(ctx context.Context, cr *cachev1.CacheBackupRequest) (*helm.Release, error) {
+	name := cr.Spec.HelmReleaseRef.Name
+	secrets, err := r.K8sClient.CoreV1().Secrets(cr.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"owner": "helm", "name": name}).String(),
+		FieldSelector: fields.OneTermEqualSelector("type", helm.SecretType).String(),
+	})
+	if errors.IsForbidden(err) {
+		return nil, &targetError{
+			reason:  cachev1.ReasonHelmReleaseForbidden,
+			message: "Secrets storing Helm release " + name + " cannot be listed, bind the Role of config/rbac/helm_release_reader_role.yaml in namespace " + cr.Namespace,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var latest, deployed *helm.Release
+	for _, secret := range secrets.Items {
+		if string(secret.Type) != helm.SecretType {
+			continue
+		}
+		release, err := helm.Decode(secret.Data[helm.SecretDataKey])
+		if err != nil {
+			return nil, &targetError{
+				reason:  cachev1.ReasonInvalidSpec,
+				message: "Helm release " + name + " stored in Secret " + secret.Name + " cannot be read: " + err.Error(),
+			}
+		}
+		if latest == nil || release.Version > latest.Version {
+			latest = release
+		}
+		if release.Info.Status == "deployed" && (deployed == nil || release.Version > deployed.Version) {
+			deployed = release
+		}
+	}
+	if deployed != nil {
+		return deployed, nil
+	}
+	if latest == nil {
+		return nil, &targetError{reason: cachev1.ReasonHelmReleaseNotFound, message: "Helm release " + name + " does not exist"}
+	}
+	return latest, nil
+}
+
+// applyHelmRelease fills the omitted spec fields of a request from the values of an Atlassian Helm chart release
+// and returns what was inherited. Fields set in the request are never changed
+func applyHelmRelease(cr *cachev1.CacheBackupRequest, release *helm.Release) *cachev1.HelmReleaseStatus {
+	spec := &cr.Spec
+	status := &cachev1.HelmReleaseStatus{
+		Name:     release.Name,
+		Revision: release.Version,
+		Chart:    release.Chart.Metadata.Name + "-" + release.Chart.Metadata.Version,
+	}
+	inherit := func(field string, value string, set *string) {
+		if *set == "" && value != "" {
+			*set = value
+			status.Inherited = append(status.Inherited, field)
+		}
+	}
+
+	// the Atlassian charts are named after the product
+	if product := cachev1.Product(release.Chart.Metadata.Name); product.Known() {
+		inherit("spec.product", string(product), (*string)(&spec.Product))
+	}
+
+	// the charts name the StatefulSet and the shared home PVC they create after the release
+	fullname := release.Fullname()
+	if spec.Target.InstanceName == "" && spec.StatefulSetRef == nil {
+		spec.StatefulSetRef = &cachev1.StatefulSetRef{}
+	}
+	if spec.StatefulSetRef != nil {
+		inherit("spec.statefulSetRef.name", fullname, &spec.StatefulSetRef.Name)
+	}
+	inherit("spec.localHomePath", release.String("volumes.localHome.mountPath"), &spec.LocalHomePath)
+	inherit("spec.sharedHomePath", release.String("volumes.sharedHome.mountPath"), &spec.SharedHomePath)
+	sharedHomePVCName := release.String("volumes.sharedHome.customVolume.persistentVolumeClaim.claimName")
+	if release.Bool("volumes.sharedHome.persistentVolumeClaim.create") {
+		sharedHomePVCName = fullname + "-shared-home"
+	}
+	inherit("spec.sharedHomePVCName", sharedHomePVCName, &spec.SharedHomePVCName)
+
+	// the product image only runs the restore script, the built-in restore needs the operator image
+	if repository := release.String("image.repository"); repository != "" && spec.ConfigMapName != "" {
+		tag := release.String("image.tag")
+		if tag == "" {
+			tag = release.Chart.Metadata.AppVersion
+		}
+		image := repository
+		if tag != "" {
+			image += ":" + tag
+		}
+		inherit("spec.podTemplate.image", image, &spec.PodTemplate.Image)
+	}
+	return status
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"path"
+)
+
+// inheritHomePaths replaces the home paths of a request with the SHARED_HOME and LOCAL_HOME
+// env of the StatefulSet application container, when it sets them
+func inheritHomePaths(spec *cachev1.CacheBackupRequestSpec, sts *appsv1.StatefulSet) {
+	container := applicationContainer(sts)
+	if container == nil {
+		return
+	}
+	for _, env := range container.Env {
+		if env.Value == "" {
+			continue
+		}
+		switch env.Name {
+		case "SHARED_HOME":
+			spec.SharedHomePath = env.Value
+		case "LOCAL_HOME":
+			spec.LocalHomePath = env.Value
+		}
+	}
+}
+
+// inheritFromStatefulSet makes the pre-warmer pod run like the StatefulSet application container: same image
+// and pull policy when the restore script is used, user and pull secrets, on the same nodes, with the same shared
+// home volume and the same sub paths of both homes. Pod affinity and topology spread constraints are not inherited, they place the application pods
+// relative to each other. The image and scheduling constraints set in the request pod template are kept
+func inheritFromStatefulSet(pod *corev1.Pod, cr *cachev1.CacheBackupRequest, sts *appsv1.StatefulSet) {
+	app := applicationContainer(sts)
+	if app == nil {
+		return
+	}
+	template := sts.Spec.Template.Spec
+	container := &pod.Spec.Containers[0]
+
+	// the product image has no built-in restore, it only runs the script of spec.configMapName. The pull policy
+	// of the product image does not apply to the operator image
+	if cr.Spec.PodTemplate.Image == "" && cr.Spec.ConfigMapName != "" {
+		container.Image = app.Image
+		container.ImagePullPolicy = app.ImagePullPolicy
+	}
+	inheritPodSecurityContext(pod.Spec.SecurityContext, template.SecurityContext)
+	inheritContainerSecurityContext(container.SecurityContext, app.SecurityContext)
+	pod.Spec.ImagePullSecrets = append([]corev1.LocalObjectReference(nil), template.ImagePullSecrets...)
+
+	for _, volumeMount := range app.VolumeMounts {
+		switch path.Clean(volumeMount.MountPath) {
+		case path.Clean(cr.Spec.SharedHomePath):
+			// the shared home volume may be a PVC with another name, or not a PVC at all
+			for _, volume := range template.Volumes {
+				if volume.Name == volumeMount.Name {
+					setVolumeSource(pod, "shared-home", volume.VolumeSource)
+					setSubPath(container, "shared-home", volumeMount.SubPath)
+				}
+			}
+		case path.Clean(cr.Spec.LocalHomePath):
+			// the local home volume stays the PVC of the ordinal
+			setSubPath(container, "local-home", volumeMount.SubPath)
+		}
+	}
+
+	if len(cr.Spec.PodTemplate.NodeSelector) == 0 {
+		pod.Spec.NodeSelector = template.NodeSelector
+	}
+	if len(cr.Spec.PodTemplate.Tolerations) == 0 {
+		pod.Spec.Tolerations = template.Tolerations
+	}
+	if cr.Spec.PodTemplate.Affinity == nil && template.Affinity != nil && template.Affinity.NodeAffinity != nil {
+		pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: template.Affinity.NodeAffinity.DeepCopy()}
+	}
+}
+
+// setVolumeSource replaces the source of a pre-warmer pod volume
+func setVolumeSource(pod *corev1.Pod, name string, source corev1.VolumeSource) {
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == name {
+			pod.Spec.Volumes[i].VolumeSource = *source.DeepCopy()
+		}
+	}
+}
+
+// setSubPath sets the sub path of a pre-warmer container volume mount
+func setSubPath(container *corev1.Container, name, subPath string) {
+	for i := range container.VolumeMounts {
+		if container.VolumeMounts[i].Name == name {
+			container.VolumeMounts[i].SubPath = subPath
+		}
+	}
+}
+
+// inheritPodSecurityContext sets the user and groups the StatefulSet pod sets over the restricted defaults of the
+// pre-warmer pod. Fields the restricted Pod Security Standard constrains are only inherited when they comply with
+// it: root is never inherited, nor an unconfined seccomp profile. SELinux options are not inherited, the standard
+// rejects custom SELinux types
+func inheritPodSecurityContext(restricted *corev1.PodSecurityContext, sts *corev1.PodSecurityContext) {
+	if sts == nil {
+		return
+	}
+	if sts.RunAsUser != nil && *sts.RunAsUser != 0 {
+		restricted.RunAsUser = sts.RunAsUser
+	}
+	if sts.RunAsGroup != nil {
+		restricted.RunAsGroup = sts.RunAsGroup
+	}
+	if sts.FSGroup != nil {
+		restricted.FSGroup = sts.FSGroup
+	}
+	if sts.FSGroupChangePolicy != nil {
+		restricted.FSGroupChangePolicy = sts.FSGroupChangePolicy
+	}
+	if len(sts.SupplementalGroups) > 0 {
+		restricted.SupplementalGroups = sts.SupplementalGroups
+	}
+	if sts.SeccompProfile != nil && sts.SeccompProfile.Type != corev1.SeccompProfileTypeUnconfined {
+		restricted.SeccompProfile = sts.SeccompProfile
+	}
+}
+
+// inheritContainerSecurityContext sets the user and group the StatefulSet application container sets over the
+// restricted defaults of the pre-warmer container. Privileges, capabilities and SELinux options are never inherited
+func inheritContainerSecurityContext(restricted *corev1.SecurityContext, sts *corev1.SecurityContext) {
+	if sts == nil {
+		return
+	}
+	if sts.RunAsUser != nil && *sts.RunAsUser != 0 {
+		restricted.RunAsUser = sts.RunAsUser
+	}
+	if sts.RunAsGroup != nil {
+		restricted.RunAsGroup = sts.RunAsGroup
+	}
+	if sts.SeccompProfile != nil && sts.SeccompProfile.Type != corev1.SeccompProfileTypeUnconfined {
+		restricted.SeccompProfile = sts.SeccompProfile
+	}
+}
+
+// applicationContainer returns the first container of the StatefulSet pod template, the application
+// container in the Atlassian Helm charts
+func applicationContainer(sts *appsv1.StatefulSet) *corev1.Container {
+	if len(sts.Spec.Template.Spec.Containers) == 0 {
+		return nil
+	}
+	return &sts.Spec.Template.Spec.Containers[0]
+}
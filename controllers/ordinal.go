@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"context"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// ordinalTarget is a StatefulSet pod whose local home PVC is pre-warmed
+type ordinalTarget struct {
+	ordinal int32
+	pvcName string
+	// claimTemplate is the volumeClaimTemplate the PVC is created from, if the StatefulSet has one
+	claimTemplate *corev1.PersistentVolumeClaim
+}
+
+// targetSet is the set of ordinals pre-warmed by a request
+type targetSet struct {
+	ordinals []ordinalTarget
+	// podSelector selects the pods that may be using the local home PVCs
+	podSelector string
+	// statefulSet the ordinals belong to, nil if there is none named after target.instanceName
+	statefulSet *appsv1.StatefulSet
+}
+
+// targetError explains why the ordinals of a request cannot be determined until the cluster or the spec changes
+type targetError struct {
+	reason  string
+	message string
+}
+
+func (e *targetError) Error() string {
+	return e.message
+}
+
+// targets returns the ordinals pre-warmed by a request, either target.ordinal or the
+// ordinals of the StatefulSet referenced by statefulSetRef. With spec.inheritFromStatefulSet
+// the home paths of the request are replaced by those of the StatefulSet
+func (r *CacheBackupRequestReconciler) targets(ctx context.Context, cr *cachev1.CacheBackupRequest) (*targetSet, error) {
+	if cr.Spec.StatefulSetRef == nil {
+		// the Atlassian Helm charts name the StatefulSet after the release, its claim template
+		// gives the PVC name unless the chart is not used
+		var sts *appsv1.StatefulSet
+		var claimTemplate *corev1.PersistentVolumeClaim
+		if cr.Spec.PVCNameTemplate == "" || cr.Spec.PVC.FromVolumeClaimTemplate || cr.Spec.InheritFromStatefulSet {
+			found, err := r.K8sClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, cr.Spec.Target.InstanceName, metav1.GetOptions{})
+			switch {
+			case errors.IsNotFound(err) && cr.Spec.InheritFromStatefulSet:
+				return nil, &targetError{
+					reason:  cachev1.ReasonStatefulSetNotFound,
+					message: "StatefulSet " + cr.Spec.Target.InstanceName + " to inherit from does not exist",
+				}
+			case errors.IsNotFound(err):
+			case err != nil:
+				return nil, err
+			default:
+				sts = found
+			}
+		}
+		if sts != nil {
+			if cr.Spec.InheritFromStatefulSet {
+				inheritHomePaths(&cr.Spec, sts)
+			}
+			claimTemplate = localHomeClaimTemplate(sts, cr.Spec.LocalHomePath)
+		}
+		pvcName, err := localHomePVCName(cr, cr.Spec.Target.InstanceName, claimTemplate, cr.Spec.Target.Ordinal)
+		if err != nil {
+			return nil, err
+		}
+		return &targetSet{
+			ordinals:    []ordinalTarget{{ordinal: cr.Spec.Target.Ordinal, pvcName: pvcName, claimTemplate: claimTemplate}},
+			podSelector: "app.kubernetes.io/name=" + cr.Spec.Target.InstanceName,
+			statefulSet: sts,
+		}, nil
+	}
+
+	ref := cr.Spec.StatefulSetRef
+	sts, err := r.K8sClient.AppsV1().StatefulSets(cr.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, &targetError{reason: cachev1.ReasonStatefulSetNotFound, message: "StatefulSet " + ref.Name + " does not exist"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cr.Spec.InheritFromStatefulSet {
+		inheritHomePaths(&cr.Spec, sts)
+	}
+	claimTemplate := localHomeClaimTemplate(sts, cr.Spec.LocalHomePath)
+	if claimTemplate == nil && cr.Spec.PVCNameTemplate == "" {
+		return nil, &targetError{
+			reason:  cachev1.ReasonVolumeClaimTemplateNotFound,
+			message: "StatefulSet " + ref.Name + " has no volumeClaimTemplate mounted at " + cr.Spec.LocalHomePath,
+		}
+	}
+	selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+	if err != nil {
+		return nil, &targetError{reason: cachev1.ReasonInvalidSpec, message: "StatefulSet " + ref.Name + " has an invalid selector: " + err.Error()}
+	}
+
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	targets := &targetSet{podSelector: selector.String(), statefulSet: sts}
+	for _, ordinal := range selectOrdinals(replicas, ref.IncludeOrdinals, ref.ExcludeOrdinals) {
+		pvcName, err := localHomePVCName(cr, sts.Name, claimTemplate, ordinal)
+		if err != nil {
+			return nil, err
+		}
+		targets.ordinals = append(targets.ordinals, ordinalTarget{ordinal: ordinal, pvcName: pvcName, claimTemplate: claimTemplate})
+	}
+	return targets, nil
+}
+
+// localHomePVCName returns the name of the local home PVC of an ordinal, from spec.pvcNameTemplate
+// or else the volumeClaimTemplate of the StatefulSet mounted at the local home path
+func localHomePVCName(cr *cachev1.CacheBackupRequest, stsName string, claimTemplate *corev1.PersistentVolumeClaim, ordinal int32) (string, error) {
+	if cr.Spec.PVCNameTemplate != "" {
+		pvcName, err := cr.PVCName(ordinal)
+		if err != nil {
+			return "", &targetError{reason: cachev1.ReasonInvalidSpec, message: "Invalid .spec.pvcNameTemplate: " + err.Error()}
+		}
+		return pvcName, nil
+	}
+	if claimTemplate != nil {
+		// the PVC name given by the StatefulSet controller
+		return claimTemplate.Name + "-" + stsName + "-" + strconv.Itoa(int(ordinal)), nil
+	}
+	return "local-home-" + cr.Spec.Target.InstanceName + "-" + strconv.Itoa(int(ordinal)), nil
+}
+
+// selectOrdinals returns the sorted ordinals to pre-warm, included ordinals replace those below replicas
+func selectOrdinals(replicas int32, include, exclude []int32) []int32 {
+	selected := map[int32]bool{}
+	if len(include) > 0 {
+		for _, ordinal := range include {
+			selected[ordinal] = true
+		}
+	} else {
+		for ordinal := int32(0); ordinal < replicas; ordinal++ {
+			selected[ordinal] = true
+		}
+	}
+	for _, ordinal := range exclude {
+		delete(selected, ordinal)
+	}
+
+	ordinals := make([]int32, 0, len(selected))
+	for ordinal := range selected {
+		ordinals = append(ordinals, ordinal)
+	}
+	sort.Slice(ordinals, func(i, j int) bool { return ordinals[i] < ordinals[j] })
+	return ordinals
+}
+
+// localHomeClaimTemplate returns the volumeClaimTemplate a StatefulSet mounts at the local home path, labelled with
+// the StatefulSet selector like the PVCs created by the StatefulSet controller, or nil if there is none
+func localHomeClaimTemplate(sts *appsv1.StatefulSet, localHomePath string) *corev1.PersistentVolumeClaim {
+	claimTemplates := map[string]*corev1.PersistentVolumeClaim{}
+	for i := range sts.Spec.VolumeClaimTemplates {
+		claimTemplates[sts.Spec.VolumeClaimTemplates[i].Name] = &sts.Spec.VolumeClaimTemplates[i]
+	}
+	for _, container := range sts.Spec.Template.Spec.Containers {
+		for _, volumeMount := range container.VolumeMounts {
+			claimTemplate, ok := claimTemplates[volumeMount.Name]
+			if !ok || path.Clean(volumeMount.MountPath) != path.Clean(localHomePath) {
+				continue
+			}
+			claimTemplate = claimTemplate.DeepCopy()
+			if sts.Spec.Selector != nil && len(sts.Spec.Selector.MatchLabels) > 0 {
+				if claimTemplate.Labels == nil {
+					claimTemplate.Labels = map[string]string{}
+				}
+				for k, v := range sts.Spec.Selector.MatchLabels {
+					claimTemplate.Labels[k] = v
+				}
+			}
+			return claimTemplate
+		}
+	}
+	return nil
+}
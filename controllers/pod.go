@@ -1,15 +1,52 @@
 package controllers
 
 import (
-	cachev1beta1 "bianchi2/dc-cache-backup-operator/api/v1beta1"
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/pointer"
+	"path"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	// verificationKeyPath is the directory the public key of spec.verification is mounted to
+	verificationKeyPath = "/etc/pre-warmer/verification"
+	// pvcLabel selects the pre-warmer pod of a local home PVC
+	pvcLabel = "pvc"
+	// pvcAnnotation holds the full name of the local home PVC of a pre-warmer pod, which may not fit in pvcLabel
+	pvcAnnotation = "cache.atlassian.com/pvc"
+)
+
+// pvcLabelValue returns the value of pvcLabel for a PVC. Label values are at most 63 characters and PVC names
+// up to 253, longer names are truncated and suffixed with a hash of the full name to keep them apart
+func pvcLabelValue(localHomePVCName string) string {
+	return truncateName(localHomePVCName, validation.LabelValueMaxLength)
+}
+
+// truncateName returns name if it has at most maxLength characters, else its beginning suffixed with a hash
+// of the full name to keep truncated names apart
+func truncateName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:10]
+	prefix := strings.TrimRight(name[:maxLength-len(hash)-1], "-.")
+	return prefix + "-" + hash
+}
+
 func (r *CacheBackupRequestReconciler) GetRuntimePreWarmerPod(pod *corev1.Pod) *corev1.Pod {
 	err := r.Client.Get(context.Background(), client.ObjectKey{Namespace: pod.Namespace, Name: pod.Name}, pod)
 	if err != nil {
@@ -18,36 +55,55 @@ func (r *CacheBackupRequestReconciler) GetRuntimePreWarmerPod(pod *corev1.Pod) *
 	return pod
 }
 
-// GetNewPreWarmerPod generates pre-warmer pod definition
-func GetNewPreWarmerPod(cr *cachev1beta1.CacheBackupRequest, localHomePVCName string) *corev1.Pod {
-	labels := cr.Spec.PVCLabels
-	if labels == nil {
-		labels = make(map[string]string)
+// preWarmerPodName returns the name of the pre-warmer pod of a local home PVC. Names longer than 63 characters,
+// which a pod hostname cannot exceed, are truncated and suffixed with a hash of the full name
+func preWarmerPodName(localHomePVCName string) string {
+	return truncateName("prewarm-"+localHomePVCName, validation.DNS1123LabelMaxLength)
+}
+
+// GetNewPreWarmerPod generates pre-warmer pod definition. The pod runs the restore built into operatorImage,
+// or the script of spec.configMapName when it is set. With spec.inheritFromStatefulSet the pod settings are
+// taken from sts, the StatefulSet the local home PVC belongs to. The spec.podTemplate.spec override is merged last
+func GetNewPreWarmerPod(cr *cachev1.CacheBackupRequest, localHomePVCName string, sts *appsv1.StatefulSet, operatorImage string) (*corev1.Pod, error) {
+	labels := make(map[string]string, len(cr.Spec.PodTemplate.Labels)+1)
+	for k, v := range cr.Spec.PodTemplate.Labels {
+		labels[k] = v
 	}
-	labels["pvc"] = localHomePVCName
-	if labels == nil {
-		labels = make(map[string]string)
+	labels[pvcLabel] = pvcLabelValue(localHomePVCName)
+	annotations := make(map[string]string, len(cr.Spec.PodTemplate.Annotations)+1)
+	for k, v := range cr.Spec.PodTemplate.Annotations {
+		annotations[k] = v
 	}
-	defaultMode := int32(0755)
-	return &corev1.Pod{
+	annotations[pvcAnnotation] = localHomePVCName
+	image := cr.Spec.PodTemplate.Image
+	if image == "" {
+		image = operatorImage
+	}
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        "prewarm-" + localHomePVCName,
+			Name:        preWarmerPodName(localHomePVCName),
 			Namespace:   cr.Namespace,
 			Labels:      labels,
-			Annotations: cr.Spec.PodAnnotations,
+			Annotations: annotations,
 		},
 		Spec: corev1.PodSpec{
 			RestartPolicy:             corev1.RestartPolicyNever,
-			Tolerations:               cr.Spec.Tolerations,
-			NodeSelector:              cr.Spec.NodeSelector,
-			TopologySpreadConstraints: cr.Spec.TopologySpreadConstraints,
-			Affinity:                  &cr.Spec.Affinity,
+			Tolerations:               cr.Spec.PodTemplate.Tolerations,
+			NodeSelector:              cr.Spec.PodTemplate.NodeSelector,
+			TopologySpreadConstraints: cr.Spec.PodTemplate.TopologySpreadConstraints,
+			Affinity:                  cr.Spec.PodTemplate.Affinity,
+			SecurityContext:           restrictedPodSecurityContext(cachev1.ProfileOf(cr.Spec.Product).UID),
 			Containers: []corev1.Container{
 				{
-					Name:    "pre-warmer",
-					Image:   "atlassian/confluence:8.0.3",
-					Command: []string{"/opt/script/copy-index.sh"},
+					Name:            "pre-warmer",
+					Image:           image,
+					Command:         []string{"/manager", "prewarm"},
+					SecurityContext: restrictedContainerSecurityContext(),
 					Env: []corev1.EnvVar{
+						{
+							Name:  "PRODUCT",
+							Value: string(cr.Spec.Product),
+						},
 						{
 							Name:  "SHARED_HOME",
 							Value: cr.Spec.SharedHomePath,
@@ -56,6 +112,46 @@ func GetNewPreWarmerPod(cr *cachev1beta1.CacheBackupRequest, localHomePVCName st
 							Name:  "LOCAL_HOME",
 							Value: cr.Spec.LocalHomePath,
 						},
+						{
+							Name:  "INDEX_SNAPSHOTS_PATH",
+							Value: cr.Spec.IndexSnapshotsPath,
+						},
+						{
+							Name:  "MAIN_INDEX_SNAPSHOT",
+							Value: cr.Spec.SnapshotLayout.MainIndex,
+						},
+						{
+							Name:  "CHANGE_INDEX_SNAPSHOT",
+							Value: cr.Spec.SnapshotLayout.ChangeIndex,
+						},
+						{
+							Name:  "EDGE_INDEX_SNAPSHOT",
+							Value: cr.Spec.SnapshotLayout.EdgeIndex,
+						},
+						{
+							Name:  "MAIN_INDEX_JOURNAL_ID",
+							Value: cr.Spec.SnapshotLayout.MainIndexJournalID,
+						},
+						{
+							Name:  "CHANGE_INDEX_JOURNAL_ID",
+							Value: cr.Spec.SnapshotLayout.ChangeIndexJournalID,
+						},
+						{
+							Name:  "EDGE_INDEX_JOURNAL_ID",
+							Value: cr.Spec.SnapshotLayout.EdgeIndexJournalID,
+						},
+						{
+							Name:  "REQUIRE_MANIFEST",
+							Value: strconv.FormatBool(cr.Spec.RequireManifest),
+						},
+						{
+							Name:  "VERIFY_INDEX",
+							Value: strconv.FormatBool(cr.Spec.VerifyIndex),
+						},
+						{
+							Name:  "KEEP_PREVIOUS_INDEXES",
+							Value: strconv.Itoa(int(cr.Spec.KeepPreviousIndexes)),
+						},
 					},
 
 					VolumeMounts: []corev1.VolumeMount{
@@ -68,11 +164,11 @@ func GetNewPreWarmerPod(cr *cachev1beta1.CacheBackupRequest, localHomePVCName st
 							MountPath: cr.Spec.SharedHomePath,
 						},
 						{
-							Name:      "copy-index",
-							MountPath: "/opt/script",
+							Name:      "tmp",
+							MountPath: "/tmp",
 						},
 					},
-					Resources: cr.Spec.PodResources,
+					Resources: cr.Spec.PodTemplate.Resources,
 				},
 			},
 			Volumes: []corev1.Volume{
@@ -93,48 +189,195 @@ func GetNewPreWarmerPod(cr *cachev1beta1.CacheBackupRequest, localHomePVCName st
 					},
 				},
 				{
-					Name: "copy-index",
+					// the root filesystem is read-only
+					Name: "tmp",
 					VolumeSource: corev1.VolumeSource{
-						ConfigMap: &corev1.ConfigMapVolumeSource{
-							LocalObjectReference: corev1.LocalObjectReference{
-								Name: cr.Spec.ConfigMapName,
-							},
-							DefaultMode: &defaultMode,
-						},
+						EmptyDir: &corev1.EmptyDirVolumeSource{},
 					},
 				},
 			},
 		},
 	}
+	if cr.Spec.ConfigMapName != "" {
+		useRestoreScript(pod, cr)
+	}
+	if rollback := pendingRollback(cr); rollback != nil {
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "ROLLBACK_TO",
+			Value: strconv.Itoa(int(rollback.Generation)),
+		})
+	}
+	if cr.Spec.Verification != nil && cr.Spec.Verification.PublicKeySecretRef != nil {
+		mountVerificationKey(pod, cr.Spec.Verification.PublicKeySecretRef)
+	}
+	if cr.Spec.InheritFromStatefulSet && sts != nil {
+		inheritFromStatefulSet(pod, cr, sts)
+	}
+	if cr.Spec.PodTemplate.Spec != nil {
+		spec, err := mergePodSpec(pod.Spec, cr.Spec.PodTemplate.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("cannot merge .spec.podTemplate.spec: %v", err)
+		}
+		pod.Spec = *spec
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == "pre-warmer" && container.Image == "" {
+			return nil, fmt.Errorf("the operator image is unknown, set .spec.podTemplate.image, .spec.configMapName or the --prewarmer-image operator flag")
+		}
+	}
+	return pod, nil
 }
 
-// WatchPodStatus watches a pod and returns its status
-func WatchPodStatus(podName, namespace string, clientset kubernetes.Interface, state string) (string, error) {
-
-	if state != "" {
-		return state, nil
+// useRestoreScript makes the pre-warmer run the index restore script of spec.configMapName instead of the
+// restore built into the operator, in the product image unless the request sets one
+func useRestoreScript(pod *corev1.Pod, cr *cachev1.CacheBackupRequest) {
+	defaultMode := int32(0755)
+	container := &pod.Spec.Containers[0]
+	container.Command = []string{"/opt/script/copy-index.sh"}
+	if cr.Spec.PodTemplate.Image == "" {
+		container.Image = cachev1.ProfileOf(cr.Spec.Product).ScriptImage
 	}
-	watcher, err := clientset.CoreV1().Pods(namespace).Watch(context.TODO(), metav1.ListOptions{
-		FieldSelector: fmt.Sprintf("metadata.name=%s", podName),
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "copy-index",
+		MountPath: "/opt/script",
+	})
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "copy-index",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: cr.Spec.ConfigMapName,
+				},
+				DefaultMode: &defaultMode,
+			},
+		},
+	})
+}
+
+// mountVerificationKey mounts the public key snapshot manifests must be signed with, for the restore to verify them
+func mountVerificationKey(pod *corev1.Pod, ref *corev1.SecretKeySelector) {
+	container := &pod.Spec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "PUBLIC_KEY_FILE",
+		Value: path.Join(verificationKeyPath, "public-key.pem"),
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "verification-key",
+		MountPath: verificationKeyPath,
+		ReadOnly:  true,
+	})
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "verification-key",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: ref.Key, Path: "public-key.pem"}},
+			},
+		},
 	})
+}
+
+// restrictedPodSecurityContext runs the pre-warmer as the product user uid, as the restricted Pod Security Standard
+// requires. Files written to the local home belong to the product group through fsGroup
+func restrictedPodSecurityContext(uid int64) *corev1.PodSecurityContext {
+	fsGroupChangePolicy := corev1.FSGroupChangeOnRootMismatch
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot:        pointer.Bool(true),
+		RunAsUser:           &uid,
+		RunAsGroup:          &uid,
+		FSGroup:             &uid,
+		FSGroupChangePolicy: &fsGroupChangePolicy,
+		SeccompProfile:      &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+}
+
+// restrictedContainerSecurityContext drops every capability and privilege of the pre-warmer container
+func restrictedContainerSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: pointer.Bool(false),
+		ReadOnlyRootFilesystem:   pointer.Bool(true),
+		RunAsNonRoot:             pointer.Bool(true),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+}
+
+// mergePodSpec strategically merges override over a generated pod spec. The fields the override leaves
+// unset are removed from the patch, a null would delete them from the generated spec
+func mergePodSpec(generated corev1.PodSpec, override *corev1.PodSpec) (*corev1.PodSpec, error) {
+	original, err := json.Marshal(generated)
 	if err != nil {
-		return "", fmt.Errorf("error watching pod: %v", err)
+		return nil, err
+	}
+	patch, err := json.Marshal(override)
+	if err != nil {
+		return nil, err
+	}
+	var patchMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		return nil, err
+	}
+	patch, err = json.Marshal(withoutNulls(patchMap))
+	if err != nil {
+		return nil, err
 	}
-	defer watcher.Stop()
 
-	// Wait for the pod status to become available
-	for event := range watcher.ResultChan() {
-		pod, ok := event.Object.(*corev1.Pod)
-		if !ok {
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, corev1.PodSpec{})
+	if err != nil {
+		return nil, err
+	}
+	spec := &corev1.PodSpec{}
+	if err := json.Unmarshal(merged, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// withoutNulls removes the null values of decoded JSON
+func withoutNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = withoutNulls(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withoutNulls(item)
+		}
+	}
+	return value
+}
+
+// restoreResult returns the result the pre-warmer container wrote to its termination message, nil if it did not
+func restoreResult(pod *corev1.Pod) *cachev1.RestoreResult {
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name != "pre-warmer" || containerStatus.State.Terminated == nil {
 			continue
 		}
-		if pod.Name == podName {
-			switch pod.Status.Phase {
-			case corev1.PodPending, corev1.PodRunning, corev1.PodSucceeded, corev1.PodFailed:
-				return string(pod.Status.Phase), nil
-			}
+		result := &cachev1.RestoreResult{}
+		if err := json.Unmarshal([]byte(containerStatus.State.Terminated.Message), result); err != nil || result.Outcome == "" {
+			return nil
 		}
+		return result
 	}
+	return nil
+}
+
+// podStatusRequeueInterval is how often a pre-warmer pod is checked when no status change triggers a reconcile,
+// as for pods created before they were owned by the request
+const podStatusRequeueInterval = 1 * time.Minute
 
-	return "", fmt.Errorf("timed out waiting for pod status")
+// PreWarmerPodStatus returns the phase of a pre-warmer pod, empty while it has none. state overrides it in tests
+func PreWarmerPodStatus(pod *corev1.Pod, state string) string {
+	if state != "" {
+		return state
+	}
+	switch pod.Status.Phase {
+	case corev1.PodPending, corev1.PodRunning, corev1.PodSucceeded, corev1.PodFailed:
+		return string(pod.Status.Phase)
+	}
+	return ""
 }
@@ -1,7 +1,7 @@
 package controllers
 
 import (
-	cachev1beta1 "bianchi2/dc-cache-backup-operator/api/v1beta1"
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
 	"context"
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
@@ -10,70 +10,94 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-func GetNewPVC(cr *cachev1beta1.CacheBackupRequest, localHomePVCName string) *corev1.PersistentVolumeClaim {
-	pcvVolumeMode := (*corev1.PersistentVolumeMode)(&cr.Spec.PvcVolumeMode)
-	volumeMode := cr.Spec.PvcVolumeMode
-	if volumeMode == "" {
-		pcvVolumeMode = nil
-	}
-
-	labels := cr.Spec.PVCLabels
-	if labels == nil {
-		labels = make(map[string]string)
-	}
-	labels["app.kubernetes.io/instance"] = cr.Spec.InstanceName
-	labels["app.kubernetes.io/name"] = cr.Spec.InstanceName
-
+// GetNewPVC generates local home PVC definition. With pvc.fromVolumeClaimTemplate it is copied from
+// claimTemplate, the volumeClaimTemplate mounted at the local home path, and the pvc fields override it
+func GetNewPVC(cr *cachev1.CacheBackupRequest, localHomePVCName string, claimTemplate *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        localHomePVCName,
 			Namespace:   cr.Namespace,
-			Labels:      labels,
-			Annotations: cr.Spec.PVCAnnotations,
-		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.ReadWriteOnce,
-			},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(cr.Spec.PvcStorageRequest),
-				},
-			},
+			Labels:      make(map[string]string),
+			Annotations: make(map[string]string),
 		},
 	}
 
-	if cr.Spec.PvcStorageClass != "" {
-		pvc.Spec.StorageClassName = &cr.Spec.PvcStorageClass
+	if cr.Spec.PVC.FromVolumeClaimTemplate {
+		if claimTemplate == nil {
+			return nil, fmt.Errorf("spec.pvc.fromVolumeClaimTemplate is true but there is no volumeClaimTemplate mounted at %s", cr.Spec.LocalHomePath)
+		}
+		for k, v := range claimTemplate.Labels {
+			pvc.Labels[k] = v
+		}
+		for k, v := range claimTemplate.Annotations {
+			pvc.Annotations[k] = v
+		}
+		pvc.Spec = *claimTemplate.Spec.DeepCopy()
+		for k, v := range cr.Spec.PVC.Labels {
+			pvc.Labels[k] = v
+		}
+	} else {
+		for k, v := range cr.Spec.PVC.Labels {
+			pvc.Labels[k] = v
+		}
+		// a request targeting a StatefulSet has no Helm release name to label the PVC with
+		if cr.Spec.Target.InstanceName != "" {
+			pvc.Labels["app.kubernetes.io/instance"] = cr.Spec.Target.InstanceName
+			pvc.Labels["app.kubernetes.io/name"] = cr.Spec.Target.InstanceName
+		}
+	}
+	for k, v := range cr.Spec.PVC.Annotations {
+		pvc.Annotations[k] = v
 	}
 
-	// Conditionally include Selector field
-	if cr.Spec.PvcLabelSelector.MatchLabels != nil {
-		pvc.Spec.Selector = &cr.Spec.PvcLabelSelector
+	if len(cr.Spec.PVC.AccessModes) > 0 {
+		pvc.Spec.AccessModes = cr.Spec.PVC.AccessModes
 	}
-	if cr.Spec.PvcVolumeName != "" {
-		pvc.Spec.VolumeName = cr.Spec.PvcVolumeName
+	if len(pvc.Spec.AccessModes) == 0 {
+		pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
 	}
-	pvc.Spec.VolumeMode = pcvVolumeMode
-	return pvc
-}
 
-// IsPVCExistsAndFree returns PVC by name
-func IsPVCExistsAndFree(cr *cachev1beta1.CacheBackupRequest, localHomePVCName string, clientset kubernetes.Interface) (exists bool, free bool, err error) {
+	if cr.Spec.PVC.StorageRequest != "" || !cr.Spec.PVC.FromVolumeClaimTemplate {
+		storageRequest, err := resource.ParseQuantity(cr.Spec.PVC.StorageRequest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec.pvc.storageRequest %q: %v", cr.Spec.PVC.StorageRequest, err)
+		}
+		if pvc.Spec.Resources.Requests == nil {
+			pvc.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = storageRequest
+	}
 
-	if err != nil {
-		return false, false, err
+	if cr.Spec.PVC.StorageClassName != "" {
+		pvc.Spec.StorageClassName = &cr.Spec.PVC.StorageClassName
+	}
+
+	if cr.Spec.PVC.VolumeName != "" {
+		pvc.Spec.VolumeName = cr.Spec.PVC.VolumeName
 	}
+	if cr.Spec.PVC.Selector != nil {
+		pvc.Spec.Selector = cr.Spec.PVC.Selector
+	}
+	if cr.Spec.PVC.VolumeMode != nil {
+		pvc.Spec.VolumeMode = cr.Spec.PVC.VolumeMode
+	}
+	return pvc, nil
+}
+
+// IsPVCExistsAndFree returns whether a PVC exists and is not used by any of the pods matching podSelector
+func IsPVCExistsAndFree(namespace, localHomePVCName, podSelector string, clientset kubernetes.Interface) (exists bool, free bool, err error) {
 
 	// check if PVC exists
-	pvc, err := clientset.CoreV1().PersistentVolumeClaims(cr.Namespace).Get(context.TODO(), localHomePVCName, metav1.GetOptions{})
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), localHomePVCName, metav1.GetOptions{})
 	if err != nil || pvc == nil {
 		return false, true, fmt.Errorf("PVC does not exist: %v", localHomePVCName)
 	}
 
 	// get all pods by label selector and check if PVC is used as volume source in volumes
-	pods := &corev1.PodList{}
-	pods, err = clientset.CoreV1().Pods(cr.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "app.kubernetes.io/name=" + cr.Spec.InstanceName})
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: podSelector})
+	if err != nil {
+		return true, false, fmt.Errorf("cannot list pods using PVC %v: %v", localHomePVCName, err)
+	}
 
 	for _, pod := range pods.Items {
 		volumes := pod.Spec.Volumes
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sort"
+	"time"
+)
+
+const (
+	// safetySnapshotLabel marks the VolumeSnapshots taken for spec.safetySnapshot
+	safetySnapshotLabel = "cache.atlassian.com/safety-snapshot"
+	// safetySnapshotRequestAnnotation names the request a safety snapshot was taken for
+	safetySnapshotRequestAnnotation = "cache.atlassian.com/request"
+	// restoreTokenAnnotation records the spec.restoreSafetySnapshot token a PVC was recreated for
+	restoreTokenAnnotation = "cache.atlassian.com/restore-safety-snapshot-token"
+)
+
+// VolumeSnapshots are handled as unstructured objects, the operator does not depend on the external-snapshotter
+// client and runs in clusters without the snapshot CRDs as long as spec.safetySnapshot is not used
+var volumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+// newSafetySnapshot returns a VolumeSnapshot of a local home PVC, named after the PVC and the time it is taken
+func newSafetySnapshot(cr *cachev1.CacheBackupRequest, localHomePVCName string, now time.Time) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(localHomePVCName + "-" + now.UTC().Format("20060102150405"))
+	snapshot.SetNamespace(cr.Namespace)
+	snapshot.SetLabels(map[string]string{safetySnapshotLabel: "true"})
+	snapshot.SetAnnotations(map[string]string{safetySnapshotRequestAnnotation: cr.Name})
+	_ = unstructured.SetNestedField(snapshot.Object, cr.Spec.SafetySnapshot.VolumeSnapshotClassName, "spec", "volumeSnapshotClassName")
+	_ = unstructured.SetNestedField(snapshot.Object, localHomePVCName, "spec", "source", "persistentVolumeClaimName")
+	return snapshot
+}
+
+// getSafetySnapshot returns a safety snapshot, nil if there is none with that name
+func (r *CacheBackupRequestReconciler) getSafetySnapshot(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, snapshot)
+	if errors.IsNotFound(err) || (err == nil && snapshot.GetLabels()[safetySnapshotLabel] != "true") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// takeSafetySnapshot snapshots the local home PVC of an ordinal before a pre-warmer pod is created for it. It returns
+// true once the snapshot is ready to use or if the pod exists already, otherwise when to check the snapshot again
+func (r *CacheBackupRequestReconciler) takeSafetySnapshot(ctx context.Context, run *ordinalRun, pvcName string, ordinalStatus *cachev1.OrdinalStatus) (bool, time.Duration, error) {
+	log := log.FromContext(ctx)
+	instance := run.cr
+	generation := instance.Generation
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: preWarmerPodName(pvcName), Namespace: instance.Namespace}, &corev1.Pod{})
+	if err == nil {
+		return true, 0, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, 0, err
+	}
+
+	// a snapshot that is ready to use was taken before a previous run, whose pod has been deleted since
+	var snapshot *unstructured.Unstructured
+	if taken := ordinalStatus.SafetySnapshot; taken != nil && !taken.ReadyToUse {
+		snapshot, err = r.getSafetySnapshot(ctx, instance.Namespace, taken.Name)
+		if err != nil {
+			return false, 0, err
+		}
+	}
+	if snapshot == nil {
+		snapshot = newSafetySnapshot(instance, pvcName, run.now)
+		log.Info("Taking safety snapshot " + snapshot.GetName() + " of PVC " + pvcName)
+		err := r.Client.Create(ctx, snapshot)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return false, 0, err
+		}
+		ordinalStatus.SafetySnapshot = &cachev1.SafetySnapshotStatus{Name: snapshot.GetName(), CreationTime: metav1.NewTime(run.now)}
+	}
+
+	message := "VolumeSnapshot " + snapshot.GetName() + " of PVC " + pvcName
+	if snapshotErr, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); snapshotErr != "" {
+		message += " has failed: " + snapshotErr + ". Delete it to take another one"
+		log.Info(message)
+		ordinalStatus.Phase = cachev1.PhaseFailed
+		setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionSafetySnapshotReady, metav1.ConditionFalse, cachev1.ReasonSafetySnapshotFailed, message)
+		setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionRestoring, metav1.ConditionFalse, cachev1.ReasonSafetySnapshotFailed, message)
+		setDegraded(&ordinalStatus.Conditions, generation, cachev1.ReasonSafetySnapshotFailed, message)
+		return false, 1 * time.Minute, nil
+	}
+	if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); !ready {
+		setSafetySnapshotPending(ordinalStatus, generation, message+" is not ready to use yet")
+		return false, 5 * time.Second, nil
+	}
+
+	ordinalStatus.SafetySnapshot.ReadyToUse = true
+	setCondition(&ordinalStatus.Conditions, generation, cachev1.ConditionSafetySnapshotReady, metav1.ConditionTrue, cachev1.ReasonSafetySnapshotReady, message+" is ready to use")
+	return true, 0, r.pruneSafetySnapshots(ctx, instance, pvcName)
+}
+
+// pruneSafetySnapshots deletes the oldest ready safety snapshots of a PVC beyond spec.safetySnapshot.retain.
+// Snapshots that are not ready are left alone, they may be the only ones a failed snapshot leaves behind
+func (r *CacheBackupRequestReconciler) pruneSafetySnapshots(ctx context.Context, cr *cachev1.CacheBackupRequest, pvcName string) error {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(volumeSnapshotGVK.GroupVersion().WithKind(volumeSnapshotGVK.Kind + "List"))
+	err := r.Client.List(ctx, list, client.InNamespace(cr.Namespace), client.MatchingLabels{safetySnapshotLabel: "true"})
+	if err != nil {
+		return err
+	}
+
+	var ready []unstructured.Unstructured
+	for _, snapshot := range list.Items {
+		source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+		readyToUse, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		if source == pvcName && readyToUse && snapshot.GetDeletionTimestamp() == nil {
+			ready = append(ready, snapshot)
+		}
+	}
+	// names end with the time the snapshots were taken, they order snapshots taken in the same second
+	sort.Slice(ready, func(i, j int) bool {
+		ti, tj := ready[i].GetCreationTimestamp(), ready[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return ready[i].GetName() > ready[j].GetName()
+	})
+
+	retain := int(cr.Spec.SafetySnapshot.Retain)
+	if retain < 1 {
+		retain = cachev1.DefaultSafetySnapshotRetain
+	}
+	for i := retain; i < len(ready); i++ {
+		log.FromContext(ctx).Info("Deleting safety snapshot " + ready[i].GetName() + " of PVC " + pvcName)
+		err := r.Client.Delete(ctx, &ready[i])
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingSafetySnapshotRestore returns the restore requested with spec.restoreSafetySnapshot if it has not completed yet
+func pendingSafetySnapshotRestore(cr *cachev1.CacheBackupRequest) *cachev1.SafetySnapshotRestoreRequest {
+	restore := cr.Spec.RestoreSafetySnapshot
+	last := cr.Status.LastSafetySnapshotRestore
+	if restore == nil || (last != nil && last.Token == restore.Token && last.CompletedAt != nil) {
+		return nil
+	}
+	return restore
+}
+
+// restoreSafetySnapshot recreates the local home PVC a safety snapshot was taken of, for spec.restoreSafetySnapshot.
+// The PVC is deleted once neither the product nor a pre-warmer pod uses it, and created again from spec.pvc with the
+// snapshot as its data source. The ordinals are not pre-warmed in the meantime
+func (r *CacheBackupRequestReconciler) restoreSafetySnapshot(ctx context.Context, req ctrl.Request, instance *cachev1.CacheBackupRequest, targets *targetSet, restore *cachev1.SafetySnapshotRestoreRequest) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	snapshot, err := r.getSafetySnapshot(ctx, instance.Namespace, restore.VolumeSnapshotName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if snapshot == nil {
+		return r.waitForTarget(ctx, req, instance, &targetError{
+			reason:  cachev1.ReasonSafetySnapshotNotFound,
+			message: "Safety snapshot " + restore.VolumeSnapshotName + " to restore does not exist",
+		})
+	}
+	if owner := snapshot.GetAnnotations()[safetySnapshotRequestAnnotation]; owner != instance.Name {
+		return r.waitForTarget(ctx, req, instance, &targetError{
+			reason:  cachev1.ReasonInvalidSpec,
+			message: "Safety snapshot " + snapshot.GetName() + " was taken for request " + owner + ", not " + instance.Name,
+		})
+	}
+	pvcName, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	var target *ordinalTarget
+	for i := range targets.ordinals {
+		if targets.ordinals[i].pvcName == pvcName {
+			target = &targets.ordinals[i]
+		}
+	}
+	if target == nil {
+		return r.waitForTarget(ctx, req, instance, &targetError{
+			reason:  cachev1.ReasonInvalidSpec,
+			message: "Safety snapshot " + snapshot.GetName() + " was taken of PVC " + pvcName + ", which is not pre-warmed by " + instance.Name,
+		})
+	}
+	if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); !ready {
+		log.Info("Safety snapshot " + snapshot.GetName() + " is not ready to use. Waiting 5 seconds...")
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+
+	crStatus := newStatus(instance)
+	last := crStatus.LastSafetySnapshotRestore
+	if last == nil || last.Token != restore.Token {
+		last = &cachev1.SafetySnapshotRestoreStatus{
+			VolumeSnapshotName: snapshot.GetName(),
+			Token:              restore.Token,
+			PVCName:            pvcName,
+			StartedAt:          metav1.Now(),
+		}
+		crStatus.LastSafetySnapshotRestore = last
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: instance.Namespace}, pvc)
+	switch {
+	case err == nil && pvc.Annotations[restoreTokenAnnotation] == restore.Token:
+		log.Info("PVC " + pvcName + " recreated from safety snapshot " + snapshot.GetName())
+		completedAt := metav1.Now()
+		last.CompletedAt = &completedAt
+		return ctrl.Result{RequeueAfter: 1 * time.Second}, r.UpdateStatus(ctx, req, crStatus)
+
+	case err == nil:
+		if pvc.DeletionTimestamp == nil {
+			exists, free, err := IsPVCExistsAndFree(instance.Namespace, pvcName, targets.podSelector, r.K8sClient)
+			if !exists {
+				return ctrl.Result{}, err
+			}
+			if !free {
+				return r.waitForTarget(ctx, req, instance, &targetError{reason: cachev1.ReasonPVCInUse, message: err.Error()})
+			}
+			err = r.Client.Get(ctx, types.NamespacedName{Name: preWarmerPodName(pvcName), Namespace: instance.Namespace}, &corev1.Pod{})
+			if err == nil {
+				return r.waitForTarget(ctx, req, instance, &targetError{
+					reason:  cachev1.ReasonPVCInUse,
+					message: "PVC " + pvcName + " is used by pre-warmer pod " + preWarmerPodName(pvcName) + ", delete it to restore safety snapshot " + snapshot.GetName(),
+				})
+			}
+			if !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			log.Info("Deleting PVC " + pvcName + " to recreate it from safety snapshot " + snapshot.GetName())
+			err = r.Client.Delete(ctx, pvc)
+			if err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+		}
+
+	case errors.IsNotFound(err):
+		pvc, err := GetNewPVC(instance, pvcName, target.claimTemplate)
+		if err != nil {
+			return r.waitForTarget(ctx, req, instance, &targetError{reason: cachev1.ReasonInvalidSpec, message: err.Error()})
+		}
+		apiGroup := volumeSnapshotGVK.Group
+		pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: volumeSnapshotGVK.Kind, Name: snapshot.GetName()}
+		// a volume populated from the snapshot is provisioned, an existing one cannot be bound
+		pvc.Spec.VolumeName = ""
+		if size, _, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize"); size != "" {
+			restoreSize, err := resource.ParseQuantity(size)
+			if err == nil && restoreSize.Cmp(pvc.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+				if pvc.Spec.Resources.Requests == nil {
+					pvc.Spec.Resources.Requests = corev1.ResourceList{}
+				}
+				pvc.Spec.Resources.Requests[corev1.ResourceStorage] = restoreSize
+			}
+		}
+		pvc.Annotations[restoreTokenAnnotation] = restore.Token
+		log.Info("Recreating PVC " + pvcName + " from safety snapshot " + snapshot.GetName())
+		err = r.Client.Create(ctx, pvc)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+
+	default:
+		return ctrl.Result{}, err
+	}
+
+	if !equality.Semantic.DeepEqual(crStatus, &instance.Status) {
+		err := r.UpdateStatus(ctx, req, crStatus)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"time"
+)
+
+// phasePriority orders phases by how pressing they are, the request phase is the most pressing ordinal phase
+var phasePriority = map[cachev1.CacheBackupRequestPhase]int{
+	cachev1.PhaseSkipped:           1,
+	cachev1.PhaseSucceeded:         2,
+	cachev1.PhaseRestored:          3,
+	cachev1.PhasePartiallyRestored: 4,
+	cachev1.PhaseRolledBack:        5,
+	"":                             6,
+	cachev1.PhaseWaiting:           7,
+	cachev1.PhasePending:           8,
+	cachev1.PhaseRunning:           9,
+	cachev1.PhaseFailed:            10,
+}
+
+// newStatus returns a copy of the current custom resource status to be modified and written back
+func newStatus(cr *cachev1.CacheBackupRequest) *cachev1.CacheBackupRequestStatus {
+	status := cr.Status.DeepCopy()
+	status.ObservedGeneration = cr.Generation
+	return status
+}
+
+// newOrdinalStatus returns a copy of the current status of an ordinal to be modified and written back
+func newOrdinalStatus(cr *cachev1.CacheBackupRequest, target ordinalTarget) *cachev1.OrdinalStatus {
+	status := &cachev1.OrdinalStatus{Ordinal: target.ordinal}
+	for i := range cr.Status.Ordinals {
+		if cr.Status.Ordinals[i].Ordinal == target.ordinal {
+			status = cr.Status.Ordinals[i].DeepCopy()
+		}
+	}
+	status.PVCName = target.pvcName
+	return status
+}
+
+// setCondition adds or updates a condition, LastTransitionTime only changes when the condition status does
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setPhase records the phase of a pre-warming run and keeps Ready, Restoring and Degraded conditions consistent with it
+func setPhase(status *cachev1.OrdinalStatus, generation int64, phase cachev1.CacheBackupRequestPhase, message string) {
+	status.Phase = phase
+	switch phase {
+	case cachev1.PhasePending:
+		setCondition(&status.Conditions, generation, cachev1.ConditionRestoring, metav1.ConditionTrue, cachev1.ReasonPodPending, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionReady, metav1.ConditionFalse, cachev1.ReasonPodPending, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionDegraded, metav1.ConditionFalse, cachev1.ReasonAsExpected, "")
+	case cachev1.PhaseRunning:
+		setCondition(&status.Conditions, generation, cachev1.ConditionRestoring, metav1.ConditionTrue, cachev1.ReasonPodRunning, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionReady, metav1.ConditionFalse, cachev1.ReasonPodRunning, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionDegraded, metav1.ConditionFalse, cachev1.ReasonAsExpected, "")
+	case cachev1.PhaseSucceeded, cachev1.PhaseRestored, cachev1.PhasePartiallyRestored, cachev1.PhaseRolledBack, cachev1.PhaseSkipped:
+		reason := cachev1.ReasonRestoreSucceeded
+		switch phase {
+		case cachev1.PhasePartiallyRestored:
+			reason = cachev1.ReasonRestorePartial
+		case cachev1.PhaseRolledBack:
+			reason = cachev1.ReasonRolledBack
+		case cachev1.PhaseSkipped:
+			reason = cachev1.ReasonRestoreSkipped
+		}
+		setCondition(&status.Conditions, generation, cachev1.ConditionRestoring, metav1.ConditionFalse, reason, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionReady, metav1.ConditionTrue, reason, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionDegraded, metav1.ConditionFalse, cachev1.ReasonAsExpected, "")
+	case cachev1.PhaseFailed:
+		setCondition(&status.Conditions, generation, cachev1.ConditionRestoring, metav1.ConditionFalse, cachev1.ReasonPodFailed, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionReady, metav1.ConditionFalse, cachev1.ReasonPodFailed, message)
+		setCondition(&status.Conditions, generation, cachev1.ConditionDegraded, metav1.ConditionTrue, cachev1.ReasonPodFailed, message)
+	}
+}
+
+// setSafetySnapshotPending records that the pre-warmer pod of an ordinal is not created until its safety snapshot is ready
+func setSafetySnapshotPending(status *cachev1.OrdinalStatus, generation int64, message string) {
+	status.Phase = cachev1.PhasePending
+	setCondition(&status.Conditions, generation, cachev1.ConditionSafetySnapshotReady, metav1.ConditionFalse, cachev1.ReasonSafetySnapshotPending, message)
+	setCondition(&status.Conditions, generation, cachev1.ConditionRestoring, metav1.ConditionTrue, cachev1.ReasonSafetySnapshotPending, message)
+	setCondition(&status.Conditions, generation, cachev1.ConditionReady, metav1.ConditionFalse, cachev1.ReasonSafetySnapshotPending, message)
+	setCondition(&status.Conditions, generation, cachev1.ConditionDegraded, metav1.ConditionFalse, cachev1.ReasonAsExpected, "")
+}
+
+// setDegraded records a problem that pre-warming cannot recover from on its own
+func setDegraded(conditions *[]metav1.Condition, generation int64, reason, message string) {
+	setCondition(conditions, generation, cachev1.ConditionReady, metav1.ConditionFalse, reason, message)
+	setCondition(conditions, generation, cachev1.ConditionDegraded, metav1.ConditionTrue, reason, message)
+}
+
+// setSucceeded records a successful run and when the next one is due
+func setSucceeded(status *cachev1.OrdinalStatus, generation int64, phase cachev1.CacheBackupRequestPhase, message string, now, next time.Time) {
+	setPhase(status, generation, phase, message)
+	lastSuccessfulTime := metav1.NewTime(now)
+	status.LastSuccessfulTime = &lastSuccessfulTime
+	status.NextScheduledTime = scheduledTime(next)
+}
+
+// setSignatureCondition records whether the snapshot of a restore was signed with the key of spec.verification.
+// Restores that did not check a signature, such as skipped ones, leave the condition as it was
+func setSignatureCondition(status *cachev1.OrdinalStatus, generation int64, result *cachev1.RestoreResult) {
+	if result == nil || result.Signature == nil {
+		return
+	}
+	if result.Signature.Valid {
+		message := "Snapshot " + result.SnapshotID + " is signed with key " + result.Signature.KeyFingerprint
+		if result.Signature.Signer != "" {
+			message += " by " + result.Signature.Signer
+		}
+		setCondition(&status.Conditions, generation, cachev1.ConditionSnapshotVerified, metav1.ConditionTrue, cachev1.ReasonSignatureValid, message)
+		return
+	}
+	setCondition(&status.Conditions, generation, cachev1.ConditionSnapshotVerified, metav1.ConditionFalse, cachev1.ReasonSignatureInvalid, result.Reason)
+}
+
+// setIndexCondition records whether the index of a restore passed the check of spec.verifyIndex.
+// Restores that did not check the index leave the condition as it was
+func setIndexCondition(status *cachev1.OrdinalStatus, generation int64, result *cachev1.RestoreResult) {
+	if result == nil || result.IndexVerification == nil {
+		return
+	}
+	verification := result.IndexVerification
+	if verification.Valid {
+		message := strconv.Itoa(int(verification.Indexes)) + " Lucene indexes of snapshot " + result.SnapshotID + " checked: " +
+			strconv.Itoa(int(verification.Segments)) + " segments, " + strconv.Itoa(int(verification.Files)) + " files"
+		setCondition(&status.Conditions, generation, cachev1.ConditionIndexVerified, metav1.ConditionTrue, cachev1.ReasonIndexIntact, message)
+		return
+	}
+	setCondition(&status.Conditions, generation, cachev1.ConditionIndexVerified, metav1.ConditionFalse, cachev1.ReasonIndexCorrupt, result.Reason)
+}
+
+// scheduledTime returns when the next run is due, nil for the zero time which means never
+func scheduledTime(next time.Time) *metav1.Time {
+	if next.IsZero() {
+		return nil
+	}
+	nextScheduledTime := metav1.NewTime(next)
+	return &nextScheduledTime
+}
+
+// summarizeStatus sets the phase, times and conditions of a request from the status of its ordinals.
+// The request is Ready and its PVCs available when they are for every ordinal, and it is Restoring
+// or Degraded when any ordinal is. Conditions no ordinal reports yet are removed.
+func summarizeStatus(status *cachev1.CacheBackupRequestStatus) {
+	status.Phase = ""
+	status.PVCName = ""
+	status.LastSuccessfulTime = nil
+	status.NextScheduledTime = nil
+	status.IndexRestoreDurationSeconds = 0
+	if len(status.Ordinals) == 1 {
+		status.PVCName = status.Ordinals[0].PVCName
+	}
+
+	for i, ordinal := range status.Ordinals {
+		if i == 0 || phasePriority[ordinal.Phase] > phasePriority[status.Phase] {
+			status.Phase = ordinal.Phase
+		}
+		if ordinal.LastSuccessfulTime != nil && (status.LastSuccessfulTime == nil || ordinal.LastSuccessfulTime.After(status.LastSuccessfulTime.Time)) {
+			status.LastSuccessfulTime = ordinal.LastSuccessfulTime
+			status.IndexRestoreDurationSeconds = ordinal.IndexRestoreDurationSeconds
+		}
+		if ordinal.NextScheduledTime != nil && (status.NextScheduledTime == nil || ordinal.NextScheduledTime.Before(status.NextScheduledTime)) {
+			status.NextScheduledTime = ordinal.NextScheduledTime
+		}
+	}
+
+	summarizeCondition(status, cachev1.ConditionReady, metav1.ConditionFalse)
+	summarizeCondition(status, cachev1.ConditionPVCAvailable, metav1.ConditionFalse)
+	summarizeCondition(status, cachev1.ConditionRestoring, metav1.ConditionTrue)
+	summarizeCondition(status, cachev1.ConditionDegraded, metav1.ConditionTrue)
+	summarizeCondition(status, cachev1.ConditionSnapshotVerified, metav1.ConditionFalse)
+	summarizeCondition(status, cachev1.ConditionIndexVerified, metav1.ConditionFalse)
+	summarizeCondition(status, cachev1.ConditionSafetySnapshotReady, metav1.ConditionFalse)
+}
+
+// summarizeCondition copies the first ordinal condition with the dominant status, or the first one if there is none
+func summarizeCondition(status *cachev1.CacheBackupRequestStatus, conditionType string, dominant metav1.ConditionStatus) {
+	var summary *metav1.Condition
+	var ordinal int32
+	for _, ordinalStatus := range status.Ordinals {
+		condition := meta.FindStatusCondition(ordinalStatus.Conditions, conditionType)
+		if condition != nil && (summary == nil || (summary.Status != dominant && condition.Status == dominant)) {
+			summary, ordinal = condition, ordinalStatus.Ordinal
+		}
+	}
+	if summary == nil {
+		meta.RemoveStatusCondition(&status.Conditions, conditionType)
+		return
+	}
+
+	message := summary.Message
+	if len(status.Ordinals) > 1 && message != "" {
+		message = "Ordinal " + strconv.Itoa(int(ordinal)) + ": " + message
+	}
+	setCondition(&status.Conditions, status.ObservedGeneration, conditionType, summary.Status, summary.Reason, message)
+}
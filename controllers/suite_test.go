@@ -17,15 +17,29 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/pointer"
 	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"strconv"
+	"strings"
 	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -41,7 +55,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
-	cachev1beta1 "bianchi2/dc-cache-backup-operator/api/v1beta1"
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -59,12 +73,15 @@ var testEnv *envtest.Environment
 //}
 
 const (
-	layout                 = "2006-01-02 15:04:05 -0700"
 	testCustomResourceName = "sample-backup-request"
 	instanceName           = "confluence"
 	namespace              = "default"
 	statefulSetNumberOne   = 1
 	statefulSetNumberTwo   = 2
+	sharedHomePVCName      = "confluence-shared-home-pvc"
+	sharedHomePath         = "/var/atlassian/application-data/shared-home"
+	localHomePath          = "/var/atlassian/application-data/confluence"
+	configMapName          = "copy-index"
 )
 
 var metadataMap = map[string]string{"foo": "bar"}
@@ -83,69 +100,94 @@ var podAffinityTerm = &corev1.PodAffinityTerm{
 var fakeClient = fake.NewClientBuilder().Build()
 var testClient = testclient.NewSimpleClientset()
 
-var instanceCreatePVC = cachev1beta1.CacheBackupRequest{
+var volumeMode = corev1.PersistentVolumeMode(instanceName)
+
+var instanceCreatePVC = cachev1.CacheBackupRequest{
 	ObjectMeta: metav1.ObjectMeta{
 		Name:      testCustomResourceName,
 		Namespace: namespace,
 	},
-	Spec: cachev1beta1.CacheBackupRequestSpec{
-		InstanceName:          instanceName,
-		StatefulSetNumber:     statefulSetNumberOne,
-		CreatePVC:             true,
-		PvcStorageRequest:     "1Gi",
-		BackupIntervalMinutes: 1,
-		PVCLabels:             metadataMap,
-		PVCAnnotations:        metadataMap,
-		PvcVolumeName:         instanceName,
-		PvcStorageClass:       instanceName,
-		PvcLabelSelector: metav1.LabelSelector{
-			MatchLabels: metadataMap,
+	Spec: cachev1.CacheBackupRequestSpec{
+		Target: cachev1.TargetSpec{
+			InstanceName: instanceName,
+			Ordinal:      statefulSetNumberOne,
 		},
-		PvcVolumeMode:  instanceName,
-		PodLabels:      metadataMap,
-		PodAnnotations: metadataMap,
-		NodeSelector:   metadataMap,
-		Affinity: corev1.Affinity{
-			NodeAffinity: nil,
-			PodAffinity: &corev1.PodAffinity{
-				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{*podAffinityTerm},
-			},
-			PodAntiAffinity: nil,
+		Schedule: cachev1.ScheduleSpec{
+			Interval: metav1.Duration{Duration: 1 * time.Minute},
 		},
-		Tolerations: []corev1.Toleration{
-			{
-				Key:               "example-key",
-				Operator:          "Equal",
-				Value:             "example-value",
-				Effect:            "NoSchedule",
-				TolerationSeconds: nil,
+		SharedHomePVCName: sharedHomePVCName,
+		SharedHomePath:    sharedHomePath,
+		LocalHomePath:     localHomePath,
+		ConfigMapName:     configMapName,
+		PVC: cachev1.PVCSpec{
+			Create:           true,
+			StorageRequest:   "1Gi",
+			Labels:           metadataMap,
+			Annotations:      metadataMap,
+			VolumeName:       instanceName,
+			StorageClassName: instanceName,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: metadataMap,
 			},
+			VolumeMode: &volumeMode,
 		},
-		TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
-			{
-				MaxSkew:            1,
-				TopologyKey:        "kubernetes.io/hostname",
-				WhenUnsatisfiable:  "DoNotSchedule",
-				LabelSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"example-key": "example-value"}},
-				MinDomains:         nil,
-				NodeAffinityPolicy: nil,
-				NodeTaintsPolicy:   nil,
-				MatchLabelKeys:     []string{"example-key"},
+		PodTemplate: cachev1.PreWarmerPodTemplate{
+			Labels:       metadataMap,
+			Annotations:  metadataMap,
+			NodeSelector: metadataMap,
+			Affinity: &corev1.Affinity{
+				NodeAffinity: nil,
+				PodAffinity: &corev1.PodAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{*podAffinityTerm},
+				},
+				PodAntiAffinity: nil,
+			},
+			Tolerations: []corev1.Toleration{
+				{
+					Key:               "example-key",
+					Operator:          "Equal",
+					Value:             "example-value",
+					Effect:            "NoSchedule",
+					TolerationSeconds: nil,
+				},
+			},
+			TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+				{
+					MaxSkew:            1,
+					TopologyKey:        "kubernetes.io/hostname",
+					WhenUnsatisfiable:  "DoNotSchedule",
+					LabelSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"example-key": "example-value"}},
+					MinDomains:         nil,
+					NodeAffinityPolicy: nil,
+					NodeTaintsPolicy:   nil,
+					MatchLabelKeys:     []string{"example-key"},
+				},
 			},
 		},
 	},
 }
 
-var instanceUseExistingPVC = cachev1beta1.CacheBackupRequest{
+var instanceUseExistingPVC = cachev1.CacheBackupRequest{
 	ObjectMeta: metav1.ObjectMeta{
 		Name:      testCustomResourceName + "-" + strconv.Itoa(statefulSetNumberTwo),
 		Namespace: namespace,
 	},
-	Spec: cachev1beta1.CacheBackupRequestSpec{
-		InstanceName:      instanceName,
-		StatefulSetNumber: statefulSetNumberTwo,
-		CreatePVC:         false,
-		PvcStorageRequest: "1Gi",
+	Spec: cachev1.CacheBackupRequestSpec{
+		Target: cachev1.TargetSpec{
+			InstanceName: instanceName,
+			Ordinal:      statefulSetNumberTwo,
+		},
+		Schedule: cachev1.ScheduleSpec{
+			Interval: metav1.Duration{Duration: 1 * time.Minute},
+		},
+		SharedHomePVCName: sharedHomePVCName,
+		SharedHomePath:    sharedHomePath,
+		LocalHomePath:     localHomePath,
+		ConfigMapName:     configMapName,
+		PVC: cachev1.PVCSpec{
+			Create:         false,
+			StorageRequest: "1Gi",
+		},
 	},
 }
 
@@ -184,7 +226,7 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	err = cachev1beta1.AddToScheme(scheme.Scheme)
+	err = cachev1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:scheme
@@ -204,7 +246,8 @@ var _ = AfterSuite(func() {
 func init() {
 	// we need to add custom resource to known types for the fake client
 	s := scheme.Scheme
-	s.AddKnownTypes(cachev1beta1.GroupVersion, &cachev1beta1.CacheBackupRequest{})
+	s.AddKnownTypes(cachev1.GroupVersion, &cachev1.CacheBackupRequest{}, &cachev1.CacheBackupRequestList{},
+		&cachev1.ClusterCacheBackupPolicy{}, &cachev1.ClusterCacheBackupPolicyList{})
 }
 
 func TestRunningSucceededPod(t *testing.T) {
@@ -221,7 +264,7 @@ func TestRunningSucceededPod(t *testing.T) {
 	res, err := r.Reconcile(ctx, req)
 
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{RequeueAfter: 5 * time.Second}, res)
+	assert.Equal(t, reconcile.Result{RequeueAfter: podStatusRequeueInterval}, res)
 
 	// Check that the PVC was created.
 	createdPVC := &corev1.PersistentVolumeClaim{}
@@ -270,10 +313,13 @@ func TestRunningSucceededPod(t *testing.T) {
 	assert.Equal(t, int32(1), topologySpreadConstraintMaxSkew)
 	assert.Equal(t, "DoNotSchedule", string(topologySpreadConstraintWhenUnsatisfiable))
 
-	// check that custom resource status is Running
-	instance := &cachev1beta1.CacheBackupRequest{}
+	// check that custom resource phase is Running
+	instance := &cachev1.CacheBackupRequest{}
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: testCustomResourceName, Namespace: namespace}, instance)
-	assert.Equal(t, string(corev1.PodRunning), instance.Status.Status)
+	assert.Equal(t, cachev1.PhaseRunning, instance.Status.Phase)
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionRestoring))
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, cachev1.ConditionReady))
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionPVCAvailable))
 
 	// check if PVC has got expected labels
 	pvcLabels := createdPVC.Labels
@@ -316,11 +362,15 @@ func TestRunningSucceededPod(t *testing.T) {
 	res, err = r.Reconcile(ctx, req)
 
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{RequeueAfter: time.Duration(instance.Spec.BackupIntervalMinutes) * time.Minute}, res)
+	assert.Equal(t, reconcile.Result{RequeueAfter: instance.Spec.Schedule.Interval.Duration}, res)
 
-	// assert custom resource status has been updated to Succeeded
+	// assert custom resource phase has been updated to Succeeded and the request is Ready
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: testCustomResourceName, Namespace: namespace}, instance)
-	assert.Equal(t, string(corev1.PodSucceeded), instance.Status.Status)
+	assert.Equal(t, cachev1.PhaseSucceeded, instance.Status.Phase)
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionReady))
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, cachev1.ConditionRestoring))
+	assert.NotNil(t, instance.Status.LastSuccessfulTime)
+	assert.Equal(t, instance.Status.LastSuccessfulTime.Add(time.Minute), instance.Status.NextScheduledTime.Time)
 
 	// assert that IndexRestoreDurationSeconds is greater than 0
 	assert.Greater(t, instance.Status.IndexRestoreDurationSeconds, 0)
@@ -330,19 +380,17 @@ func TestRunningSucceededPod(t *testing.T) {
 	assert.Error(t, err)
 
 	// reconcile immediately to verify that the controller does not create a pod
-	// because BackupIntervalMinutes is set to 1 minute
+	// because the schedule interval is set to 1 minute, and requeues when the next run is due
 	res, err = r.Reconcile(ctx, req)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{RequeueAfter: time.Duration(instance.Spec.BackupIntervalMinutes) * time.Minute}, res)
-
-	// update custom resource status.LastTransactionTime to initiate creation of a new pre-warmer pod
-	// BackupIntervalMinutes is set to 1 minute, so we update the status LastTransactionTime to be 61 seconds behind
-	lastTransactionTime := instance.Status.LastTransactionTime
-	parsedTime, err := time.Parse(layout, lastTransactionTime)
-	assert.NoError(t, err)
-
-	timeInPast := parsedTime.Add(-61 * time.Second)
-	instance.Status.LastTransactionTime = timeInPast.Format(layout)
+	assert.Greater(t, res.RequeueAfter, time.Duration(0))
+	assert.LessOrEqual(t, res.RequeueAfter, instance.Spec.Schedule.Interval.Duration)
+
+	// update the ordinal status.LastSuccessfulTime to initiate creation of a new pre-warmer pod
+	// the schedule interval is set to 1 minute, so we update the status LastSuccessfulTime to be 61 seconds behind
+	assert.Len(t, instance.Status.Ordinals, 1)
+	timeInPast := metav1.NewTime(instance.Status.Ordinals[0].LastSuccessfulTime.Add(-61 * time.Second))
+	instance.Status.Ordinals[0].LastSuccessfulTime = &timeInPast
 	err = r.Client.Status().Update(ctx, instance)
 	assert.NoError(t, err)
 
@@ -350,17 +398,23 @@ func TestRunningSucceededPod(t *testing.T) {
 	r = &cacheBackupRequestReconcilerPodRunning
 	res, err = r.Reconcile(ctx, req)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{RequeueAfter: 5 * time.Second}, res)
+	assert.Equal(t, reconcile.Result{RequeueAfter: podStatusRequeueInterval}, res)
 
 	// Check that the pod was created.
 	createdPod = &corev1.Pod{}
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-local-home-" + instanceName + "-" + strconv.Itoa(statefulSetNumberOne), Namespace: namespace}, createdPod)
 	assert.NoError(t, err)
 
-	// check that custom resource status is Running
-	instance = &cachev1beta1.CacheBackupRequest{}
+	// check that custom resource phase is Running
+	instance = &cachev1.CacheBackupRequest{}
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: testCustomResourceName, Namespace: namespace}, instance)
-	assert.Equal(t, string(corev1.PodRunning), instance.Status.Status)
+	assert.Equal(t, cachev1.PhaseRunning, instance.Status.Phase)
+
+	// the request owns the pod so that its status changes trigger a reconcile
+	owner := metav1.GetControllerOf(createdPod)
+	if assert.NotNil(t, owner) {
+		assert.Equal(t, instance.UID, owner.UID)
+	}
 }
 
 func TestPVCDoesNotExist(t *testing.T) {
@@ -390,10 +444,226 @@ func TestPVCDoesNotExist(t *testing.T) {
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-local-home-" + instanceName + "-" + strconv.Itoa(statefulSetNumberTwo), Namespace: namespace}, createdPod)
 	assert.Error(t, err)
 
-	instance := &cachev1beta1.CacheBackupRequest{}
+	instance := &cachev1.CacheBackupRequest{}
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: testCustomResourceName + "-" + strconv.Itoa(statefulSetNumberTwo), Namespace: namespace}, instance)
 
-	assert.Equal(t, "PVCDoesNotExist", instance.Status.Status)
+	assert.Equal(t, cachev1.PhaseWaiting, instance.Status.Phase)
+	pvcAvailable := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionPVCAvailable)
+	assert.Equal(t, metav1.ConditionFalse, pvcAvailable.Status)
+	assert.Equal(t, cachev1.ReasonPVCNotFound, pvcAvailable.Reason)
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionDegraded))
+}
+
+// newSafetySnapshotRequest returns a request pre-warming ordinal with safety snapshots, and creates its local home PVC
+func newSafetySnapshotRequest(t *testing.T, name string, ordinal int32) *cachev1.CacheBackupRequest {
+	request := instanceCreatePVC.DeepCopy()
+	request.ObjectMeta = metav1.ObjectMeta{Name: testCustomResourceName + "-" + name, Namespace: namespace}
+	request.Spec.Target.Ordinal = ordinal
+	request.Spec.SafetySnapshot = &cachev1.SafetySnapshotSpec{VolumeSnapshotClassName: "csi-snapclass", Retain: 2}
+
+	pvc, err := GetNewPVC(request, "local-home-"+instanceName+"-"+strconv.Itoa(int(ordinal)), nil)
+	assert.NoError(t, err)
+	_, err = testClient.CoreV1().PersistentVolumeClaims(namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Create(context.TODO(), pvc))
+	return request
+}
+
+// newFakeVolumeSnapshot returns a safety snapshot as the external-snapshotter would report it
+func newFakeVolumeSnapshot(name, pvcName, requestName string, readyToUse bool) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"volumeSnapshotClassName": "csi-snapclass",
+			"source":                  map[string]interface{}{"persistentVolumeClaimName": pvcName},
+		},
+		"status": map[string]interface{}{"readyToUse": readyToUse, "restoreSize": "5Gi"},
+	}}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(name)
+	snapshot.SetNamespace(namespace)
+	snapshot.SetLabels(map[string]string{safetySnapshotLabel: "true"})
+	snapshot.SetAnnotations(map[string]string{safetySnapshotRequestAnnotation: requestName})
+	return snapshot
+}
+
+func TestSafetySnapshotBeforePreWarming(t *testing.T) {
+	request := newSafetySnapshotRequest(t, "safety-snapshot", 7)
+	pvcName := "local-home-" + instanceName + "-7"
+	ctx := context.Background()
+	assert.NoError(t, fakeClient.Create(ctx, request))
+	for _, snapshot := range []*unstructured.Unstructured{
+		newFakeVolumeSnapshot(pvcName+"-20230301020000", pvcName, request.Name, true),
+		newFakeVolumeSnapshot(pvcName+"-20230302020000", pvcName, request.Name, true),
+		newFakeVolumeSnapshot("local-home-"+instanceName+"-70-20230301020000", "local-home-"+instanceName+"-70", request.Name, true),
+	} {
+		assert.NoError(t, fakeClient.Create(ctx, snapshot))
+	}
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: request.Name, Namespace: namespace}}
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 5 * time.Second}, res)
+
+	// the pod waits for the snapshot
+	podName := types.NamespacedName{Name: "prewarm-" + pvcName, Namespace: namespace}
+	assert.True(t, errors.IsNotFound(fakeClient.Get(ctx, podName, &corev1.Pod{})))
+	instance := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	assert.Equal(t, cachev1.PhasePending, instance.Status.Phase)
+	taken := instance.Status.Ordinals[0].SafetySnapshot
+	assert.NotNil(t, taken)
+	assert.False(t, taken.ReadyToUse)
+	snapshotReady := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionSafetySnapshotReady)
+	assert.Equal(t, metav1.ConditionFalse, snapshotReady.Status)
+	assert.Equal(t, cachev1.ReasonSafetySnapshotPending, snapshotReady.Reason)
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: taken.Name, Namespace: namespace}, snapshot))
+	source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	assert.Equal(t, pvcName, source)
+	className, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+	assert.Equal(t, "csi-snapclass", className)
+	assert.Equal(t, request.Name, snapshot.GetAnnotations()[safetySnapshotRequestAnnotation])
+
+	// once the snapshot is ready the pod is created and the oldest snapshot of the PVC is deleted
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse"))
+	assert.NoError(t, fakeClient.Update(ctx, snapshot))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Get(ctx, podName, &corev1.Pod{}))
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	assert.True(t, instance.Status.Ordinals[0].SafetySnapshot.ReadyToUse)
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionSafetySnapshotReady))
+
+	snapshots := &unstructured.UnstructuredList{}
+	snapshots.SetGroupVersionKind(volumeSnapshotGVK.GroupVersion().WithKind("VolumeSnapshotList"))
+	assert.NoError(t, fakeClient.List(ctx, snapshots, client.InNamespace(namespace)))
+	var names []string
+	for _, snapshot := range snapshots.Items {
+		names = append(names, snapshot.GetName())
+	}
+	assert.ElementsMatch(t, []string{taken.Name, pvcName + "-20230302020000", "local-home-" + instanceName + "-70-20230301020000"}, names)
+
+	// no other snapshot is taken while the pod exists
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.List(ctx, snapshots, client.InNamespace(namespace)))
+	assert.Len(t, snapshots.Items, 3)
+}
+
+func TestFailedSafetySnapshotIsDegraded(t *testing.T) {
+	request := newSafetySnapshotRequest(t, "failed-safety-snapshot", 8)
+	pvcName := "local-home-" + instanceName + "-8"
+	request.Status.Ordinals = []cachev1.OrdinalStatus{{
+		Ordinal:        8,
+		Phase:          cachev1.PhasePending,
+		SafetySnapshot: &cachev1.SafetySnapshotStatus{Name: pvcName + "-20230301020000"},
+	}}
+	ctx := context.Background()
+	assert.NoError(t, fakeClient.Create(ctx, request))
+	snapshot := newFakeVolumeSnapshot(pvcName+"-20230301020000", pvcName, request.Name, false)
+	assert.NoError(t, unstructured.SetNestedField(snapshot.Object, "VolumeSnapshotClass csi-snapclass not found", "status", "error", "message"))
+	assert.NoError(t, fakeClient.Create(ctx, snapshot))
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: request.Name, Namespace: namespace}}
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 1 * time.Minute}, res)
+	assert.True(t, errors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-" + pvcName, Namespace: namespace}, &corev1.Pod{})))
+
+	instance := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	assert.Equal(t, cachev1.PhaseFailed, instance.Status.Phase)
+	degraded := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded)
+	assert.Equal(t, metav1.ConditionTrue, degraded.Status)
+	assert.Equal(t, cachev1.ReasonSafetySnapshotFailed, degraded.Reason)
+	assert.Equal(t, "VolumeSnapshot "+pvcName+"-20230301020000 of PVC "+pvcName+" has failed: VolumeSnapshotClass csi-snapclass not found. Delete it to take another one", degraded.Message)
+}
+
+func TestRestoreSafetySnapshotRecreatesPVC(t *testing.T) {
+	request := newSafetySnapshotRequest(t, "restore-safety-snapshot", 9)
+	request.Spec.SafetySnapshot = nil
+	request.Spec.Suspend = true
+	request.Spec.RestoreSafetySnapshot = &cachev1.SafetySnapshotRestoreRequest{VolumeSnapshotName: "missing", Token: "1"}
+	pvcName := "local-home-" + instanceName + "-9"
+	snapshotName := pvcName + "-20230301020000"
+	ctx := context.Background()
+	assert.NoError(t, fakeClient.Create(ctx, request))
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: request.Name, Namespace: namespace}}
+	_, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	instance := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	degraded := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded)
+	assert.Equal(t, cachev1.ReasonSafetySnapshotNotFound, degraded.Reason)
+
+	// a safety snapshot taken for another request is not restored
+	foreignSnapshotName := pvcName + "-20230228020000"
+	assert.NoError(t, fakeClient.Create(ctx, newFakeVolumeSnapshot(foreignSnapshotName, pvcName, "another-request", true)))
+	instance.Spec.RestoreSafetySnapshot.VolumeSnapshotName = foreignSnapshotName
+	assert.NoError(t, fakeClient.Update(ctx, instance))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	degraded = meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded)
+	assert.Equal(t, cachev1.ReasonInvalidSpec, degraded.Reason)
+	assert.Regexp(t, "taken for request another-request", degraded.Message)
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: namespace}, &corev1.PersistentVolumeClaim{}))
+
+	// the PVC is not deleted while a pre-warmer pod uses it
+	assert.NoError(t, fakeClient.Create(ctx, newFakeVolumeSnapshot(snapshotName, pvcName, request.Name, true)))
+	prewarmer := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "prewarm-" + pvcName, Namespace: namespace}}
+	assert.NoError(t, fakeClient.Create(ctx, prewarmer))
+	instance.Spec.RestoreSafetySnapshot.VolumeSnapshotName = snapshotName
+	assert.NoError(t, fakeClient.Update(ctx, instance))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	degraded = meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded)
+	assert.Equal(t, cachev1.ReasonPVCInUse, degraded.Reason)
+	pvc := &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: namespace}, pvc))
+
+	// the PVC is deleted, then created again from the snapshot
+	assert.NoError(t, fakeClient.Delete(ctx, prewarmer))
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 5 * time.Second}, res)
+	assert.True(t, errors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: namespace}, pvc)))
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	assert.Equal(t, snapshotName, instance.Status.LastSafetySnapshotRestore.VolumeSnapshotName)
+	assert.Equal(t, pvcName, instance.Status.LastSafetySnapshotRestore.PVCName)
+	assert.Nil(t, instance.Status.LastSafetySnapshotRestore.CompletedAt)
+
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	pvc = &corev1.PersistentVolumeClaim{}
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: namespace}, pvc))
+	apiGroup := "snapshot.storage.k8s.io"
+	assert.Equal(t, &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: "VolumeSnapshot", Name: snapshotName}, pvc.Spec.DataSource)
+	assert.Empty(t, pvc.Spec.VolumeName)
+	assert.Equal(t, resource.MustParse("5Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+	assert.Equal(t, "1", pvc.Annotations[restoreTokenAnnotation])
+
+	res, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 1 * time.Second}, res)
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	assert.NotNil(t, instance.Status.LastSafetySnapshotRestore.CompletedAt)
+	assert.Nil(t, pendingSafetySnapshotRestore(instance))
+
+	// pre-warming resumes with the request
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	instance.Spec.Suspend = false
+	assert.NoError(t, fakeClient.Update(ctx, instance))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-" + pvcName, Namespace: namespace}, &corev1.Pod{}))
 }
 
 func TestPVCBeingCurrentlyUsed(t *testing.T) {
@@ -409,7 +679,8 @@ func TestPVCBeingCurrentlyUsed(t *testing.T) {
 
 	ctx := context.Background()
 
-	existingPVC := GetNewPVC(sampleBackupRequest, "local-home-"+instanceName+"-"+strconv.Itoa(statefulSetNumberTwo))
+	existingPVC, err := GetNewPVC(sampleBackupRequest, "local-home-"+instanceName+"-"+strconv.Itoa(statefulSetNumberTwo), nil)
+	assert.NoError(t, err)
 	err = fakeClient.Create(ctx, existingPVC)
 	assert.NoError(t, err)
 
@@ -457,3 +728,1145 @@ func TestPVCBeingCurrentlyUsed(t *testing.T) {
 	err = fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-local-home-" + instanceName + "-" + strconv.Itoa(statefulSetNumberTwo), Namespace: namespace}, createdPod)
 	assert.Error(t, err)
 }
+
+func TestInvalidSpecIsDegraded(t *testing.T) {
+	invalidRequest := instanceCreatePVC.DeepCopy()
+	invalidRequest.ObjectMeta = metav1.ObjectMeta{
+		Name:      testCustomResourceName + "-invalid",
+		Namespace: namespace,
+	}
+	invalidRequest.Spec.Target.Ordinal = 3
+	invalidRequest.Spec.PVC.StorageRequest = "200 GB"
+	err := fakeClient.Create(context.TODO(), invalidRequest)
+	assert.NoError(t, err)
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      invalidRequest.Name,
+			Namespace: namespace,
+		},
+	}
+	ctx := context.Background()
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, res)
+
+	// neither the PVC nor the pod are created
+	createdPVC := &corev1.PersistentVolumeClaim{}
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "local-home-" + instanceName + "-3", Namespace: namespace}, createdPVC)
+	assert.Error(t, err)
+
+	instance := &cachev1.CacheBackupRequest{}
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	degraded := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded)
+	assert.Equal(t, metav1.ConditionTrue, degraded.Status)
+	assert.Equal(t, cachev1.ReasonInvalidSpec, degraded.Reason)
+	assert.Contains(t, degraded.Message, "spec.pvc.storageRequest")
+}
+
+func TestBlackoutWindowDefersFirstRun(t *testing.T) {
+	request := instanceCreatePVC.DeepCopy()
+	request.ObjectMeta = metav1.ObjectMeta{
+		Name:      testCustomResourceName + "-blackout",
+		Namespace: namespace,
+	}
+	request.Spec.Target.Ordinal = 4
+	request.Spec.Schedule = cachev1.ScheduleSpec{Cron: "@daily", TimeZone: "Europe/Amsterdam"}
+	// a window that lasts the whole day, every day of the week
+	request.Spec.BlackoutWindows = []cachev1.TimeWindow{{Start: "00:00", End: "00:00"}}
+	err := fakeClient.Create(context.TODO(), request)
+	assert.NoError(t, err)
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      request.Name,
+			Namespace: namespace,
+		},
+	}
+	ctx := context.Background()
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: time.Hour}, res)
+
+	// neither the PVC nor the pod are created
+	createdPVC := &corev1.PersistentVolumeClaim{}
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "local-home-" + instanceName + "-4", Namespace: namespace}, createdPVC)
+	assert.Error(t, err)
+
+	// only allowing Sundays schedules the first run for next Sunday
+	instance := &cachev1.CacheBackupRequest{}
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.Nil(t, instance.Status.NextScheduledTime)
+	instance.Spec.BlackoutWindows[0].Days = []cachev1.DayOfWeek{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+	err = fakeClient.Update(ctx, instance)
+	assert.NoError(t, err)
+
+	if time.Now().In(mustLoadLocation(t, "Europe/Amsterdam")).Weekday() == time.Sunday {
+		return
+	}
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.NotNil(t, instance.Status.NextScheduledTime)
+	next := instance.Status.NextScheduledTime.In(mustLoadLocation(t, "Europe/Amsterdam"))
+	assert.Equal(t, time.Sunday, next.Weekday())
+	assert.Equal(t, 0, next.Hour())
+	assert.Equal(t, "", string(instance.Status.Phase))
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	assert.NoError(t, err)
+	return loc
+}
+
+func TestRunNowAnnotationStartsRunAheadOfSchedule(t *testing.T) {
+	request := instanceCreatePVC.DeepCopy()
+	request.ObjectMeta = metav1.ObjectMeta{
+		Name:      testCustomResourceName + "-run-now",
+		Namespace: namespace,
+		Annotations: map[string]string{
+			cachev1.RunNowAnnotation:            "1",
+			cachev1.RunNowRequestedByAnnotation: "admin",
+			cachev1.RunNowRequestedAtAnnotation: "2023-03-01T10:00:00Z",
+		},
+	}
+	request.Spec.Target.Ordinal = 5
+	lastSuccessfulTime := metav1.Now()
+	request.Status = cachev1.CacheBackupRequestStatus{
+		Phase:              cachev1.PhaseSucceeded,
+		LastSuccessfulTime: &lastSuccessfulTime,
+		Ordinals: []cachev1.OrdinalStatus{{
+			Ordinal:            5,
+			Phase:              cachev1.PhaseSucceeded,
+			LastSuccessfulTime: &lastSuccessfulTime,
+		}},
+	}
+	err := fakeClient.Create(context.TODO(), request)
+	assert.NoError(t, err)
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      request.Name,
+			Namespace: namespace,
+		},
+	}
+	ctx := context.Background()
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: podStatusRequeueInterval}, res)
+
+	// the pod is created although the last run succeeded less than a minute ago
+	createdPod := &corev1.Pod{}
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-local-home-" + instanceName + "-5", Namespace: namespace}, createdPod)
+	assert.NoError(t, err)
+
+	instance := &cachev1.CacheBackupRequest{}
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.PhaseRunning, instance.Status.Phase)
+	assert.NotNil(t, instance.Status.LastRunRequest)
+	assert.Equal(t, "1", instance.Status.LastRunRequest.Token)
+	assert.Equal(t, "admin", instance.Status.LastRunRequest.RequestedBy)
+	assert.Equal(t, "2023-03-01T10:00:00Z", instance.Status.LastRunRequest.RequestedAt.UTC().Format(time.RFC3339))
+	assert.False(t, instance.Status.LastRunRequest.StartedAt.IsZero())
+	assert.Nil(t, pendingRunRequest(instance))
+
+	// a new token is only acknowledged once the run in progress completes
+	instance.Annotations[cachev1.RunNowAnnotation] = "2"
+	err = fakeClient.Update(ctx, instance)
+	assert.NoError(t, err)
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", instance.Status.LastRunRequest.Token)
+	assert.NotNil(t, pendingRunRequest(instance))
+}
+
+func TestSuspendAndEmergencyStop(t *testing.T) {
+	request := instanceCreatePVC.DeepCopy()
+	request.ObjectMeta = metav1.ObjectMeta{
+		Name:      testCustomResourceName + "-suspend",
+		Namespace: namespace,
+	}
+	request.Spec.Target.Ordinal = 6
+	request.Spec.Suspend = true
+	err := fakeClient.Create(context.TODO(), request)
+	assert.NoError(t, err)
+
+	r := cacheBackupRequestReconcilerPodRunning
+	r.EmergencyStop = EmergencyStop{ConfigMap: types.NamespacedName{Name: "emergency-stop", Namespace: "operator"}}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      request.Name,
+			Namespace: namespace,
+		},
+	}
+	ctx := context.Background()
+	podName := types.NamespacedName{Name: "prewarm-local-home-" + instanceName + "-6", Namespace: namespace}
+
+	// a suspended request does not create a pod
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, res)
+	err = fakeClient.Get(ctx, podName, &corev1.Pod{})
+	assert.Error(t, err)
+	instance := &cachev1.CacheBackupRequest{}
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	suspended := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionSuspended)
+	assert.Equal(t, metav1.ConditionTrue, suspended.Status)
+	assert.Equal(t, cachev1.ReasonSuspended, suspended.Reason)
+
+	// the emergency stop ConfigMap takes precedence over resuming the request
+	emergencyStop := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "emergency-stop", Namespace: "operator"},
+		Data:       map[string]string{EmergencyStopConfigMapKey: "INC-42"},
+	}
+	err = fakeClient.Create(ctx, emergencyStop)
+	assert.NoError(t, err)
+	assert.Equal(t, []reconcile.Request{req}, filterRequests(r.requestsForEmergencyStop(emergencyStop), req))
+	assert.Empty(t, r.requestsForEmergencyStop(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "copy-index", Namespace: "operator"}}))
+
+	instance.Spec.Suspend = false
+	err = fakeClient.Update(ctx, instance)
+	assert.NoError(t, err)
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, podName, &corev1.Pod{})
+	assert.Error(t, err)
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	suspended = meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionSuspended)
+	assert.Equal(t, metav1.ConditionTrue, suspended.Status)
+	assert.Equal(t, cachev1.ReasonEmergencyStop, suspended.Reason)
+	assert.Contains(t, suspended.Message, "INC-42")
+
+	// deleting the ConfigMap resumes pre-warming
+	err = fakeClient.Delete(ctx, emergencyStop)
+	assert.NoError(t, err)
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, podName, &corev1.Pod{})
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.True(t, meta.IsStatusConditionFalse(instance.Status.Conditions, cachev1.ConditionSuspended))
+	assert.Equal(t, cachev1.PhaseRunning, instance.Status.Phase)
+
+	// the pod started before the emergency stop is still observed and deleted once it succeeds
+	emergencyStop.ResourceVersion = ""
+	err = fakeClient.Create(ctx, emergencyStop)
+	assert.NoError(t, err)
+	r = cacheBackupRequestReconcilerPodSucceeded
+	r.EmergencyStop = EmergencyStop{ConfigMap: types.NamespacedName{Name: "emergency-stop", Namespace: "operator"}}
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.True(t, errors.IsNotFound(fakeClient.Get(ctx, podName, &corev1.Pod{})))
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionSuspended))
+	assert.Equal(t, cachev1.PhaseSucceeded, instance.Status.Phase)
+
+	// but no new pod is created while it is stopped
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.True(t, errors.IsNotFound(fakeClient.Get(ctx, podName, &corev1.Pod{})))
+	assert.NoError(t, fakeClient.Delete(ctx, emergencyStop))
+}
+
+func TestEmergencyStopFlag(t *testing.T) {
+	emergencyStop := EmergencyStop{Enabled: true}
+	stopped, message, err := emergencyStop.Active(context.Background(), fakeClient)
+	assert.NoError(t, err)
+	assert.True(t, stopped)
+	assert.Contains(t, message, "--emergency-stop")
+}
+
+func TestStatefulSetRefPreWarmsEveryOrdinal(t *testing.T) {
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wiki",
+			Namespace: namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "wiki"}},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "confluence",
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "shared-home", MountPath: sharedHomePath},
+							{Name: "local-home", MountPath: localHomePath},
+						},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "local-home"},
+			}},
+		},
+	}
+	_, err := testClient.AppsV1().StatefulSets(namespace).Create(context.TODO(), sts, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	request := instanceCreatePVC.DeepCopy()
+	request.ObjectMeta = metav1.ObjectMeta{
+		Name:      testCustomResourceName + "-statefulset",
+		Namespace: namespace,
+	}
+	request.Spec.Target = cachev1.TargetSpec{}
+	request.Spec.StatefulSetRef = &cachev1.StatefulSetRef{
+		Name:            sts.Name,
+		ExcludeOrdinals: []int32{1},
+	}
+	err = fakeClient.Create(context.TODO(), request)
+	assert.NoError(t, err)
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      request.Name,
+			Namespace: namespace,
+		},
+	}
+	ctx := context.Background()
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: podStatusRequeueInterval}, res)
+
+	// a pod is created for every ordinal but the excluded one
+	for _, ordinal := range []string{"0", "2"} {
+		createdPod := &corev1.Pod{}
+		err = fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-local-home-wiki-" + ordinal, Namespace: namespace}, createdPod)
+		assert.NoError(t, err)
+	}
+	err = fakeClient.Get(ctx, types.NamespacedName{Name: "prewarm-local-home-wiki-1", Namespace: namespace}, &corev1.Pod{})
+	assert.Error(t, err)
+
+	instance := &cachev1.CacheBackupRequest{}
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.PhaseRunning, instance.Status.Phase)
+	assert.Empty(t, instance.Status.PVCName)
+	assert.Len(t, instance.Status.Ordinals, 2)
+	for i, ordinal := range []int32{0, 2} {
+		assert.Equal(t, ordinal, instance.Status.Ordinals[i].Ordinal)
+		assert.Equal(t, "local-home-wiki-"+strconv.Itoa(int(ordinal)), instance.Status.Ordinals[i].PVCName)
+		assert.Equal(t, cachev1.PhaseRunning, instance.Status.Ordinals[i].Phase)
+		assert.True(t, meta.IsStatusConditionTrue(instance.Status.Ordinals[i].Conditions, cachev1.ConditionRestoring))
+	}
+	assert.True(t, meta.IsStatusConditionTrue(instance.Status.Conditions, cachev1.ConditionRestoring))
+
+	// a missing StatefulSet degrades the request
+	request = request.DeepCopy()
+	request.ObjectMeta = metav1.ObjectMeta{
+		Name:      testCustomResourceName + "-statefulset-missing",
+		Namespace: namespace,
+	}
+	request.Status = cachev1.CacheBackupRequestStatus{}
+	request.Spec.StatefulSetRef = &cachev1.StatefulSetRef{Name: "missing"}
+	err = fakeClient.Create(context.TODO(), request)
+	assert.NoError(t, err)
+	req.Name = request.Name
+	res, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 1 * time.Minute}, res)
+	err = fakeClient.Get(ctx, req.NamespacedName, instance)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.PhaseWaiting, instance.Status.Phase)
+	degraded := meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded)
+	assert.NotNil(t, degraded)
+	assert.Equal(t, metav1.ConditionTrue, degraded.Status)
+	assert.Equal(t, cachev1.ReasonStatefulSetNotFound, degraded.Reason)
+}
+
+func TestPVCNameFromTemplateOrStatefulSet(t *testing.T) {
+	ctx := context.Background()
+	r := &cacheBackupRequestReconcilerPodRunning
+
+	// the claim template of the StatefulSet named after the release is used without a pvcNameTemplate
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "renamed", Namespace: namespace},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         "confluence",
+						VolumeMounts: []corev1.VolumeMount{{Name: "home", MountPath: localHomePath + "/"}},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "home"}}},
+		},
+	}
+	_, err := testClient.AppsV1().StatefulSets(namespace).Create(ctx, sts, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.Target = cachev1.TargetSpec{InstanceName: "renamed", Ordinal: 2}
+	targets, err := r.targets(ctx, cr)
+	assert.NoError(t, err)
+	assert.Len(t, targets.ordinals, 1)
+	assert.Equal(t, "home-renamed-2", targets.ordinals[0].pvcName)
+
+	// pvcNameTemplate takes precedence
+	cr.Spec.PVCNameTemplate = "data-{{ .InstanceName }}-{{ .Ordinal }}"
+	targets, err = r.targets(ctx, cr)
+	assert.NoError(t, err)
+	assert.Len(t, targets.ordinals, 1)
+	assert.Equal(t, "data-renamed-2", targets.ordinals[0].pvcName)
+
+	// the default chart name is used when there is no StatefulSet named after the release
+	cr.Spec.PVCNameTemplate = ""
+	cr.Spec.Target.InstanceName = instanceName
+	targets, err = r.targets(ctx, cr)
+	assert.NoError(t, err)
+	assert.Len(t, targets.ordinals, 1)
+	assert.Equal(t, "local-home-confluence-2", targets.ordinals[0].pvcName)
+
+	// a template that does not execute degrades the request
+	cr.Spec.PVCNameTemplate = "data-{{ .Release }}"
+	_, err = r.targets(ctx, cr)
+	targetErr, ok := err.(*targetError)
+	assert.True(t, ok)
+	assert.Equal(t, cachev1.ReasonInvalidSpec, targetErr.reason)
+}
+
+func TestGetNewPVCFromVolumeClaimTemplate(t *testing.T) {
+	storageClassName := "gp3"
+	sts := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "wiki"}},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         "confluence",
+						VolumeMounts: []corev1.VolumeMount{{Name: "local-home", MountPath: localHomePath}},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "local-home",
+					Labels:      map[string]string{"tier": "cache"},
+					Annotations: map[string]string{"backup": "false"},
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOncePod},
+					StorageClassName: &storageClassName,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("50Gi")},
+					},
+				},
+			}},
+		},
+	}
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.PVC = cachev1.PVCSpec{
+		Create:                  true,
+		FromVolumeClaimTemplate: true,
+		Labels:                  map[string]string{"tier": "prewarmed"},
+	}
+
+	pvc, err := GetNewPVC(cr, "local-home-wiki-0", localHomeClaimTemplate(sts, localHomePath))
+	assert.NoError(t, err)
+	assert.Equal(t, "local-home-wiki-0", pvc.Name)
+	assert.Equal(t, map[string]string{"app": "wiki", "tier": "prewarmed"}, pvc.Labels)
+	assert.Equal(t, map[string]string{"backup": "false"}, pvc.Annotations)
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOncePod}, pvc.Spec.AccessModes)
+	assert.Equal(t, &storageClassName, pvc.Spec.StorageClassName)
+	assert.Equal(t, resource.MustParse("50Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+
+	// pvc fields override the template
+	cr.Spec.PVC.StorageRequest = "100Gi"
+	cr.Spec.PVC.StorageClassName = "io2"
+	pvc, err = GetNewPVC(cr, "local-home-wiki-0", localHomeClaimTemplate(sts, localHomePath))
+	assert.NoError(t, err)
+	assert.Equal(t, "io2", *pvc.Spec.StorageClassName)
+	assert.Equal(t, resource.MustParse("100Gi"), pvc.Spec.Resources.Requests[corev1.ResourceStorage])
+	assert.Equal(t, resource.MustParse("50Gi"), sts.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage])
+
+	_, err = GetNewPVC(cr, "local-home-wiki-0", nil)
+	assert.Error(t, err)
+}
+
+func TestInheritFromStatefulSet(t *testing.T) {
+	ctx := context.Background()
+	runAsUser := int64(2002)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "inherited", Namespace: namespace},
+		Spec: appsv1.StatefulSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					SecurityContext:  &corev1.PodSecurityContext{FSGroup: &runAsUser},
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+					NodeSelector:     map[string]string{"pool": "confluence"},
+					Affinity: &corev1.Affinity{
+						NodeAffinity:    &corev1.NodeAffinity{},
+						PodAntiAffinity: &corev1.PodAntiAffinity{},
+					},
+					Containers: []corev1.Container{{
+						Name:            "confluence",
+						Image:           "atlassian/confluence:8.5.1",
+						ImagePullPolicy: corev1.PullAlways,
+						SecurityContext: &corev1.SecurityContext{RunAsUser: &runAsUser},
+						Env: []corev1.EnvVar{
+							{Name: "SHARED_HOME", Value: "/shared"},
+							{Name: "LOCAL_HOME", Value: "/local"},
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "nfs", MountPath: "/shared", SubPath: "confluence"},
+							{Name: "local-home", MountPath: "/local", SubPath: "confluence"},
+						},
+					}},
+					Volumes: []corev1.Volume{{
+						Name:         "nfs",
+						VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/export"}},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "local-home"}}},
+		},
+	}
+	_, err := testClient.AppsV1().StatefulSets(namespace).Create(ctx, sts, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.Target = cachev1.TargetSpec{InstanceName: "inherited", Ordinal: 0}
+	cr.Spec.InheritFromStatefulSet = true
+	cr.Spec.PodTemplate = cachev1.PreWarmerPodTemplate{}
+	targets, err := cacheBackupRequestReconcilerPodRunning.targets(ctx, cr)
+	assert.NoError(t, err)
+	assert.Equal(t, "/shared", cr.Spec.SharedHomePath)
+	assert.Equal(t, "/local", cr.Spec.LocalHomePath)
+	assert.Equal(t, "local-home-inherited-0", targets.ordinals[0].pvcName)
+
+	pod, err := GetNewPreWarmerPod(cr, targets.ordinals[0].pvcName, targets.statefulSet, "")
+	assert.NoError(t, err)
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "atlassian/confluence:8.5.1", container.Image)
+	assert.Equal(t, corev1.PullAlways, container.ImagePullPolicy)
+	assert.Equal(t, &runAsUser, container.SecurityContext.RunAsUser)
+	assert.Equal(t, &runAsUser, pod.Spec.SecurityContext.FSGroup)
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry"}}, pod.Spec.ImagePullSecrets)
+	assert.Equal(t, map[string]string{"pool": "confluence"}, pod.Spec.NodeSelector)
+	assert.NotNil(t, pod.Spec.Affinity.NodeAffinity)
+	assert.Nil(t, pod.Spec.Affinity.PodAntiAffinity)
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "SHARED_HOME", Value: "/shared"})
+	assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "shared-home", MountPath: "/shared", SubPath: "confluence"})
+	assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "local-home", MountPath: "/local", SubPath: "confluence"})
+	assert.Contains(t, pod.Spec.Volumes, corev1.Volume{Name: "shared-home", VolumeSource: sts.Spec.Template.Spec.Volumes[0].VolumeSource})
+
+	// a missing StatefulSet cannot be inherited from
+	cr.Spec.Target.InstanceName = "missing"
+	_, err = cacheBackupRequestReconcilerPodRunning.targets(ctx, cr)
+	targetErr, ok := err.(*targetError)
+	assert.True(t, ok)
+	assert.Equal(t, cachev1.ReasonStatefulSetNotFound, targetErr.reason)
+}
+
+func TestPreWarmerPodRunsBuiltInRestore(t *testing.T) {
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.ConfigMapName = ""
+	pod, err := GetNewPreWarmerPod(cr, "local-home-confluence-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "operator:1.0", container.Image)
+	assert.Equal(t, []string{"/manager", "prewarm"}, container.Command)
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "LOCAL_HOME", Value: localHomePath})
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "INDEX_SNAPSHOTS_PATH", Value: cr.Spec.IndexSnapshotsPath})
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "REQUIRE_MANIFEST", Value: "false"})
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "VERIFY_INDEX", Value: "false"})
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "KEEP_PREVIOUS_INDEXES", Value: "0"})
+	for _, volume := range pod.Spec.Volumes {
+		assert.NotEqual(t, "copy-index", volume.Name)
+	}
+
+	// the image of the StatefulSet cannot run the built-in restore
+	cr.Spec.InheritFromStatefulSet = true
+	sts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "confluence", Image: "atlassian/confluence:8.5.1", ImagePullPolicy: corev1.PullNever}},
+	}}}}
+	pod, err = GetNewPreWarmerPod(cr, "local-home-confluence-1", sts, "operator:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "operator:1.0", pod.Spec.Containers[0].Image)
+	assert.Empty(t, pod.Spec.Containers[0].ImagePullPolicy)
+
+	_, err = GetNewPreWarmerPod(cr, "local-home-confluence-1", nil, "")
+	assert.Error(t, err)
+
+	// the snapshot layout is passed to the restore
+	cr.Spec.IndexSnapshotsPath = sharedHomePath + "/snapshots"
+	cr.Spec.SnapshotLayout.MainIndex = "main-*.zip"
+	pod, err = GetNewPreWarmerPod(cr, "local-home-confluence-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "INDEX_SNAPSHOTS_PATH", Value: sharedHomePath + "/snapshots"})
+	assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "MAIN_INDEX_SNAPSHOT", Value: "main-*.zip"})
+
+	// the ConfigMap script runs in the product image
+	cr.Spec.ConfigMapName = configMapName
+	pod, err = GetNewPreWarmerPod(cr, "local-home-confluence-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "atlassian/confluence:8.0.3", pod.Spec.Containers[0].Image)
+	assert.Equal(t, []string{"/opt/script/copy-index.sh"}, pod.Spec.Containers[0].Command)
+	assert.Contains(t, pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "copy-index", MountPath: "/opt/script"})
+}
+
+func TestJiraPreWarmerPod(t *testing.T) {
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.Product = cachev1.ProductJira
+	cr.Spec.LocalHomePath = ""
+	cr.Spec.IndexSnapshotsPath = ""
+	cr.Spec.SnapshotLayout = cachev1.SnapshotLayout{}
+	cachev1.ConfluenceDefaults().Apply(cr)
+	assert.Equal(t, "/var/atlassian/application-data/jira", cr.Spec.LocalHomePath)
+	assert.Equal(t, sharedHomePath+"/export/indexsnapshots", cr.Spec.IndexSnapshotsPath)
+	assert.Equal(t, cachev1.SnapshotLayout{MainIndex: "IndexSnapshot_*.zip"}, cr.Spec.SnapshotLayout)
+
+	pod, err := GetNewPreWarmerPod(cr, "local-home-jira-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2001), *pod.Spec.SecurityContext.RunAsUser)
+	assert.Equal(t, int64(2001), *pod.Spec.SecurityContext.FSGroup)
+	assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "PRODUCT", Value: "jira"})
+	assert.Equal(t, "atlassian/jira-software:9.4.3", pod.Spec.Containers[0].Image)
+}
+
+func TestPreWarmerPodMountsVerificationKey(t *testing.T) {
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.ConfigMapName = ""
+	cr.Spec.Verification = &cachev1.VerificationSpec{PublicKeySecretRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "snapshot-signing"},
+		Key:                  "ed25519.pub",
+	}}
+	pod, err := GetNewPreWarmerPod(cr, "local-home-wiki-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	container := pod.Spec.Containers[0]
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "PUBLIC_KEY_FILE", Value: "/etc/pre-warmer/verification/public-key.pem"})
+	assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "verification-key", MountPath: "/etc/pre-warmer/verification", ReadOnly: true})
+	assert.Contains(t, pod.Spec.Volumes, corev1.Volume{
+		Name: "verification-key",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+			SecretName: "snapshot-signing",
+			Items:      []corev1.KeyToPath{{Key: "ed25519.pub", Path: "public-key.pem"}},
+		}},
+	})
+}
+
+func TestPreWarmerPodRollsBack(t *testing.T) {
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.ConfigMapName = ""
+	cr.Spec.KeepPreviousIndexes = 2
+	cr.Spec.RollbackTo = &cachev1.RollbackRequest{Generation: 1, Token: "bad-snapshot"}
+	pod, err := GetNewPreWarmerPod(cr, "local-home-wiki-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "KEEP_PREVIOUS_INDEXES", Value: "2"})
+	assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "ROLLBACK_TO", Value: "1"})
+
+	// a rollback runs once per token
+	cr.Status.LastRollback = &cachev1.RollbackStatus{Generation: 1, Token: "bad-snapshot"}
+	pod, err = GetNewPreWarmerPod(cr, "local-home-wiki-1", nil, "operator:1.0")
+	assert.NoError(t, err)
+	for _, env := range pod.Spec.Containers[0].Env {
+		assert.NotEqual(t, "ROLLBACK_TO", env.Name)
+	}
+	assert.Nil(t, pendingRollback(cr))
+}
+
+func TestOperatorImage(t *testing.T) {
+	ctx := context.Background()
+	operatorPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator-0", Namespace: "operator"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "proxy", Image: "proxy:1.0"},
+			{Name: "manager", Image: "operator:1.0", Command: []string{"/manager"}},
+		}},
+	}
+	_, err := testClient.CoreV1().Pods("operator").Create(ctx, operatorPod, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	image, err := OperatorImage(ctx, testClient, "operator", "operator-0")
+	assert.NoError(t, err)
+	assert.Equal(t, "operator:1.0", image)
+
+	_, err = OperatorImage(ctx, testClient, "operator", "")
+	assert.Error(t, err)
+	_, err = OperatorImage(ctx, testClient, "operator", "missing")
+	assert.Error(t, err)
+}
+
+func TestPreWarmerPodIsRestricted(t *testing.T) {
+	pod, err := GetNewPreWarmerPod(instanceCreatePVC.DeepCopy(), "local-home-confluence-1", nil, "")
+	assert.NoError(t, err)
+
+	uid := int64(2002)
+	podSecurityContext := pod.Spec.SecurityContext
+	assert.True(t, *podSecurityContext.RunAsNonRoot)
+	assert.Equal(t, &uid, podSecurityContext.RunAsUser)
+	assert.Equal(t, &uid, podSecurityContext.FSGroup)
+	assert.Equal(t, corev1.SeccompProfileTypeRuntimeDefault, podSecurityContext.SeccompProfile.Type)
+
+	container := pod.Spec.Containers[0]
+	assert.False(t, *container.SecurityContext.AllowPrivilegeEscalation)
+	assert.True(t, *container.SecurityContext.ReadOnlyRootFilesystem)
+	assert.Equal(t, []corev1.Capability{"ALL"}, container.SecurityContext.Capabilities.Drop)
+	assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "tmp", MountPath: "/tmp"})
+
+	// the override can relax them, e.g. to run as another user
+	other := int64(1000)
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.PodTemplate.Spec = &corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{RunAsUser: &other}}
+	pod, err = GetNewPreWarmerPod(cr, "local-home-confluence-1", nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, &other, pod.Spec.SecurityContext.RunAsUser)
+	assert.Equal(t, &uid, pod.Spec.SecurityContext.FSGroup)
+}
+
+func TestPreWarmerPodOfLongPVCName(t *testing.T) {
+	cr := instanceCreatePVC.DeepCopy()
+	pvcName := "local-home-" + strings.Repeat("x", 60) + "-confluence-1"
+	pod, err := GetNewPreWarmerPod(cr, pvcName, nil, "")
+	assert.NoError(t, err)
+	assert.Empty(t, validation.IsValidLabelValue(pod.Labels["pvc"]))
+	assert.Regexp(t, "^local-home-x+-[0-9a-f]{10}$", pod.Labels["pvc"])
+	assert.NotEqual(t, pod.Labels["pvc"], pvcLabelValue(pvcName+"0"))
+	assert.Equal(t, pvcName, pod.Annotations["cache.atlassian.com/pvc"])
+	assert.Empty(t, validation.IsDNS1123Label(pod.Name))
+	assert.Regexp(t, "^prewarm-local-home-x+-[0-9a-f]{10}$", pod.Name)
+	assert.NotEqual(t, pod.Name, preWarmerPodName(pvcName+"0"))
+	assert.Equal(t, "prewarm-local-home-confluence-1", preWarmerPodName("local-home-confluence-1"))
+	// the pod template annotations are not modified
+	assert.Equal(t, metadataMap, cr.Spec.PodTemplate.Annotations)
+}
+
+// assertRestricted asserts that a pod meets the restricted Pod Security Standard
+func assertRestricted(t *testing.T, pod *corev1.Pod) {
+	podSecurityContext := pod.Spec.SecurityContext
+	assert.True(t, *podSecurityContext.RunAsNonRoot)
+	assert.NotZero(t, *podSecurityContext.RunAsUser)
+	assert.Equal(t, corev1.SeccompProfileTypeRuntimeDefault, podSecurityContext.SeccompProfile.Type)
+	for _, container := range pod.Spec.Containers {
+		assert.True(t, *container.SecurityContext.RunAsNonRoot)
+		assert.Nil(t, container.SecurityContext.Privileged)
+		assert.False(t, *container.SecurityContext.AllowPrivilegeEscalation)
+		assert.True(t, *container.SecurityContext.ReadOnlyRootFilesystem)
+		assert.Equal(t, []corev1.Capability{"ALL"}, container.SecurityContext.Capabilities.Drop)
+		assert.Empty(t, container.SecurityContext.Capabilities.Add)
+	}
+}
+
+func TestInheritedPreWarmerPodIsRestricted(t *testing.T) {
+	fsGroup := int64(2003)
+	sts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		SecurityContext: &corev1.PodSecurityContext{FSGroup: &fsGroup},
+		Containers:      []corev1.Container{{Name: "confluence", Image: "atlassian/confluence:8.5.1"}},
+	}}}}
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.InheritFromStatefulSet = true
+	pod, err := GetNewPreWarmerPod(cr, "local-home-confluence-1", sts, "")
+	assert.NoError(t, err)
+	assertRestricted(t, pod)
+	assert.Equal(t, &fsGroup, pod.Spec.SecurityContext.FSGroup)
+	assert.Equal(t, int64(2002), *pod.Spec.SecurityContext.RunAsUser)
+
+	// privileges, root, an unconfined seccomp profile and SELinux options are not inherited
+	root := int64(0)
+	seLinuxOptions := &corev1.SELinuxOptions{Type: "spc_t"}
+	sts.Spec.Template.Spec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsUser:      &root,
+		RunAsNonRoot:   pointer.Bool(false),
+		SELinuxOptions: seLinuxOptions,
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+	}
+	sts.Spec.Template.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{
+		Privileged:               pointer.Bool(true),
+		AllowPrivilegeEscalation: pointer.Bool(true),
+		ReadOnlyRootFilesystem:   pointer.Bool(false),
+		Capabilities:             &corev1.Capabilities{Add: []corev1.Capability{"SYS_ADMIN"}},
+		RunAsUser:                &root,
+		SELinuxOptions:           seLinuxOptions,
+	}
+	pod, err = GetNewPreWarmerPod(cr, "local-home-confluence-1", sts, "")
+	assert.NoError(t, err)
+	assertRestricted(t, pod)
+	assert.Equal(t, int64(2002), *pod.Spec.SecurityContext.RunAsUser)
+	assert.Nil(t, pod.Spec.Containers[0].SecurityContext.RunAsUser)
+	assert.Nil(t, pod.Spec.SecurityContext.SELinuxOptions)
+	assert.Nil(t, pod.Spec.Containers[0].SecurityContext.SELinuxOptions)
+}
+
+func TestPodTemplateSpecIsMergedOverGeneratedPod(t *testing.T) {
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.PodTemplate.Labels = map[string]string{"team": "wiki"}
+	cr.Spec.PodTemplate.Spec = &corev1.PodSpec{
+		ServiceAccountName: "pre-warmer",
+		PriorityClassName:  "low",
+		ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "registry"}},
+		InitContainers:     []corev1.Container{{Name: "wait", Image: "busybox"}},
+		Containers: []corev1.Container{
+			{
+				Name: "pre-warmer",
+				EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "proxy"},
+				}}},
+				Env: []corev1.EnvVar{{Name: "HTTPS_PROXY", Value: "http://proxy:3128"}},
+			},
+			{Name: "exporter", Image: "exporter:1.0"},
+		},
+		Volumes: []corev1.Volume{{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+	}
+
+	pod, err := GetNewPreWarmerPod(cr, "local-home-confluence-1", nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "wiki", "pvc": "local-home-confluence-1"}, pod.Labels)
+	assert.Equal(t, "local-home-confluence-1", pod.Annotations["cache.atlassian.com/pvc"])
+	assert.Equal(t, metadataMap, cr.Spec.PVC.Labels)
+	assert.Equal(t, "pre-warmer", pod.Spec.ServiceAccountName)
+	assert.Equal(t, "low", pod.Spec.PriorityClassName)
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry"}}, pod.Spec.ImagePullSecrets)
+	assert.Equal(t, corev1.RestartPolicyNever, pod.Spec.RestartPolicy)
+	assert.Equal(t, cr.Spec.PodTemplate.Tolerations, pod.Spec.Tolerations)
+	assert.Len(t, pod.Spec.InitContainers, 1)
+	assert.Len(t, pod.Spec.Volumes, 4)
+
+	// the pre-warmer container keeps the generated fields and gains the override ones
+	assert.Len(t, pod.Spec.Containers, 2)
+	container := pod.Spec.Containers[0]
+	assert.Equal(t, "pre-warmer", container.Name)
+	assert.Equal(t, "atlassian/confluence:8.0.3", container.Image)
+	assert.Equal(t, []string{"/opt/script/copy-index.sh"}, container.Command)
+	assert.Len(t, container.VolumeMounts, 4)
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "LOCAL_HOME", Value: localHomePath})
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "HTTPS_PROXY", Value: "http://proxy:3128"})
+	assert.Equal(t, "proxy", container.EnvFrom[0].SecretRef.Name)
+}
+
+// helmReleaseSecret returns a Secret storing a Helm release the way Helm v3 does, gzipped JSON encoded in base64
+func helmReleaseSecret(t *testing.T, release map[string]interface{}) *corev1.Secret {
+	data, err := json.Marshal(release)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	name := release["name"].(string)
+	version := strconv.Itoa(release["version"].(int))
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sh.helm.release.v1." + name + ".v" + version,
+			Namespace: namespace,
+			Labels:    map[string]string{"owner": "helm", "name": name, "version": version},
+		},
+		Type: "helm.sh/release.v1",
+		Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))},
+	}
+}
+
+func TestHelmReleaseFillsSpec(t *testing.T) {
+	ctx := context.Background()
+	chart := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "confluence", "version": "1.12.0", "appVersion": "8.5.1"},
+		"values": map[string]interface{}{
+			"image": map[string]interface{}{"repository": "atlassian/confluence", "tag": ""},
+			"volumes": map[string]interface{}{
+				"localHome":  map[string]interface{}{"mountPath": "/local"},
+				"sharedHome": map[string]interface{}{"mountPath": "/shared", "persistentVolumeClaim": map[string]interface{}{"create": true}},
+			},
+		},
+	}
+	for _, release := range []map[string]interface{}{
+		{"name": "wiki", "version": 1, "info": map[string]interface{}{"status": "superseded"}, "chart": chart},
+		{"name": "wiki", "version": 2, "info": map[string]interface{}{"status": "deployed"}, "chart": chart,
+			"config": map[string]interface{}{"image": map[string]interface{}{"tag": "8.5.2"}}},
+		{"name": "wiki", "version": 3, "info": map[string]interface{}{"status": "pending-upgrade"}, "chart": chart},
+	} {
+		_, err := testClient.CoreV1().Secrets(namespace).Create(ctx, helmReleaseSecret(t, release), metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	cr := instanceCreatePVC.DeepCopy()
+	cr.ObjectMeta = metav1.ObjectMeta{Name: testCustomResourceName + "-helm", Namespace: namespace}
+	cr.Spec.HelmReleaseRef = &cachev1.HelmReleaseRef{Name: "wiki"}
+	cr.Spec.Target = cachev1.TargetSpec{}
+	cr.Spec.SharedHomePVCName = ""
+	cr.Spec.SharedHomePath = ""
+
+	r := &cacheBackupRequestReconcilerPodRunning
+	release, err := r.helmRelease(ctx, cr)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, release.Version)
+
+	// the local home path set in the request is kept
+	status := applyHelmRelease(cr, release)
+	assert.Equal(t, &cachev1.HelmReleaseStatus{
+		Name:      "wiki",
+		Revision:  2,
+		Chart:     "confluence-1.12.0",
+		Inherited: []string{"spec.product", "spec.statefulSetRef.name", "spec.sharedHomePath", "spec.sharedHomePVCName", "spec.podTemplate.image"},
+	}, status)
+	assert.Equal(t, cachev1.ProductConfluence, cr.Spec.Product)
+	assert.Equal(t, &cachev1.StatefulSetRef{Name: "wiki-confluence"}, cr.Spec.StatefulSetRef)
+	assert.Equal(t, "/shared", cr.Spec.SharedHomePath)
+	assert.Equal(t, localHomePath, cr.Spec.LocalHomePath)
+	assert.Equal(t, "wiki-confluence-shared-home", cr.Spec.SharedHomePVCName)
+	assert.Equal(t, "atlassian/confluence:8.5.2", cr.Spec.PodTemplate.Image)
+	pod, err := GetNewPreWarmerPod(cr, "local-home", nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "atlassian/confluence:8.5.2", pod.Spec.Containers[0].Image)
+
+	// the stored spec is left as written, the status reports the release until its StatefulSet exists
+	stored := instanceCreatePVC.DeepCopy()
+	stored.ObjectMeta = cr.ObjectMeta
+	stored.Spec.HelmReleaseRef = &cachev1.HelmReleaseRef{Name: "wiki"}
+	stored.Spec.Target = cachev1.TargetSpec{}
+	assert.NoError(t, fakeClient.Create(ctx, stored))
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: stored.Name, Namespace: namespace}}
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{RequeueAfter: 1 * time.Minute}, res)
+
+	instance := &cachev1.CacheBackupRequest{}
+	assert.NoError(t, fakeClient.Get(ctx, req.NamespacedName, instance))
+	assert.Nil(t, instance.Spec.StatefulSetRef)
+	assert.Equal(t, 2, instance.Status.HelmRelease.Revision)
+	assert.Equal(t, cachev1.ReasonStatefulSetNotFound, meta.FindStatusCondition(instance.Status.Conditions, cachev1.ConditionDegraded).Reason)
+
+	// a missing release is waited for
+	cr.Spec.HelmReleaseRef.Name = "missing"
+	_, err = r.helmRelease(ctx, cr)
+	targetErr, ok := err.(*targetError)
+	assert.True(t, ok)
+	assert.Equal(t, cachev1.ReasonHelmReleaseNotFound, targetErr.reason)
+}
+
+func TestHelmReleaseForbidden(t *testing.T) {
+	k8sClient := testclient.NewSimpleClientset()
+	k8sClient.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(corev1.Resource("secrets"), "", nil)
+	})
+	r := &CacheBackupRequestReconciler{K8sClient: k8sClient}
+	cr := instanceCreatePVC.DeepCopy()
+	cr.Spec.HelmReleaseRef = &cachev1.HelmReleaseRef{Name: "confluence"}
+
+	// Secrets are only listed in namespaces granted the opt-in Role
+	_, err := r.helmRelease(context.Background(), cr)
+	targetErr, ok := err.(*targetError)
+	if assert.True(t, ok) {
+		assert.Equal(t, cachev1.ReasonHelmReleaseForbidden, targetErr.reason)
+	}
+}
+
+func TestSelectOrdinals(t *testing.T) {
+	assert.Equal(t, []int32{0, 1, 2}, selectOrdinals(3, nil, nil))
+	assert.Equal(t, []int32{0, 2}, selectOrdinals(3, nil, []int32{1, 5}))
+	assert.Equal(t, []int32{1, 4}, selectOrdinals(3, []int32{4, 1, 1}, nil))
+	assert.Equal(t, []int32{4}, selectOrdinals(3, []int32{4, 1}, []int32{1}))
+	assert.Empty(t, selectOrdinals(0, nil, nil))
+}
+
+func TestSummarizeStatus(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(earlier.Add(time.Hour))
+	status := &cachev1.CacheBackupRequestStatus{
+		Ordinals: []cachev1.OrdinalStatus{
+			{Ordinal: 0, PVCName: "local-home-wiki-0", LastSuccessfulTime: &earlier, NextScheduledTime: &later, IndexRestoreDurationSeconds: 10},
+			{Ordinal: 1, PVCName: "local-home-wiki-1", LastSuccessfulTime: &later, NextScheduledTime: &earlier, IndexRestoreDurationSeconds: 20},
+		},
+	}
+	setPhase(&status.Ordinals[0], 1, cachev1.PhaseSucceeded, "Index restored from shared home")
+	setPhase(&status.Ordinals[1], 1, cachev1.PhaseFailed, "Pod has failed")
+	summarizeStatus(status)
+
+	assert.Equal(t, cachev1.PhaseFailed, status.Phase)
+	assert.Empty(t, status.PVCName)
+	assert.Equal(t, &later, status.LastSuccessfulTime)
+	assert.Equal(t, 20, status.IndexRestoreDurationSeconds)
+	assert.Equal(t, &earlier, status.NextScheduledTime)
+
+	ready := meta.FindStatusCondition(status.Conditions, cachev1.ConditionReady)
+	assert.Equal(t, metav1.ConditionFalse, ready.Status)
+	assert.Equal(t, "Ordinal 1: Pod has failed", ready.Message)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, cachev1.ConditionDegraded))
+	assert.Nil(t, meta.FindStatusCondition(status.Conditions, cachev1.ConditionPVCAvailable))
+}
+
+func TestRestoreResultFromTerminationMessage(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+		Name: "pre-warmer",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			Message: `{"outcome":"PartiallyRestored","snapshotId":"7","bytesRestored":42,"filesRestored":3,"reason":"Index restored from shared home without edge_index: no snapshot"}`,
+		}},
+	}}}}
+	result := restoreResult(pod)
+	assert.Equal(t, cachev1.RestoreOutcomePartiallyRestored, result.Outcome)
+	assert.Equal(t, "7", result.SnapshotID)
+	assert.Equal(t, int64(42), result.BytesRestored)
+
+	status := &cachev1.CacheBackupRequestStatus{Ordinals: []cachev1.OrdinalStatus{{Ordinal: 0, LastRestore: result}}}
+	setPhase(&status.Ordinals[0], 1, cachev1.CacheBackupRequestPhase(result.Outcome), result.Reason)
+	summarizeStatus(status)
+	assert.Equal(t, cachev1.PhasePartiallyRestored, status.Phase)
+	ready := meta.FindStatusCondition(status.Conditions, cachev1.ConditionReady)
+	assert.Equal(t, metav1.ConditionTrue, ready.Status)
+	assert.Equal(t, cachev1.ReasonRestorePartial, ready.Reason)
+
+	// the signer of a verified snapshot is recorded, and a snapshot that fails verification is reported
+	setSignatureCondition(&status.Ordinals[0], 1, &cachev1.RestoreResult{
+		Outcome:    cachev1.RestoreOutcomeRestored,
+		SnapshotID: "7",
+		Signature:  &cachev1.SignatureResult{Valid: true, Signer: "ci", KeyFingerprint: "SHA256:key"},
+	})
+	summarizeStatus(status)
+	verified := meta.FindStatusCondition(status.Conditions, cachev1.ConditionSnapshotVerified)
+	assert.Equal(t, metav1.ConditionTrue, verified.Status)
+	assert.Equal(t, "Snapshot 7 is signed with key SHA256:key by ci", verified.Message)
+	setSignatureCondition(&status.Ordinals[0], 1, &cachev1.RestoreResult{
+		Outcome:   cachev1.RestoreOutcomeFailed,
+		Signature: &cachev1.SignatureResult{KeyFingerprint: "SHA256:key"},
+		Reason:    "snapshot 8 is not signed by key SHA256:key: the signature does not match the manifest",
+	})
+	summarizeStatus(status)
+	verified = meta.FindStatusCondition(status.Conditions, cachev1.ConditionSnapshotVerified)
+	assert.Equal(t, metav1.ConditionFalse, verified.Status)
+	assert.Equal(t, cachev1.ReasonSignatureInvalid, verified.Reason)
+
+	// a corrupt index is reported
+	setIndexCondition(&status.Ordinals[0], 1, &cachev1.RestoreResult{
+		Outcome:           cachev1.RestoreOutcomeFailed,
+		IndexVerification: &cachev1.IndexVerificationResult{RolledBack: true},
+		Reason:            "the index restored from snapshot 8 failed verification: index segments_2 is corrupt: _0.cfs is missing",
+	})
+	summarizeStatus(status)
+	indexVerified := meta.FindStatusCondition(status.Conditions, cachev1.ConditionIndexVerified)
+	assert.Equal(t, metav1.ConditionFalse, indexVerified.Status)
+	assert.Equal(t, cachev1.ReasonIndexCorrupt, indexVerified.Reason)
+
+	// a restore script writes no result
+	pod.Status.ContainerStatuses[0].State.Terminated.Message = "done"
+	assert.Nil(t, restoreResult(pod))
+	pod.Status.ContainerStatuses[0].State.Terminated = nil
+	assert.Nil(t, restoreResult(pod))
+}
+
+func TestClusterCacheBackupPolicy(t *testing.T) {
+	ctx := context.Background()
+	for _, ns := range []*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"pre-warm": "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+	} {
+		assert.NoError(t, fakeClient.Create(ctx, ns))
+	}
+	for _, sts := range []*appsv1.StatefulSet{
+		{ObjectMeta: metav1.ObjectMeta{Name: "wiki", Namespace: "team-a", Labels: map[string]string{"app": "confluence"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "tracker", Namespace: "team-a", Labels: map[string]string{"app": "jira"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "wiki", Namespace: "team-b", Labels: map[string]string{"app": "confluence"}}},
+	} {
+		assert.NoError(t, fakeClient.Create(ctx, sts))
+	}
+
+	policy := &cachev1.ClusterCacheBackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "confluence"},
+		Spec: cachev1.ClusterCacheBackupPolicySpec{
+			NamespaceSelector:   &metav1.LabelSelector{MatchLabels: map[string]string{"pre-warm": "true"}},
+			StatefulSetSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "confluence"}},
+			Template: cachev1.CacheBackupRequestTemplate{
+				Labels: map[string]string{"team": "a"},
+				Spec: cachev1.CacheBackupRequestSpec{
+					StatefulSetRef: &cachev1.StatefulSetRef{ExcludeOrdinals: []int32{0}},
+					Schedule:       cachev1.ScheduleSpec{Cron: "0 2 * * *"},
+				},
+			},
+		},
+	}
+	err := fakeClient.Create(ctx, policy)
+	assert.NoError(t, err)
+
+	r := &ClusterCacheBackupPolicyReconciler{
+		Client: fakeClient,
+		Scheme: scheme.Scheme,
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: policy.Name}}
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, res)
+
+	// a request is created for the selected StatefulSet only
+	requestName := types.NamespacedName{Name: "confluence-wiki", Namespace: "team-a"}
+	request := &cachev1.CacheBackupRequest{}
+	err = fakeClient.Get(ctx, requestName, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "wiki", request.Spec.StatefulSetRef.Name)
+	assert.Equal(t, []int32{0}, request.Spec.StatefulSetRef.ExcludeOrdinals)
+	assert.Equal(t, "0 2 * * *", request.Spec.Schedule.Cron)
+	// the defaults depending on other fields are applied when the request is reconciled
+	assert.Empty(t, request.Spec.SharedHomePVCName)
+	assert.Equal(t, map[string]string{"team": "a", cachev1.PolicyLabel: policy.Name}, request.Labels)
+	assert.True(t, metav1.IsControlledBy(request, policy))
+	for _, name := range []types.NamespacedName{{Name: "confluence-tracker", Namespace: "team-a"}, {Name: "confluence-wiki", Namespace: "team-b"}} {
+		err = fakeClient.Get(ctx, name, &cachev1.CacheBackupRequest{})
+		assert.True(t, errors.IsNotFound(err))
+	}
+
+	err = fakeClient.Get(ctx, req.NamespacedName, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), policy.Status.Requests)
+	assert.True(t, meta.IsStatusConditionTrue(policy.Status.Conditions, cachev1.ConditionReady))
+
+	// policy changes propagate to the request
+	policy.Spec.Template.Spec.Schedule.Cron = "0 3 * * *"
+	err = fakeClient.Update(ctx, policy)
+	assert.NoError(t, err)
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, requestName, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "0 3 * * *", request.Spec.Schedule.Cron)
+
+	// the request is deleted once the StatefulSet is no longer selected
+	sts := &appsv1.StatefulSet{}
+	assert.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "wiki", Namespace: "team-a"}, sts))
+	sts.Labels["app"] = "wiki"
+	assert.NoError(t, fakeClient.Update(ctx, sts))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = fakeClient.Get(ctx, requestName, request)
+	assert.True(t, errors.IsNotFound(err))
+	err = fakeClient.Get(ctx, req.NamespacedName, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), policy.Status.Requests)
+}
+
+func TestPolicyRequestNameIsTruncated(t *testing.T) {
+	r := &ClusterCacheBackupPolicyReconciler{}
+	policy := &cachev1.ClusterCacheBackupPolicy{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("p", 200)}}
+	long := r.newPolicyRequest(policy, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("s", 100) + "-1"}})
+	other := r.newPolicyRequest(policy, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("s", 100) + "-2"}})
+	assert.Empty(t, validation.IsDNS1123Subdomain(long.Name))
+	assert.NotEqual(t, long.Name, other.Name)
+
+	short := r.newPolicyRequest(policy, &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "wiki"}})
+	assert.Equal(t, policy.Name+"-wiki", short.Name)
+}
+
+// filterRequests returns the requests for the objects created by a test, the fake client is shared by all tests
+func filterRequests(requests []reconcile.Request, expected ...reconcile.Request) []reconcile.Request {
+	var filtered []reconcile.Request
+	for _, request := range requests {
+		for _, e := range expected {
+			if request == e {
+				filtered = append(filtered, request)
+			}
+		}
+	}
+	return filtered
+}
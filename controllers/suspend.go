@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// EmergencyStopConfigMapKey is the ConfigMap data key holding an optional reason for the emergency stop
+const EmergencyStopConfigMapKey = "reason"
+
+// EmergencyStop halts pre-warming for all CacheBackupRequests, either from an operator flag
+// or while a well-known ConfigMap exists in the operator namespace
+type EmergencyStop struct {
+	// Enabled stops pre-warming until the operator is restarted without it
+	Enabled bool
+	// ConfigMap stops pre-warming while it exists, it is not watched when the name is empty
+	ConfigMap types.NamespacedName
+}
+
+// Active returns true and a message for the Suspended condition if pre-warming must not start
+func (e *EmergencyStop) Active(ctx context.Context, c client.Client) (bool, string, error) {
+	if e.Enabled {
+		return true, "Pre-warming is stopped for all requests by the operator --emergency-stop flag", nil
+	}
+	if e.ConfigMap.Name == "" {
+		return false, "", nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err := c.Get(ctx, e.ConfigMap, configMap)
+	if errors.IsNotFound(err) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	message := "Pre-warming is stopped for all requests while ConfigMap " + e.ConfigMap.String() + " exists"
+	if reason := configMap.Data[EmergencyStopConfigMapKey]; reason != "" {
+		message += ": " + reason
+	}
+	return true, message, nil
+}
+
+// suspension returns the reason and message of the Suspended condition, an empty reason means pre-warming may run
+func (r *CacheBackupRequestReconciler) suspension(ctx context.Context, cr *cachev1.CacheBackupRequest) (string, string, error) {
+	stopped, message, err := r.EmergencyStop.Active(ctx, r.Client)
+	if err != nil {
+		return "", "", err
+	}
+	if stopped {
+		return cachev1.ReasonEmergencyStop, message, nil
+	}
+	if cr.Spec.Suspend {
+		return cachev1.ReasonSuspended, "Pre-warming is suspended by .spec.suspend", nil
+	}
+	return "", "", nil
+}
+
+// requestsForEmergencyStop enqueues every CacheBackupRequest when the emergency stop ConfigMap changes
+func (r *CacheBackupRequestReconciler) requestsForEmergencyStop(obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.EmergencyStop.ConfigMap.Namespace || obj.GetName() != r.EmergencyStop.ConfigMap.Name {
+		return nil
+	}
+
+	ctx := context.Background()
+	list := &cachev1.CacheBackupRequestList{}
+	if err := r.Client.List(ctx, list); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to list CacheBackupRequests after an emergency stop change")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: item.Name, Namespace: item.Namespace},
+		})
+	}
+	return requests
+}
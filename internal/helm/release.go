@@ -0,0 +1,151 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package helm decodes the releases Helm v3 stores in Secrets, without depending on Helm itself
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// SecretType is the type of the Secrets Helm v3 stores releases in
+	SecretType = "helm.sh/release.v1"
+	// SecretDataKey is the Secret data key holding the encoded release
+	SecretDataKey = "release"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// Release is the part of a Helm v3 release the operator reads
+type Release struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Version is the release revision
+	Version int   `json:"version"`
+	Chart   Chart `json:"chart"`
+	Info    Info  `json:"info"`
+	// Config holds the values set by the user
+	Config map[string]interface{} `json:"config"`
+}
+
+// Chart is the chart a release was installed from
+type Chart struct {
+	Metadata ChartMetadata `json:"metadata"`
+	// Values are the default values of the chart
+	Values map[string]interface{} `json:"values"`
+}
+
+// ChartMetadata describes a chart
+type ChartMetadata struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+}
+
+// Info is the status of a release
+type Info struct {
+	Status string `json:"status"`
+}
+
+// Decode decodes the release stored in a Helm release Secret, base64 encoded and usually gzipped JSON
+func Decode(data []byte) (*Release, error) {
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode release: %v", err)
+	}
+	if bytes.HasPrefix(decoded, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(decoded))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress release: %v", err)
+		}
+		defer reader.Close()
+		if decoded, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("cannot decompress release: %v", err)
+		}
+	}
+
+	release := &Release{}
+	if err := json.Unmarshal(decoded, release); err != nil {
+		return nil, fmt.Errorf("cannot parse release: %v", err)
+	}
+	return release, nil
+}
+
+// Value returns the value at a dot separated path, set by the user or else the chart default
+func (r *Release) Value(path string) (interface{}, bool) {
+	if value, ok := lookup(r.Config, path); ok {
+		return value, true
+	}
+	return lookup(r.Chart.Values, path)
+}
+
+// String returns the string value at a dot separated path, empty if it is not set or not a string
+func (r *Release) String(path string) string {
+	value, _ := r.Value(path)
+	s, _ := value.(string)
+	return s
+}
+
+// Bool returns the boolean value at a dot separated path, false if it is not set or not a boolean
+func (r *Release) Bool(path string) bool {
+	value, _ := r.Value(path)
+	b, _ := value.(bool)
+	return b
+}
+
+// Fullname returns the name the Atlassian charts give to the resources of a release, the StatefulSet in particular
+func (r *Release) Fullname() string {
+	if fullname := r.String("fullnameOverride"); fullname != "" {
+		return truncate(fullname)
+	}
+	name := r.String("nameOverride")
+	if name == "" {
+		name = r.Chart.Metadata.Name
+	}
+	if strings.Contains(r.Name, name) {
+		return truncate(r.Name)
+	}
+	return truncate(r.Name + "-" + name)
+}
+
+func lookup(values map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = values
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok || value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// truncate shortens a name to 63 characters like the charts do
+func truncate(name string) string {
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.TrimSuffix(name, "-")
+}
@@ -0,0 +1,84 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const releaseJSON = `{
+  "name": "wiki",
+  "namespace": "confluence",
+  "version": 3,
+  "info": {"status": "deployed"},
+  "chart": {
+    "metadata": {"name": "confluence", "version": "1.12.0", "appVersion": "8.5.1"},
+    "values": {
+      "image": {"repository": "atlassian/confluence", "tag": ""},
+      "volumes": {
+        "localHome": {"mountPath": "/var/atlassian/application-data/confluence"},
+        "sharedHome": {"mountPath": "/var/atlassian/application-data/shared-home", "persistentVolumeClaim": {"create": false}}
+      }
+    }
+  },
+  "config": {
+    "volumes": {"sharedHome": {"persistentVolumeClaim": {"create": true}}}
+  }
+}`
+
+func encode(t *testing.T, data []byte, compress bool) []byte {
+	if compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		data = buf.Bytes()
+	}
+	return []byte(base64.StdEncoding.EncodeToString(data))
+}
+
+func TestDecode(t *testing.T) {
+	for _, compress := range []bool{true, false} {
+		release, err := Decode(encode(t, []byte(releaseJSON), compress))
+		assert.NoError(t, err)
+		assert.Equal(t, "wiki", release.Name)
+		assert.Equal(t, 3, release.Version)
+		assert.Equal(t, "deployed", release.Info.Status)
+		assert.Equal(t, "8.5.1", release.Chart.Metadata.AppVersion)
+	}
+
+	_, err := Decode([]byte("not base64!"))
+	assert.Error(t, err)
+	_, err = Decode(encode(t, []byte("{"), true))
+	assert.Error(t, err)
+}
+
+func TestValuesPreferUserConfig(t *testing.T) {
+	release, err := Decode(encode(t, []byte(releaseJSON), true))
+	assert.NoError(t, err)
+
+	assert.True(t, release.Bool("volumes.sharedHome.persistentVolumeClaim.create"))
+	assert.Equal(t, "/var/atlassian/application-data/confluence", release.String("volumes.localHome.mountPath"))
+	assert.Equal(t, "", release.String("image.tag"))
+	assert.Equal(t, "", release.String("volumes.localHome.mountPath.nested"))
+	_, ok := release.Value("volumes.missing")
+	assert.False(t, ok)
+}
+
+func TestFullname(t *testing.T) {
+	release := &Release{Name: "wiki", Chart: Chart{Metadata: ChartMetadata{Name: "confluence"}}}
+	assert.Equal(t, "wiki-confluence", release.Fullname())
+
+	release.Name = "confluence-prod"
+	assert.Equal(t, "confluence-prod", release.Fullname())
+
+	release.Config = map[string]interface{}{"nameOverride": "prod"}
+	assert.Equal(t, "confluence-prod", release.Fullname())
+
+	release.Config = map[string]interface{}{"fullnameOverride": "wiki"}
+	assert.Equal(t, "wiki", release.Fullname())
+}
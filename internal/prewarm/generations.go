@@ -0,0 +1,312 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prewarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+)
+
+// SnapshotFile, in a restored index directory, holds the id of the snapshot the index was restored from
+const SnapshotFile = "pre-warmer.snapshot"
+
+const (
+	// stagingSuffix is appended to the directories snapshots are extracted to before they replace the index
+	stagingSuffix = ".staging"
+	// keptSuffix is appended to the directories replaced by restores, followed by the generation from the second one
+	keptSuffix = ".prev"
+	// rolledBackSuffix is appended to the index directory for the file holding the id of the snapshot rolled back
+	rolledBackSuffix = ".rolled-back"
+	// pendingSuffix is appended to the index directory for the file holding the steps of a swap or a rollback
+	// left to do
+	pendingSuffix = ".pending"
+)
+
+// kept returns the directory dir is kept as for a generation, 1 being the one replaced by the last restore
+func kept(dir string, generation int) string {
+	if generation == 1 {
+		return dir + keptSuffix
+	}
+	return dir + keptSuffix + "." + strconv.Itoa(generation)
+}
+
+// oldestGeneration returns the oldest generation of dir that is kept, 0 if none is
+func oldestGeneration(dir string) (int, error) {
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	oldest := 0
+	prefix := filepath.Base(dir) + keptSuffix
+	for _, entry := range entries {
+		generation := 0
+		if entry.Name() == prefix {
+			generation = 1
+		} else if strings.HasPrefix(entry.Name(), prefix+".") {
+			generation, _ = strconv.Atoi(strings.TrimPrefix(entry.Name(), prefix+"."))
+		}
+		if generation > oldest {
+			oldest = generation
+		}
+	}
+	return oldest, nil
+}
+
+// stage creates empty staging directories for dirs. The staging directories after the first one, the journal
+// ids, start as a copy of their directory: the ids of indexes without a snapshot are kept
+func stage(dirs ...string) error {
+	for i, dir := range dirs {
+		staging := dir + stagingSuffix
+		if err := os.RemoveAll(staging); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(staging, 0755); err != nil {
+			return err
+		}
+		if i == 0 {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				if err := copyFile(filepath.Join(dir, entry.Name()), filepath.Join(staging, entry.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unstage removes the staging directories a failed restore leaves behind, unless a swap of them is pending
+func unstage(dirs ...string) {
+	if _, err := os.Stat(dirs[0] + pendingSuffix); err == nil {
+		return
+	}
+	for _, dir := range dirs {
+		_ = os.RemoveAll(dir + stagingSuffix)
+	}
+}
+
+// swapPlan returns the steps replacing dirs by their staging directories. Each replaced directory is kept as
+// generation 1, the generations kept before it move up by one and those beyond keep are removed
+func swapPlan(keep int, dirs ...string) (*plan, error) {
+	p := newPlan(dirs[0])
+	for _, dir := range dirs {
+		oldest, err := oldestGeneration(dir)
+		if err != nil {
+			return nil, err
+		}
+		// the oldest generations move first, for none to replace another
+		for generation := oldest; generation >= 1; generation-- {
+			p.rename(kept(dir, generation), kept(dir, generation+1))
+		}
+		p.rename(dir, kept(dir, 1))
+		p.rename(dir+stagingSuffix, dir)
+		for generation := keep + 1; generation <= oldest+1; generation++ {
+			p.remove(kept(dir, generation))
+		}
+	}
+	return p, nil
+}
+
+// step is a rename, a removal or a file write of a plan. Each can be done again: a rename is done already
+// once its source does not exist
+type step struct {
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Remove string `json:"remove,omitempty"`
+	Write  string `json:"write,omitempty"`
+	Data   string `json:"data,omitempty"`
+}
+
+func (s step) do() error {
+	switch {
+	case s.From != "":
+		return renameIfExists(s.From, s.To)
+	case s.Remove != "":
+		return os.RemoveAll(s.Remove)
+	default:
+		return os.WriteFile(s.Write, []byte(s.Data), 0644)
+	}
+}
+
+// plan is the steps of a swap or a rollback. The steps left to do are saved to a file next to the index
+// before each step, so that a pre-warmer interrupted in the middle of a plan completes it, and the index
+// is never left with the journal ids of another one
+type plan struct {
+	file  string
+	Steps []step `json:"steps"`
+}
+
+func newPlan(indexDir string) *plan {
+	return &plan{file: indexDir + pendingSuffix}
+}
+
+func (p *plan) rename(from, to string) {
+	p.Steps = append(p.Steps, step{From: from, To: to})
+}
+
+func (p *plan) remove(name string) {
+	p.Steps = append(p.Steps, step{Remove: name})
+}
+
+func (p *plan) write(name, data string) {
+	p.Steps = append(p.Steps, step{Write: name, Data: data})
+}
+
+// save replaces the plan file by the steps left to do
+func (p *plan) save() error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p.file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(p.file+".tmp", p.file)
+}
+
+// apply does the steps of the plan and removes the plan file once they are all done
+func (p *plan) apply() error {
+	for len(p.Steps) > 0 {
+		if err := p.save(); err != nil {
+			return err
+		}
+		if err := p.Steps[0].do(); err != nil {
+			return err
+		}
+		p.Steps = p.Steps[1:]
+	}
+	if err := os.Remove(p.file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// resume completes the swap or the rollback of indexDir an interrupted pre-warmer left pending, if any
+func resume(indexDir string) error {
+	p := newPlan(indexDir)
+	data, err := os.ReadFile(p.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return fmt.Errorf("cannot read pending steps %s: %v", p.file, err)
+	}
+	return p.apply()
+}
+
+// Rollback puts back the index and journal ids kept for generation opts.RollbackTo. The index it replaces and the
+// newer kept generations are removed, the snapshot the index was restored from is not restored again
+func Rollback(opts Options) (*cachev1.RestoreResult, error) {
+	indexDir, dirs := opts.dirs()
+	if err := resume(indexDir); err != nil {
+		return nil, err
+	}
+	generation := opts.RollbackTo
+	if _, err := os.Stat(kept(indexDir, generation)); os.IsNotExist(err) {
+		oldest, err := oldestGeneration(indexDir)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no index is kept for generation %d, the oldest generation kept is %d", generation, oldest)
+	} else if err != nil {
+		return nil, err
+	}
+	rolledBack, err := readSnapshotID(filepath.Join(indexDir, SnapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	snapshotID, err := readSnapshotID(filepath.Join(kept(indexDir, generation), SnapshotFile))
+	if err != nil {
+		return nil, err
+	}
+
+	p := newPlan(indexDir)
+	for _, dir := range dirs {
+		oldest, err := oldestGeneration(dir)
+		if err != nil {
+			return nil, err
+		}
+		p.remove(dir)
+		p.rename(kept(dir, generation), dir)
+		for newer := 1; newer < generation; newer++ {
+			p.remove(kept(dir, newer))
+		}
+		// the older generations move down, the oldest last
+		for older := generation + 1; older <= oldest; older++ {
+			p.rename(kept(dir, older), kept(dir, older-generation))
+		}
+	}
+	if rolledBack != "" {
+		p.write(indexDir+rolledBackSuffix, rolledBack)
+	}
+	if opts.Product == cachev1.ProductJira {
+		p.write(filepath.Join(opts.LocalHome, jiraSnapshotFile), snapshotID)
+	}
+	if err := p.apply(); err != nil {
+		return nil, err
+	}
+
+	reason := "Index rolled back to generation " + strconv.Itoa(generation)
+	if snapshotID != "" {
+		reason += ", restored from snapshot " + snapshotID
+	}
+	if rolledBack != "" {
+		reason += ". Snapshot " + rolledBack + " is not restored again"
+	}
+	return &cachev1.RestoreResult{Outcome: cachev1.RestoreOutcomeRolledBack, SnapshotID: snapshotID, Reason: reason}, nil
+}
+
+// renameIfExists renames a file or directory unless it does not exist
+func renameIfExists(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// readSnapshotID reads a file holding a snapshot id, nothing if it does not exist
+func readSnapshotID(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
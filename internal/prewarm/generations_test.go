@@ -0,0 +1,158 @@
+package prewarm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSnapshot replaces the snapshots in shared home by snapshot id, at journal id
+func writeSnapshot(t *testing.T, opts Options, id, journalID string) {
+	snapshotDir := filepath.Join(opts.SharedHome, "index-snapshots")
+	archives, err := filepath.Glob(filepath.Join(snapshotDir, "*.zip"))
+	assert.NoError(t, err)
+	for _, archive := range archives {
+		assert.NoError(t, os.Remove(archive))
+	}
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_main_index_"+id+".zip"), map[string]string{"segments_2": id})
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_change_index_"+id+".zip"), map[string]string{"segments_1": id})
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_edge_index_"+id+".zip"), map[string]string{"segments_1": id})
+	for _, name := range []string{"main_index", "change_index"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(snapshotDir, "IndexSnapshot_"+name+"_journal_id"), []byte(journalID), 0644))
+	}
+}
+
+func assertFile(t *testing.T, path, content string) {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err, path)
+	assert.Equal(t, content, string(data), path)
+}
+
+func TestRestoreKeepsPreviousIndexes(t *testing.T) {
+	opts := newHomes(t)
+	opts.KeepPreviousIndexes = 2
+	for i, id := range []string{"1", "2", "3"} {
+		writeSnapshot(t, opts, id, string(rune('4'+i))+"0")
+		result, err := Restore(opts)
+		assert.NoError(t, err)
+		assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome, id)
+	}
+
+	for dir, id := range map[string]string{"index": "3", "index.prev": "2", "index.prev.2": "1"} {
+		assertFile(t, filepath.Join(opts.LocalHome, dir, "segments_2"), id)
+		assertFile(t, filepath.Join(opts.LocalHome, dir, SnapshotFile), id)
+	}
+	for dir, journalID := range map[string]string{"journal": "60", "journal.prev": "50", "journal.prev.2": "40"} {
+		assertFile(t, filepath.Join(opts.LocalHome, dir, "main_index"), journalID)
+	}
+	for _, dir := range []string{"index.prev.3", "journal.prev.3", "index.staging", "journal.staging"} {
+		_, err := os.Stat(filepath.Join(opts.LocalHome, dir))
+		assert.True(t, os.IsNotExist(err), dir)
+	}
+
+	// fewer generations are kept once the setting is lowered
+	opts.KeepPreviousIndexes = 1
+	writeSnapshot(t, opts, "4", "70")
+	_, err := Restore(opts)
+	assert.NoError(t, err)
+	assertFile(t, filepath.Join(opts.LocalHome, "index.prev", SnapshotFile), "3")
+	_, err = os.Stat(filepath.Join(opts.LocalHome, "index.prev.2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRollback(t *testing.T) {
+	opts := newHomes(t)
+	opts.KeepPreviousIndexes = 3
+	for i, id := range []string{"1", "2", "3", "4"} {
+		writeSnapshot(t, opts, id, string(rune('4'+i))+"0")
+		_, err := Restore(opts)
+		assert.NoError(t, err)
+	}
+
+	opts.RollbackTo = 4
+	_, err := Rollback(opts)
+	assert.Regexp(t, "no index is kept for generation 4, the oldest generation kept is 3", err)
+
+	opts.RollbackTo = 2
+	result, err := Rollback(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRolledBack, result.Outcome)
+	assert.Equal(t, "2", result.SnapshotID)
+	assert.Equal(t, "Index rolled back to generation 2, restored from snapshot 2. Snapshot 4 is not restored again", result.Reason)
+	for dir, id := range map[string]string{"index": "2", "index.prev": "1"} {
+		assertFile(t, filepath.Join(opts.LocalHome, dir, SnapshotFile), id)
+	}
+	assertFile(t, filepath.Join(opts.LocalHome, "index.rolled-back"), "4")
+	assertFile(t, filepath.Join(opts.LocalHome, "journal", "main_index"), "50")
+	for _, dir := range []string{"index.prev.2", "index.prev.3", "journal.prev.2"} {
+		_, err := os.Stat(filepath.Join(opts.LocalHome, dir))
+		assert.True(t, os.IsNotExist(err), dir)
+	}
+
+	// the snapshot rolled back from is not restored again, the next one is
+	opts.RollbackTo = 0
+	result, err = Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeSkipped, result.Outcome)
+	assert.Regexp(t, "snapshot 4 was rolled back", result.Reason)
+	writeSnapshot(t, opts, "5", "80")
+	result, err = Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assertFile(t, filepath.Join(opts.LocalHome, "index.prev", SnapshotFile), "2")
+}
+
+// interruptSwap extracts snapshot id at journal id to staging directories and swaps the index, but not the journal ids
+func interruptSwap(t *testing.T, opts Options, id, journalID string) {
+	indexDir, dirs := opts.dirs()
+	journalDir := dirs[1]
+	writeFiles(t, indexDir+stagingSuffix, map[string]string{"segments_2": id, SnapshotFile: id})
+	writeFiles(t, journalDir+stagingSuffix, map[string]string{"main_index": journalID, "change_index": journalID})
+	p, err := swapPlan(opts.KeepPreviousIndexes, dirs...)
+	assert.NoError(t, err)
+	for p.Steps[0].From != journalDir {
+		assert.NoError(t, p.save())
+		assert.NoError(t, p.Steps[0].do())
+		p.Steps = p.Steps[1:]
+	}
+	assert.NoError(t, p.save())
+	assertFile(t, filepath.Join(indexDir, SnapshotFile), id)
+}
+
+func TestInterruptedSwapIsCompleted(t *testing.T) {
+	opts := newHomes(t)
+	opts.KeepPreviousIndexes = 2
+	writeSnapshot(t, opts, "1", "40")
+	_, err := Restore(opts)
+	assert.NoError(t, err)
+
+	// the index of snapshot 2 is in place, the journal ids are still those of snapshot 1
+	writeSnapshot(t, opts, "2", "50")
+	interruptSwap(t, opts, "2", "50")
+	assertFile(t, filepath.Join(opts.LocalHome, "journal", "main_index"), "40")
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeSkipped, result.Outcome)
+	assertFile(t, filepath.Join(opts.LocalHome, "journal", "main_index"), "50")
+	assertFile(t, filepath.Join(opts.LocalHome, "journal.prev", "main_index"), "40")
+	assertFile(t, filepath.Join(opts.LocalHome, "index.prev", SnapshotFile), "1")
+	for _, name := range []string{"index.pending", "index.staging", "journal.staging"} {
+		_, err := os.Stat(filepath.Join(opts.LocalHome, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	// a rollback completes the interrupted swap before putting back a kept index
+	writeSnapshot(t, opts, "3", "60")
+	interruptSwap(t, opts, "3", "60")
+	opts.RollbackTo = 1
+	result, err = Rollback(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", result.SnapshotID)
+	assertFile(t, filepath.Join(opts.LocalHome, "index", SnapshotFile), "2")
+	assertFile(t, filepath.Join(opts.LocalHome, "journal", "main_index"), "50")
+	assertFile(t, filepath.Join(opts.LocalHome, "index.rolled-back"), "3")
+}
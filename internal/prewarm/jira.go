@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prewarm
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// jiraSnapshotFile, relative to the local home, holds the id of the snapshot the Jira index was last restored from.
+// Jira snapshots have no journal id: the index is up to date as long as no newer snapshot has been written
+const jiraSnapshotFile = "caches/pre-warmer-snapshot"
+
+// jiraUpToDate returns true if the Jira index exists and was restored from the snapshot
+func jiraUpToDate(indexDir, snapshotFile, snapshotID string) (bool, error) {
+	if _, err := os.Stat(indexDir); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	restored, err := os.ReadFile(snapshotFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(restored)) == snapshotID, nil
+}
+
+// restoreJira extracts the snapshot archive to an empty index directory. The caller records the snapshot id
+// in the snapshot file once the index is verified, and removes the lock file
+func restoreJira(archive, indexDir string) (*cachev1.RestoreResult, error) {
+	if err := emptyIndexDir(indexDir); err != nil {
+		return nil, err
+	}
+	index := cachev1.IndexRestoreResult{Name: "jira_index"}
+	start := time.Now()
+	if err := extract(archive, indexDir, &index); err != nil {
+		return nil, err
+	}
+	index.Duration = metav1.Duration{Duration: time.Since(start).Round(time.Millisecond)}
+	return &cachev1.RestoreResult{
+		Outcome:       cachev1.RestoreOutcomeRestored,
+		BytesRestored: index.BytesRestored,
+		FilesRestored: index.FilesRestored,
+		Indexes:       []cachev1.IndexRestoreResult{index},
+		Reason:        "Index restored from shared home",
+	}, nil
+}
@@ -0,0 +1,516 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prewarm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+)
+
+// Lucene codec header and footer magic numbers
+const (
+	codecMagic  = 0x3fd76c17
+	footerMagic = ^uint32(codecMagic)
+	footerSize  = 16
+)
+
+// Versions of the segments_N format, from Lucene 4.0 to Lucene 9
+const (
+	segmentsVersion40 = 0
+	segmentsVersion46 = 1
+	segmentsVersion48 = 2
+	segmentsVersion49 = 3
+	segmentsVersion50 = 4
+	segmentsVersion51 = 5
+	segmentsVersion53 = 6
+	segmentsVersion70 = 7
+	segmentsVersion72 = 8
+	segmentsVersion74 = 9
+	segmentsVersion86 = 10
+)
+
+// luceneFile is a file referenced by a Lucene commit
+type luceneFile struct {
+	name string
+	// footer is true if the file ends with a codec footer, as files written by Lucene 4.8 and later do
+	footer bool
+	// minSize is the size the file has at least, from the compound file entries
+	minSize int64
+}
+
+// luceneCommit is a commit of a Lucene index: the number of its segments and their files, with the segments_N file
+type luceneCommit struct {
+	segments int
+	files    []luceneFile
+}
+
+// verifyIndex checks the Lucene indexes in indexDir and its subdirectories: the latest commit of each
+// index is readable and every file of its segments exists with the expected size
+func verifyIndex(indexDir string) (*cachev1.IndexVerificationResult, error) {
+	result := &cachev1.IndexVerificationResult{}
+	err := filepath.WalkDir(indexDir, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		segmentsFile, err := latestSegmentsFile(dir)
+		if err != nil || segmentsFile == "" {
+			return err
+		}
+		corrupt := func(err error) error {
+			rel, _ := filepath.Rel(indexDir, filepath.Join(dir, segmentsFile))
+			return fmt.Errorf("index %s is corrupt: %w", filepath.ToSlash(rel), err)
+		}
+		commit, err := readCommit(dir, segmentsFile)
+		if err != nil {
+			return corrupt(err)
+		}
+		for _, file := range commit.files {
+			if err := file.verify(dir); err != nil {
+				return corrupt(err)
+			}
+		}
+		result.Indexes++
+		result.Segments += int32(commit.segments)
+		result.Files += int32(len(commit.files))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Indexes == 0 {
+		return nil, fmt.Errorf("no Lucene index in %s", indexDir)
+	}
+	result.Valid = true
+	return result, nil
+}
+
+// latestSegmentsFile returns the segments_N file of a directory with the highest generation, nothing if there is none
+func latestSegmentsFile(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var latest string
+	latestGeneration := int64(-1)
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "segments_") || entry.IsDir() {
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimPrefix(entry.Name(), "segments_"), 36, 64); err == nil && n > latestGeneration {
+			latest, latestGeneration = entry.Name(), n
+		}
+	}
+	return latest, nil
+}
+
+// readCommit reads a segments_N file and the segment info files of its segments
+func readCommit(dir, segmentsFile string) (*luceneCommit, error) {
+	in, err := openLuceneFile(dir, segmentsFile)
+	if err != nil {
+		return nil, err
+	}
+	format := in.header("segments", segmentsVersion40, segmentsVersion86)
+	if format >= segmentsVersion50 {
+		in.indexHeaderSuffix()
+	}
+	if format >= segmentsVersion53 {
+		in.version()
+	}
+	if format >= segmentsVersion70 {
+		in.vint() // major version of the Lucene release that created the index
+	}
+	in.int64() // version
+	if format > segmentsVersion70 {
+		in.vlong() // counter
+	} else {
+		in.int32()
+	}
+	numSegments := in.int32()
+	if format >= segmentsVersion53 && numSegments > 0 {
+		in.version() // oldest segment version
+	}
+	// maps and sets are prefixed by a vint instead of an int since Lucene 5.1
+	intCounts := format < segmentsVersion51
+	footer := format >= segmentsVersion48
+
+	commit := &luceneCommit{segments: int(numSegments), files: []luceneFile{{name: segmentsFile, footer: footer}}}
+	for i := int32(0); i < numSegments && in.err == nil; i++ {
+		segment := in.string()
+		if format >= segmentsVersion70 {
+			in.bytes(16) // segment id
+		} else if format >= segmentsVersion50 && in.byte() == 1 {
+			in.bytes(16)
+		}
+		in.string() // codec
+		files, err := readSegmentInfo(dir, segment)
+		if err != nil {
+			return nil, err
+		}
+		commit.files = append(commit.files, files...)
+
+		deletesGeneration := in.int64()
+		in.int32() // deleted documents
+		if deletesGeneration != -1 {
+			extension := "liv"
+			if format < segmentsVersion50 {
+				extension = "del"
+			}
+			name := segment + "_" + strconv.FormatInt(deletesGeneration, 36) + "." + extension
+			commit.files = append(commit.files, luceneFile{name: name, footer: footer})
+		}
+		if format >= segmentsVersion46 {
+			in.int64() // field infos generation
+		}
+		if format >= segmentsVersion49 {
+			in.int64() // doc values generation
+		}
+		if format > segmentsVersion72 {
+			in.int32() // soft deleted documents
+		}
+		if format > segmentsVersion74 && in.byte() == 1 {
+			in.bytes(16) // commit id
+		}
+		var updates []string
+		if format >= segmentsVersion46 && format < segmentsVersion49 {
+			for n := in.int32(); n > 0 && in.err == nil; n-- {
+				in.int64() // generation
+				updates = append(updates, in.stringSet(intCounts)...)
+			}
+		} else if format >= segmentsVersion49 {
+			updates = append(updates, in.stringSet(intCounts)...) // field infos files
+			for n := in.int32(); n > 0 && in.err == nil; n-- {
+				in.int32() // field number
+				updates = append(updates, in.stringSet(intCounts)...)
+			}
+		}
+		for _, name := range updates {
+			commit.files = append(commit.files, luceneFile{name: name, footer: footer})
+		}
+	}
+	in.stringMap(intCounts) // user data
+	if footer {
+		in.footer()
+	}
+	if in.err != nil {
+		return nil, in.err
+	}
+	return commit, nil
+}
+
+// readSegmentInfo reads the files of a segment from its .si file, with the size compound files have at least
+func readSegmentInfo(dir, segment string) ([]luceneFile, error) {
+	in, err := openLuceneFile(dir, segment+".si")
+	if err != nil {
+		return nil, err
+	}
+	codec, version := in.anyHeader()
+	var files []string
+	footer := true
+	switch codec {
+	case "Lucene40SegmentInfo", "Lucene46SegmentInfo":
+		footer = in.writesFooters(in.string())
+		in.int32() // documents
+		in.byte()  // compound
+		in.stringMap(true)
+		if codec == "Lucene40SegmentInfo" {
+			in.stringMap(true) // attributes
+		}
+		files = in.stringSet(true)
+		if codec == "Lucene46SegmentInfo" && version >= 1 {
+			in.footer()
+		}
+	case "Lucene50SegmentInfo", "Lucene62SegmentInfo", "Lucene70SegmentInfo", "Lucene86SegmentInfo", "Lucene90SegmentInfo":
+		in.indexHeaderSuffix()
+		in.int32()
+		in.int32()
+		in.int32()
+		if codec != "Lucene50SegmentInfo" && codec != "Lucene62SegmentInfo" && in.byte() == 1 {
+			in.int32() // oldest version of the merged segments
+			in.int32()
+			in.int32()
+		}
+		in.int32() // documents
+		in.byte()  // compound
+		intCounts := codec == "Lucene50SegmentInfo" && version < 1
+		in.stringMap(intCounts)
+		files = in.stringSet(intCounts)
+		in.footer()
+	default:
+		return nil, fmt.Errorf("%s has the unsupported codec %s", in.name, codec)
+	}
+	if in.err != nil {
+		return nil, in.err
+	}
+
+	var segmentFiles []luceneFile
+	minSizes := map[string]int64{}
+	for _, name := range files {
+		if strings.HasSuffix(name, ".cfe") {
+			if minSizes, err = readCompoundEntries(dir, name, footer); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, name := range files {
+		segmentFiles = append(segmentFiles, luceneFile{name: name, footer: footer, minSize: minSizes[name]})
+	}
+	return segmentFiles, nil
+}
+
+// readCompoundEntries returns the size the compound data file of a .cfe entries file has at least
+func readCompoundEntries(dir, name string, footer bool) (map[string]int64, error) {
+	in, err := openLuceneFile(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	codec, version := in.anyHeader()
+	switch codec {
+	case "CompoundFileWriterEntries":
+		footer = footer && version >= 1
+	case "Lucene50CompoundEntries", "Lucene90CompoundEntries":
+		in.indexHeaderSuffix()
+	default:
+		return nil, fmt.Errorf("%s has the unsupported codec %s", in.name, codec)
+	}
+	var size int64
+	for n := in.vint(); n > 0 && in.err == nil; n-- {
+		in.string() // file extension
+		offset, length := in.int64(), in.int64()
+		if offset+length > size {
+			size = offset + length
+		}
+	}
+	if footer {
+		in.footer()
+		size += footerSize
+	}
+	if in.err != nil {
+		return nil, in.err
+	}
+	return map[string]int64{strings.TrimSuffix(name, ".cfe") + ".cfs": size}, nil
+}
+
+// verify checks a file exists and is not truncated: it ends with a codec footer and is not smaller than the
+// entries of a compound file
+func (f luceneFile) verify(dir string) error {
+	file, err := os.Open(filepath.Join(dir, f.name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is missing", f.name)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < f.minSize {
+		return fmt.Errorf("%s is %d bytes, expected at least %d", f.name, info.Size(), f.minSize)
+	}
+	if !f.footer {
+		return nil
+	}
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, info.Size()-footerSize); err != nil {
+		return fmt.Errorf("%s is %d bytes, too small to end with a codec footer", f.name, info.Size())
+	}
+	if binary.BigEndian.Uint32(footer) != footerMagic || binary.BigEndian.Uint32(footer[4:]) != 0 {
+		return fmt.Errorf("%s does not end with a codec footer, it is truncated or has trailing bytes", f.name)
+	}
+	return nil
+}
+
+// luceneInput reads the encoding of Lucene DataOutput: big-endian ints and longs, variable-length ints and
+// strings prefixed by their length. The first error is kept, and reads after it return zero values
+type luceneInput struct {
+	name string
+	data []byte
+	pos  int
+	err  error
+}
+
+func openLuceneFile(dir, name string) (*luceneInput, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is missing", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &luceneInput{name: name, data: data}, nil
+}
+
+func (in *luceneInput) fail(format string, args ...interface{}) {
+	if in.err == nil {
+		in.err = fmt.Errorf(in.name+": "+format, args...)
+	}
+}
+
+func (in *luceneInput) bytes(n int) []byte {
+	if in.err != nil {
+		return nil
+	}
+	if n < 0 || in.pos+n > len(in.data) {
+		in.fail("%w at offset %d", io.ErrUnexpectedEOF, in.pos)
+		return nil
+	}
+	b := in.data[in.pos : in.pos+n]
+	in.pos += n
+	return b
+}
+
+func (in *luceneInput) byte() byte {
+	if b := in.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (in *luceneInput) int32() int32 {
+	if b := in.bytes(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (in *luceneInput) int64() int64 {
+	if b := in.bytes(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (in *luceneInput) vlong() int64 {
+	var value int64
+	for shift := 0; shift < 64 && in.err == nil; shift += 7 {
+		b := in.byte()
+		value |= int64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value
+		}
+	}
+	in.fail("malformed variable-length integer at offset %d", in.pos)
+	return 0
+}
+
+func (in *luceneInput) vint() int32 {
+	return int32(in.vlong())
+}
+
+func (in *luceneInput) string() string {
+	return string(in.bytes(int(in.vint())))
+}
+
+// count reads the size of a map or a set
+func (in *luceneInput) count(intCount bool) int {
+	if intCount {
+		return int(in.int32())
+	}
+	return int(in.vint())
+}
+
+func (in *luceneInput) stringSet(intCount bool) []string {
+	var set []string
+	for n := in.count(intCount); n > 0 && in.err == nil; n-- {
+		set = append(set, in.string())
+	}
+	return set
+}
+
+func (in *luceneInput) stringMap(intCount bool) {
+	for n := in.count(intCount); n > 0 && in.err == nil; n-- {
+		in.string()
+		in.string()
+	}
+}
+
+// version skips a Lucene version, written as three variable-length ints
+func (in *luceneInput) version() {
+	in.vint()
+	in.vint()
+	in.vint()
+}
+
+// writesFooters returns true if a Lucene version string, such as 4.10.4, is 4.8 or later: files have a codec footer
+func (in *luceneInput) writesFooters(version string) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		in.fail("malformed version %q", version)
+	}
+	return major > 4 || (major == 4 && minor >= 8)
+}
+
+// anyHeader reads a codec header and returns its codec name and version
+func (in *luceneInput) anyHeader() (string, int32) {
+	if magic := in.int32(); in.err == nil && magic != codecMagic {
+		in.fail("not a Lucene file, the codec header is missing")
+	}
+	return in.string(), in.int32()
+}
+
+// header reads the codec header of a file written by codec, and returns its version
+func (in *luceneInput) header(codec string, minVersion, maxVersion int32) int32 {
+	name, version := in.anyHeader()
+	if in.err == nil && name != codec {
+		in.fail("the codec is %s, expected %s", name, codec)
+	}
+	if in.err == nil && (version < minVersion || version > maxVersion) {
+		in.fail("unsupported %s format %d", codec, version)
+	}
+	return version
+}
+
+// indexHeaderSuffix reads the object id and the suffix that follow the codec header in an index header
+func (in *luceneInput) indexHeaderSuffix() {
+	in.bytes(16)
+	in.bytes(int(in.byte()))
+}
+
+// footer checks the codec footer ending the file and its CRC-32 checksum of the content before it
+func (in *luceneInput) footer() {
+	if in.err != nil {
+		return
+	}
+	if len(in.data) < in.pos+footerSize {
+		in.fail("%w, the codec footer is missing", io.ErrUnexpectedEOF)
+		return
+	}
+	footer := in.data[len(in.data)-footerSize:]
+	if binary.BigEndian.Uint32(footer) != footerMagic || binary.BigEndian.Uint32(footer[4:]) != 0 {
+		in.fail("the codec footer is missing")
+		return
+	}
+	checksum := crc32.ChecksumIEEE(in.data[:len(in.data)-8])
+	if binary.BigEndian.Uint64(footer[8:]) != uint64(checksum) {
+		in.fail("checksum mismatch")
+	}
+}
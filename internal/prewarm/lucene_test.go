@@ -0,0 +1,202 @@
+package prewarm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// luceneOutput writes the encoding of Lucene DataOutput
+type luceneOutput struct {
+	bytes.Buffer
+}
+
+func (o *luceneOutput) int32(v int32) *luceneOutput {
+	_ = binary.Write(o, binary.BigEndian, v)
+	return o
+}
+
+func (o *luceneOutput) int64(v int64) *luceneOutput {
+	_ = binary.Write(o, binary.BigEndian, v)
+	return o
+}
+
+func (o *luceneOutput) vint(v int) *luceneOutput {
+	for v >= 0x80 {
+		o.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	o.WriteByte(byte(v))
+	return o
+}
+
+func (o *luceneOutput) string(s string) *luceneOutput {
+	o.vint(len(s))
+	o.WriteString(s)
+	return o
+}
+
+func (o *luceneOutput) header(codec string, version int32) *luceneOutput {
+	return o.int32(codecMagic).string(codec).int32(version)
+}
+
+func (o *luceneOutput) indexHeader(codec string, version int32, suffix string) *luceneOutput {
+	o.header(codec, version)
+	o.Write(make([]byte, 16))
+	o.WriteByte(byte(len(suffix)))
+	o.WriteString(suffix)
+	return o
+}
+
+func (o *luceneOutput) footer() string {
+	_ = binary.Write(o, binary.BigEndian, footerMagic)
+	o.int32(0)
+	o.int64(int64(crc32.ChecksumIEEE(o.Bytes())))
+	return o.String()
+}
+
+// lucene72Index returns the files of a Lucene 7.2 index with a compound segment that has deleted documents
+func lucene72Index() map[string]string {
+	cfe := (&luceneOutput{}).indexHeader("Lucene50CompoundEntries", 0, "").vint(2).
+		string(".fdt").int64(40).int64(100).
+		string(".tim").int64(140).int64(60).footer()
+	cfs := (&luceneOutput{}).indexHeader("Lucene50CompoundData", 0, "")
+	cfs.Write(make([]byte, 200-cfs.Len()))
+	si := (&luceneOutput{}).indexHeader("Lucene70SegmentInfo", 0, "").int32(7).int32(2).int32(0)
+	si.WriteByte(0)
+	si.int32(10)
+	si.WriteByte(1)
+	si.vint(0).vint(3).string("_0.cfs").string("_0.cfe").string("_0.si").vint(0).vint(0)
+	segments := (&luceneOutput{}).indexHeader("segments", segmentsVersion72, "2").vint(7).vint(2).vint(0).vint(7).
+		int64(12).vint(1).int32(1).vint(7).vint(2).vint(0).string("_0")
+	segments.Write(make([]byte, 16))
+	segments.string("Lucene70").int64(1).int32(1).int64(-1).int64(-1).vint(0).int32(0).vint(0)
+	return map[string]string{
+		"_0.cfe":     cfe,
+		"_0.cfs":     cfs.footer(),
+		"_0.si":      si.footer(),
+		"_0_1.liv":   (&luceneOutput{}).indexHeader("Lucene50LiveDocs", 0, "1").int64(0x3ff).footer(),
+		"segments_1": "stale",
+		"segments_2": segments.footer(),
+	}
+}
+
+// lucene44Index returns the files of a Lucene 4.4 index, which have no codec footer
+func lucene44Index() map[string]string {
+	si := (&luceneOutput{}).header("Lucene40SegmentInfo", 0).string("4.4")
+	si.int32(10)
+	si.WriteByte(1)
+	si.int32(0).int32(0).int32(3).string("_0.cfs").string("_0.cfe").string("_0.si")
+	return map[string]string{
+		"_0.cfe":     (&luceneOutput{}).header("CompoundFileWriterEntries", 0).vint(1).string(".fdt").int64(0).int64(50).String(),
+		"_0.cfs":     strings.Repeat("x", 50),
+		"_0.si":      si.String(),
+		"segments_3": (&luceneOutput{}).header("segments", segmentsVersion40).int64(3).int32(1).int32(1).string("_0").string("Lucene42").int64(-1).int32(0).int32(0).String(),
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestVerifyIndex(t *testing.T) {
+	indexDir := t.TempDir()
+	writeFiles(t, indexDir, lucene72Index())
+	writeFiles(t, filepath.Join(indexDir, "change"), lucene44Index())
+	result, err := verifyIndex(indexDir)
+	assert.NoError(t, err)
+	assert.Equal(t, &cachev1.IndexVerificationResult{Valid: true, Indexes: 2, Segments: 2, Files: 9}, result)
+
+	for _, test := range []struct {
+		name   string
+		file   string
+		mutate func(content string) string
+		err    string
+	}{
+		{"truncated compound file", "_0.cfs", func(c string) string { return c[:len(c)-1] }, "index segments_2 is corrupt: _0.cfs is 215 bytes, expected at least 216"},
+		{"trailing bytes", "_0_1.liv", func(c string) string { return c + "x" }, "_0_1.liv does not end with a codec footer"},
+		{"missing live docs", "_0_1.liv", nil, "index segments_2 is corrupt: _0_1.liv is missing"},
+		{"missing segment info", "_0.si", nil, "_0.si is missing"},
+		{"corrupt commit", "segments_2", func(c string) string { return strings.Replace(c, "Lucene70", "Lucene71", 1) }, "segments_2: checksum mismatch"},
+		{"unknown codec", "_0.si", func(c string) string { return strings.Replace(c, "Lucene70SegmentInfo", "Lucene99SegmentInfo", 1) }, "unsupported codec Lucene99SegmentInfo"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			indexDir := t.TempDir()
+			files := lucene72Index()
+			if test.mutate != nil {
+				files[test.file] = test.mutate(files[test.file])
+			} else {
+				delete(files, test.file)
+			}
+			writeFiles(t, indexDir, files)
+			_, err := verifyIndex(indexDir)
+			assert.Regexp(t, test.err, err)
+		})
+	}
+
+	// Lucene 4.4 files have no footer, compound files are checked against their entries
+	files := lucene44Index()
+	files["_0.cfs"] = files["_0.cfs"][:49]
+	indexDir = t.TempDir()
+	writeFiles(t, indexDir, files)
+	_, err = verifyIndex(indexDir)
+	assert.Regexp(t, "index segments_3 is corrupt: _0.cfs is 49 bytes, expected at least 50", err)
+
+	_, err = verifyIndex(t.TempDir())
+	assert.Regexp(t, "no Lucene index", err)
+}
+
+func TestRestoreKeepsPreviousIndexFailingVerification(t *testing.T) {
+	opts := newHomes(t)
+	opts.VerifyIndex = true
+	snapshotDir := filepath.Join(opts.SharedHome, "index-snapshots")
+	for _, name := range []string{"main_index", "change_index", "edge_index"} {
+		writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_"+name+"_1.zip"), lucene72Index())
+	}
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, &cachev1.IndexVerificationResult{Valid: true, Indexes: 3, Segments: 3, Files: 15}, result.IndexVerification)
+	assert.Contains(t, result.Reason, "3 Lucene indexes checked")
+
+	// a newer snapshot with a truncated compound file
+	files := lucene72Index()
+	files["_0.cfs"] = files["_0.cfs"][:100]
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_main_index_2.zip"), files)
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_change_index_2.zip"), lucene72Index())
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_edge_index_2.zip"), lucene72Index())
+	for _, name := range []string{"main_index", "change_index"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(snapshotDir, "IndexSnapshot_"+name+"_journal_id"), []byte("43"), 0644))
+	}
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(filepath.Join(snapshotDir, "IndexSnapshot_main_index_2.zip"), later, later))
+	_, err = Restore(opts)
+	var indexErr *IndexError
+	assert.True(t, errors.As(err, &indexErr))
+	assert.Equal(t, "2", indexErr.SnapshotID)
+	assert.True(t, indexErr.RolledBack)
+	assert.Regexp(t, "_0.cfs is 100 bytes, expected at least 216. The previous index was kept", err)
+
+	// the previous index and its journal ids are kept
+	data, err := os.ReadFile(filepath.Join(opts.LocalHome, "index", "_0.cfs"))
+	assert.NoError(t, err)
+	assert.Len(t, data, 216)
+	data, err = os.ReadFile(filepath.Join(opts.LocalHome, "journal", "main_index"))
+	assert.NoError(t, err)
+	assert.Equal(t, "42", string(data))
+	for _, path := range []string{"index/" + LockFile, "index.staging", "journal.staging", "index.prev", "journal.prev"} {
+		_, err := os.Stat(filepath.Join(opts.LocalHome, path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
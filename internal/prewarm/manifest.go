@@ -0,0 +1,325 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prewarm
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+)
+
+// Manifest describes an index snapshot: the archives of each index and the files extracted from them, with their
+// sizes and SHA-256 digests. It is written to the snapshot directory by the manifest subcommand of the operator
+type Manifest struct {
+	Product        cachev1.Product `json:"product"`
+	ProductVersion string          `json:"productVersion,omitempty"`
+	SnapshotID     string          `json:"snapshotId"`
+	// Signer identifies who signed the manifest, it is only trusted once the signature is verified
+	Signer string `json:"signer,omitempty"`
+	// JournalIDs are the journal ids of the Confluence index snapshots
+	JournalIDs map[string]int64 `json:"journalIds,omitempty"`
+	Indexes    []ManifestIndex  `json:"indexes"`
+}
+
+// ManifestIndex lists the archives of an index and the files extracted from them
+type ManifestIndex struct {
+	Name string `json:"name"`
+	// Archives are relative to the snapshot directory
+	Archives []ManifestFile `json:"archives"`
+	// Files are relative to the local home index directory
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file of a snapshot, its path is slash-separated
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestPath returns the path of the manifest of a snapshot
+func ManifestPath(snapshotDir, snapshotID string) string {
+	return filepath.Join(snapshotDir, "IndexSnapshotManifest_"+snapshotID+".json")
+}
+
+// ReadManifest reads the manifest of a snapshot, nil if there is none
+func ReadManifest(snapshotDir, snapshotID string) (*Manifest, error) {
+	manifest, _, err := readManifest(snapshotDir, snapshotID)
+	return manifest, err
+}
+
+// readManifest reads the manifest of a snapshot and returns it with the bytes it was read from, which are signed
+func readManifest(snapshotDir, snapshotID string) (*Manifest, []byte, error) {
+	data, err := os.ReadFile(ManifestPath(snapshotDir, snapshotID))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, nil, fmt.Errorf("cannot read the manifest of snapshot %s: %v", snapshotID, err)
+	}
+	return manifest, data, nil
+}
+
+// ManifestOptions are the details recorded in a generated manifest, and the key signing it
+type ManifestOptions struct {
+	// ProductVersion is the version of the product that wrote the snapshot
+	ProductVersion string
+	// Signer identifies the signing key holder, it is recorded in the manifest
+	Signer string
+	// SigningKey signs the manifest when set, the signature is written next to it
+	SigningKey ed25519.PrivateKey
+}
+
+// GenerateManifest describes the latest snapshot in shared home and writes its manifest next to it
+func GenerateManifest(opts Options, manifestOpts ManifestOptions) (*Manifest, string, error) {
+	snapshotDir, snapshots := opts.snapshots()
+	mainSnapshot, err := newest(snapshots[0].archives)
+	if err != nil {
+		return nil, "", err
+	}
+	if mainSnapshot == "" {
+		return nil, "", fmt.Errorf("no index snapshot in %s", snapshotDir)
+	}
+	product := opts.Product
+	if product == "" {
+		product = cachev1.ProductConfluence
+	}
+	manifest := &Manifest{
+		Product:        product,
+		ProductVersion: manifestOpts.ProductVersion,
+		SnapshotID:     wildcard(filepath.Base(snapshots[0].archives), filepath.Base(mainSnapshot)),
+		Signer:         manifestOpts.Signer,
+	}
+	archives, err := archivesOf(opts.Product, snapshots, mainSnapshot)
+	if err != nil {
+		return nil, "", err
+	}
+	for i, s := range snapshots {
+		if s.journalID != "" {
+			journalIDFile, err := newest(s.journalID)
+			if err != nil {
+				return nil, "", err
+			}
+			journalID, err := readJournalID(journalIDFile)
+			if err != nil {
+				return nil, "", err
+			}
+			if journalID != 0 {
+				if manifest.JournalIDs == nil {
+					manifest.JournalIDs = map[string]int64{}
+				}
+				manifest.JournalIDs[s.name] = journalID
+			}
+		}
+		if len(archives[i]) == 0 {
+			continue
+		}
+		index := ManifestIndex{Name: s.name}
+		files := map[string]ManifestFile{}
+		for _, archive := range archives[i] {
+			file, err := describeFile(archive)
+			if err != nil {
+				return nil, "", err
+			}
+			if file.Path, err = filepath.Rel(snapshotDir, archive); err != nil {
+				return nil, "", err
+			}
+			file.Path = filepath.ToSlash(file.Path)
+			index.Archives = append(index.Archives, file)
+			// a file extracted from a later archive replaces the one of an earlier archive
+			if err := describeArchive(archive, s.dir, files); err != nil {
+				return nil, "", err
+			}
+		}
+		for _, file := range files {
+			index.Files = append(index.Files, file)
+		}
+		sort.Slice(index.Files, func(i, j int) bool { return index.Files[i].Path < index.Files[j].Path })
+		manifest.Indexes = append(manifest.Indexes, index)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	manifestPath := ManifestPath(snapshotDir, manifest.SnapshotID)
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return nil, "", err
+	}
+	if manifestOpts.SigningKey != nil {
+		if err := writeSignature(SignaturePath(manifestPath), data, manifestOpts.SigningKey); err != nil {
+			return nil, "", err
+		}
+	}
+	return manifest, manifestPath, nil
+}
+
+// describeArchive adds the regular files of a zip archive extracted to dir to files
+func describeArchive(archive, dir string, files map[string]ManifestFile) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", archive, err)
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		src, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("cannot read %s from %s: %v", file.Name, archive, err)
+		}
+		described, err := describe(src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("cannot read %s from %s: %v", file.Name, archive, err)
+		}
+		described.Path = path.Join(filepath.ToSlash(dir), file.Name)
+		files[described.Path] = described
+	}
+	return nil
+}
+
+func describeFile(name string) (ManifestFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+	return describe(f)
+}
+
+// describe returns the size and the SHA-256 digest of the content of r
+func describe(r io.Reader) (ManifestFile, error) {
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	return ManifestFile{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// verifyArchives checks the archives about to be extracted, and the journal ids of the snapshot, are those of the manifest
+func (m *Manifest) verifyArchives(snapshotDir string, snapshots []snapshot, archives [][]string, indexes []cachev1.IndexRestoreResult) error {
+	for i, s := range snapshots {
+		var listed []ManifestFile
+		for _, index := range m.Indexes {
+			if index.Name == s.name {
+				listed = index.Archives
+			}
+		}
+		if len(listed) != len(archives[i]) {
+			return m.mismatch("%d %s archives in shared home, the manifest lists %d", len(archives[i]), s.name, len(listed))
+		}
+		for j, archive := range archives[i] {
+			rel, err := filepath.Rel(snapshotDir, archive)
+			if err != nil {
+				return err
+			}
+			if filepath.ToSlash(rel) != listed[j].Path {
+				return m.mismatch("archive %s is not listed, the manifest lists %s", rel, listed[j].Path)
+			}
+			if err := m.verifyFile(archive, listed[j]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, index := range indexes {
+		if listed, ok := m.JournalIDs[index.Name]; ok && listed != index.SnapshotJournalID {
+			return m.mismatch("the %s journal id is %d, the manifest lists %d", index.Name, index.SnapshotJournalID, listed)
+		}
+	}
+	return nil
+}
+
+// verifyTree checks the files extracted to the index directory are exactly those of the manifest
+func (m *Manifest) verifyTree(indexDir string) error {
+	listed := map[string]ManifestFile{}
+	for _, index := range m.Indexes {
+		for _, file := range index.Files {
+			listed[file.Path] = file
+		}
+	}
+	err := filepath.WalkDir(indexDir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(indexDir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == LockFile || rel == SnapshotFile {
+			return nil
+		}
+		file, ok := listed[rel]
+		if !ok {
+			return m.mismatch("extracted file %s is not listed", rel)
+		}
+		delete(listed, rel)
+		return m.verifyFile(name, file)
+	})
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for rel := range listed {
+		missing = append(missing, rel)
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return m.mismatch("%s was not extracted", missing[0])
+	}
+	return nil
+}
+
+func (m *Manifest) verifyFile(name string, listed ManifestFile) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.Size() != listed.Size {
+		return m.mismatch("%s is %d bytes, the manifest lists %d", listed.Path, info.Size(), listed.Size)
+	}
+	file, err := describeFile(name)
+	if err != nil {
+		return err
+	}
+	if file.SHA256 != listed.SHA256 {
+		return m.mismatch("%s has SHA-256 %s, the manifest lists %s", listed.Path, file.SHA256, listed.SHA256)
+	}
+	return nil
+}
+
+func (m *Manifest) mismatch(format string, args ...interface{}) error {
+	return fmt.Errorf("snapshot %s does not match its manifest: "+format, append([]interface{}{m.SnapshotID}, args...)...)
+}
@@ -0,0 +1,68 @@
+package prewarm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreVerifiesManifest(t *testing.T) {
+	opts := newHomes(t)
+	opts.RequireManifest = true
+	_, err := Restore(opts)
+	assert.Regexp(t, "has no manifest", err)
+
+	manifest, path, err := GenerateManifest(opts, ManifestOptions{ProductVersion: "8.5.2"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(opts.SharedHome, "index-snapshots", "IndexSnapshotManifest_1.json"), path)
+	assert.Equal(t, cachev1.ProductConfluence, manifest.Product)
+	assert.Equal(t, "1", manifest.SnapshotID)
+	assert.Equal(t, map[string]int64{"main_index": 42, "change_index": 42}, manifest.JournalIDs)
+	assert.Len(t, manifest.Indexes, 3)
+	assert.Equal(t, []ManifestFile{
+		{Path: "change/segments_1", Size: 6, SHA256: "12ea12eace7d655f471ce55e34f89b1b77a3d9d05a445ca82877dd2235beaa51"},
+	}, manifest.Indexes[1].Files)
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Contains(t, result.Reason, "verified")
+
+	// an extracted file that changed is reported
+	segments := filepath.Join(opts.LocalHome, "index", "segments_2")
+	assert.NoError(t, os.WriteFile(segments, []byte("mail"), 0644))
+	assert.Regexp(t, "segments_2 has SHA-256", manifest.verifyTree(filepath.Join(opts.LocalHome, "index")))
+	assert.NoError(t, os.Remove(segments))
+	assert.Regexp(t, "segments_2 was not extracted", manifest.verifyTree(filepath.Join(opts.LocalHome, "index")))
+}
+
+func TestRestoreRejectsArchiveNotMatchingManifest(t *testing.T) {
+	opts := newHomes(t)
+	_, _, err := GenerateManifest(opts, ManifestOptions{})
+	assert.NoError(t, err)
+
+	// a half-written archive
+	archive := filepath.Join(opts.SharedHome, "index-snapshots", "IndexSnapshot_edge_index_1.zip")
+	data, err := os.ReadFile(archive)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(archive, data[:len(data)/2], 0644))
+
+	_, err = Restore(opts)
+	assert.Regexp(t, "snapshot 1 does not match its manifest: IndexSnapshot_edge_index_1.zip is", err)
+	// nothing was extracted
+	_, err = os.Stat(filepath.Join(opts.LocalHome, "index"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreRejectsJournalIDNotMatchingManifest(t *testing.T) {
+	opts := newHomes(t)
+	_, _, err := GenerateManifest(opts, ManifestOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(opts.SharedHome, "index-snapshots", "IndexSnapshot_main_index_journal_id"), []byte("43"), 0644))
+
+	_, err = Restore(opts)
+	assert.Regexp(t, "the main_index journal id is 43, the manifest lists 42", err)
+}
@@ -0,0 +1,548 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prewarm restores the Confluence or Jira index of a local home from the index snapshots in shared home.
+// It is run by the pre-warmer pod with the prewarm subcommand of the operator binary
+package prewarm
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LockFile is created in the staging index directory while a snapshot is extracted to it
+const LockFile = "pre-warmer.lock"
+
+// snapshot is an index the product snapshots to shared home
+type snapshot struct {
+	// name of the index, and of its journal id file in the local home journal directory
+	name string
+	// dir the snapshot is extracted to, relative to the local home index directory
+	dir string
+	// archives and journalID are the glob patterns of the snapshot files
+	archives  string
+	journalID string
+}
+
+// snapshotsOf returns the indexes of a product, the main index first, with the patterns of a layout in the snapshot directory
+func snapshotsOf(product cachev1.Product, snapshotDir string, layout cachev1.SnapshotLayout) []snapshot {
+	if product == cachev1.ProductJira {
+		return []snapshot{{name: "jira_index", dir: ".", archives: filepath.Join(snapshotDir, layout.MainIndex)}}
+	}
+	return []snapshot{
+		{name: "main_index", dir: ".", archives: filepath.Join(snapshotDir, layout.MainIndex), journalID: filepath.Join(snapshotDir, layout.MainIndexJournalID)},
+		{name: "change_index", dir: "change", archives: filepath.Join(snapshotDir, layout.ChangeIndex), journalID: filepath.Join(snapshotDir, layout.ChangeIndexJournalID)},
+		{name: "edge_index", dir: "edge", archives: filepath.Join(snapshotDir, layout.EdgeIndex), journalID: filepath.Join(snapshotDir, layout.EdgeIndexJournalID)},
+	}
+}
+
+// Options of a restore
+type Options struct {
+	// Product selects the snapshot layout and the freshness check, Confluence if empty
+	Product    cachev1.Product
+	SharedHome string
+	LocalHome  string
+	// SnapshotsPath is the snapshot directory, the product's directory in SharedHome if empty
+	SnapshotsPath string
+	// Layout names the snapshot files, the omitted patterns are those of the product
+	Layout cachev1.SnapshotLayout
+	// RequireManifest fails restores of snapshots without a manifest. Snapshots with one are always verified
+	RequireManifest bool
+	// PublicKey, when set, fails restores of snapshots whose manifest is not signed by its private key
+	PublicKey ed25519.PublicKey
+	// VerifyIndex checks the restored Lucene indexes, the index is not replaced if the check fails
+	VerifyIndex bool
+	// KeepPreviousIndexes is the number of generations of replaced indexes kept for Rollback
+	KeepPreviousIndexes int
+	// RollbackTo is the generation of the kept index Rollback puts back, 1 being the index replaced by the last restore
+	RollbackTo int
+}
+
+// dirs returns the local home index directory and the directories replaced with it: the Confluence journal ids
+func (opts Options) dirs() (indexDir string, dirs []string) {
+	indexDir = filepath.Join(opts.LocalHome, cachev1.ProfileOf(opts.Product).IndexPath)
+	if opts.Product == cachev1.ProductJira {
+		return indexDir, []string{indexDir}
+	}
+	return indexDir, []string{indexDir, filepath.Join(opts.LocalHome, "journal")}
+}
+
+// snapshots returns the snapshot directory and the indexes snapshotted to it
+func (opts Options) snapshots() (string, []snapshot) {
+	profile := cachev1.ProfileOf(opts.Product)
+	snapshotDir := opts.SnapshotsPath
+	if snapshotDir == "" {
+		snapshotDir = filepath.Join(opts.SharedHome, profile.SnapshotsPath)
+	}
+	layout := opts.Layout
+	layout.Default(profile.SnapshotLayout)
+	return snapshotDir, snapshotsOf(opts.Product, snapshotDir, layout)
+}
+
+// Restore replaces the local home index by the snapshot in shared home, unless the local index is at least
+// as recent as the snapshot: its journal ids for Confluence, the snapshot it was restored from for Jira
+func Restore(opts Options) (*cachev1.RestoreResult, error) {
+	snapshotDir, snapshots := opts.snapshots()
+	indexDir, dirs := opts.dirs()
+	journalDir := filepath.Join(opts.LocalHome, "journal")
+	if err := resume(indexDir); err != nil {
+		return nil, err
+	}
+
+	mainSnapshot, err := newest(snapshots[0].archives)
+	if err != nil {
+		return nil, err
+	}
+	if mainSnapshot == "" {
+		return &cachev1.RestoreResult{
+			Outcome: cachev1.RestoreOutcomeSkipped,
+			Reason:  "No index snapshot in " + snapshotDir + ". Nothing to do",
+		}, nil
+	}
+	snapshotID := wildcard(filepath.Base(snapshots[0].archives), filepath.Base(mainSnapshot))
+	if rolledBack, err := readSnapshotID(indexDir + rolledBackSuffix); err != nil {
+		return nil, err
+	} else if rolledBack == snapshotID {
+		return skipped(snapshotID, nil, "The index restored from snapshot "+snapshotID+" was rolled back. Waiting for a newer snapshot"), nil
+	}
+	archives, err := archivesOf(opts.Product, snapshots, mainSnapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []cachev1.IndexRestoreResult
+	jiraSnapshot := filepath.Join(opts.LocalHome, jiraSnapshotFile)
+	if opts.Product == cachev1.ProductJira {
+		fresh, err := jiraUpToDate(indexDir, jiraSnapshot, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if fresh {
+			return skipped(snapshotID, nil, "Current index was restored from the latest snapshot in shared home. Nothing to do"), nil
+		}
+	} else {
+		if indexes, err = journalIDs(snapshots, journalDir); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(indexDir); err == nil {
+			if upToDate(indexes) {
+				return skipped(snapshotID, indexes, "Current index journal ids are not behind the ones in shared home. Nothing to do"), nil
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	manifest, data, err := readManifest(snapshotDir, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil && (opts.RequireManifest || opts.PublicKey != nil) {
+		return nil, fmt.Errorf("snapshot %s has no manifest %s", snapshotID, ManifestPath(snapshotDir, snapshotID))
+	}
+	var signature *cachev1.SignatureResult
+	if opts.PublicKey != nil {
+		if err := verifySignature(ManifestPath(snapshotDir, snapshotID), snapshotID, data, opts.PublicKey); err != nil {
+			return nil, err
+		}
+		signature = &cachev1.SignatureResult{Valid: true, Signer: manifest.Signer, KeyFingerprint: Fingerprint(opts.PublicKey)}
+	}
+	if manifest != nil {
+		if err := manifest.verifyArchives(snapshotDir, snapshots, archives, indexes); err != nil {
+			return nil, err
+		}
+	}
+
+	// the snapshot is extracted to staging directories, the index and the journal ids it is at are only
+	// replaced once it is verified
+	if err := stage(dirs...); err != nil {
+		return nil, err
+	}
+	defer unstage(dirs...)
+	stagingDir := indexDir + stagingSuffix
+	var result *cachev1.RestoreResult
+	if opts.Product == cachev1.ProductJira {
+		result, err = restoreJira(archives[0][0], stagingDir)
+	} else {
+		result, err = restore(snapshots, archives, stagingDir, journalDir+stagingSuffix, indexes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.SnapshotID = snapshotID
+	result.Signature = signature
+	if manifest != nil {
+		if err := manifest.verifyTree(stagingDir); err != nil {
+			return nil, err
+		}
+		result.Reason += ", verified against its manifest"
+		if signature != nil {
+			result.Reason += " signed by " + signature.KeyFingerprint
+		}
+	}
+	if opts.VerifyIndex {
+		verification, err := verifyIndex(stagingDir)
+		if err != nil {
+			_, statErr := os.Stat(indexDir)
+			return nil, &IndexError{SnapshotID: snapshotID, Reason: err.Error(), RolledBack: statErr == nil}
+		}
+		result.IndexVerification = verification
+		result.Reason += fmt.Sprintf(", %d Lucene indexes checked", verification.Indexes)
+	}
+
+	if err := os.WriteFile(filepath.Join(stagingDir, SnapshotFile), []byte(snapshotID), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filepath.Join(stagingDir, LockFile)); err != nil {
+		return nil, err
+	}
+	p, err := swapPlan(opts.KeepPreviousIndexes, dirs...)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Product == cachev1.ProductJira {
+		p.write(jiraSnapshot, snapshotID)
+	}
+	if err := p.apply(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func skipped(snapshotID string, indexes []cachev1.IndexRestoreResult, reason string) *cachev1.RestoreResult {
+	return &cachev1.RestoreResult{Outcome: cachev1.RestoreOutcomeSkipped, SnapshotID: snapshotID, Indexes: indexes, Reason: reason}
+}
+
+// archivesOf returns the archives extracted for each index, in extraction order. Confluence may split
+// an index across several archives, Jira keeps several snapshots and only the newest is restored
+func archivesOf(product cachev1.Product, snapshots []snapshot, mainSnapshot string) ([][]string, error) {
+	if product == cachev1.ProductJira {
+		return [][]string{{mainSnapshot}}, nil
+	}
+	archives := make([][]string, len(snapshots))
+	for i, s := range snapshots {
+		matches, err := filepath.Glob(s.archives)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		archives[i] = matches
+	}
+	return archives, nil
+}
+
+// wildcard returns the part of name matched by the wildcard of pattern, name if the pattern has none or several
+func wildcard(pattern, name string) string {
+	if strings.Count(pattern, "*") != 1 {
+		return name
+	}
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return name
+	}
+	return name[len(prefix) : len(name)-len(suffix)]
+}
+
+// journalIDs returns the journal ids of the snapshot and of the local home for each index, 0 when an id is unknown
+func journalIDs(snapshots []snapshot, journalDir string) ([]cachev1.IndexRestoreResult, error) {
+	var indexes []cachev1.IndexRestoreResult
+	for _, s := range snapshots {
+		journalIDFile, err := newest(s.journalID)
+		if err != nil {
+			return nil, err
+		}
+		snapshotJournalID, err := readJournalID(journalIDFile)
+		if err != nil {
+			return nil, err
+		}
+		localJournalID, err := readJournalID(filepath.Join(journalDir, s.name))
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, cachev1.IndexRestoreResult{
+			Name:              s.name,
+			SnapshotJournalID: snapshotJournalID,
+			LocalJournalID:    localJournalID,
+		})
+	}
+	return indexes, nil
+}
+
+// upToDate returns true if every index of the snapshot with a known journal id has been caught up with locally.
+// The main index has to have one, otherwise there is nothing to compare
+func upToDate(indexes []cachev1.IndexRestoreResult) bool {
+	for _, index := range indexes {
+		if index.SnapshotJournalID == 0 {
+			if index.Name == "main_index" {
+				return false
+			}
+			continue
+		}
+		if index.LocalJournalID < index.SnapshotJournalID {
+			return false
+		}
+	}
+	return true
+}
+
+// readJournalID reads a journal id written by Confluence, 0 if the file is missing or does not hold an id
+func readJournalID(path string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || id < 0 {
+		return 0, nil
+	}
+	return id, nil
+}
+
+// restore extracts the archives of each snapshot to an empty staging index directory and copies their journal ids.
+// The lock file is left for the caller to remove once the index is verified, before it replaces the index
+func restore(snapshots []snapshot, archives [][]string, indexDir, journalDir string, indexes []cachev1.IndexRestoreResult) (*cachev1.RestoreResult, error) {
+	if err := emptyIndexDir(indexDir, filepath.Join(indexDir, "change"), filepath.Join(indexDir, "edge"), journalDir); err != nil {
+		return nil, err
+	}
+
+	result := &cachev1.RestoreResult{Outcome: cachev1.RestoreOutcomeRestored, Reason: "Index restored from shared home"}
+	var missing []string
+	for i, s := range snapshots {
+		if len(archives[i]) == 0 {
+			missing = append(missing, s.name)
+			continue
+		}
+		index := indexes[i]
+		start := time.Now()
+		for _, archive := range archives[i] {
+			if err := extract(archive, filepath.Join(indexDir, s.dir), &index); err != nil {
+				return nil, err
+			}
+		}
+		index.Duration = metav1.Duration{Duration: time.Since(start).Round(time.Millisecond)}
+		result.Indexes = append(result.Indexes, index)
+		result.BytesRestored += index.BytesRestored
+		result.FilesRestored += index.FilesRestored
+
+		journalID, err := newest(s.journalID)
+		if err != nil {
+			return nil, err
+		}
+		if journalID != "" {
+			if err := copyFile(journalID, filepath.Join(journalDir, s.name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(missing) > 0 {
+		result.Outcome = cachev1.RestoreOutcomePartiallyRestored
+		result.Reason = "Index restored from shared home without " + strings.Join(missing, ", ") + ": no snapshot"
+	}
+	return result, nil
+}
+
+// IndexError is returned when a restored Lucene index fails the check of Options.VerifyIndex
+type IndexError struct {
+	SnapshotID string
+	Reason     string
+	// RolledBack is true if the previous index was kept, false if there was none
+	RolledBack bool
+}
+
+func (e *IndexError) Error() string {
+	message := "the index restored from snapshot " + e.SnapshotID + " failed verification: " + e.Reason
+	if e.RolledBack {
+		message += ". The previous index was kept"
+	}
+	return message
+}
+
+// emptyIndexDir removes the content of the index directory, creates dirs and the lock file
+func emptyIndexDir(indexDir string, dirs ...string) error {
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(indexDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(indexDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(indexDir, LockFile), nil, 0644)
+}
+
+// extract extracts the regular files and directories of a zip archive to dir and counts them in index
+func extract(archive, dir string, index *cachev1.IndexRestoreResult) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", archive, err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		target := filepath.Join(dir, file.Name)
+		if target != filepath.Clean(dir) && !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("%s: %s is outside of the extraction directory", archive, file.Name)
+		}
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			written, err := extractFile(file, target)
+			if err != nil {
+				return fmt.Errorf("cannot extract %s from %s: %v", file.Name, archive, err)
+			}
+			index.BytesRestored += written
+			index.FilesRestored++
+		}
+	}
+	return nil
+}
+
+func extractFile(file *zip.File, target string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return 0, err
+	}
+	return written, dst.Close()
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// newest returns the most recently modified file matching a pattern, nothing if there is none
+func newest(pattern string) (string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	var newestFile string
+	var newestTime time.Time
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return "", err
+		}
+		if newestFile == "" || info.ModTime().After(newestTime) {
+			newestFile, newestTime = match, info.ModTime()
+		}
+	}
+	return newestFile, nil
+}
+
+// MaxResultSize is the size of the termination message Kubernetes keeps for a container, longer messages are cut
+const MaxResultSize = 4096
+
+// maxReasonLength is the length reasons are trimmed to when a result does not fit in MaxResultSize
+const maxReasonLength = 1024
+
+// WriteResult writes a restore result as JSON to the termination message file of the container. A result that
+// does not fit in MaxResultSize is written without the index durations and with a trimmed reason, else only
+// with its outcome and a short reason, so that the message is never cut into invalid JSON
+func WriteResult(path string, result *cachev1.RestoreResult) error {
+	data, err := resultMessage(result)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// resultMessage returns the JSON of a result, trimmed to fit in MaxResultSize
+func resultMessage(result *cachev1.RestoreResult) ([]byte, error) {
+	data, err := json.Marshal(result)
+	if err != nil || len(data) <= MaxResultSize {
+		return data, err
+	}
+
+	trimmed := *result
+	trimmed.Reason = trimReason(result.Reason, maxReasonLength)
+	trimmed.Indexes = make([]cachev1.IndexRestoreResult, len(result.Indexes))
+	for i, index := range result.Indexes {
+		index.Duration = metav1.Duration{}
+		trimmed.Indexes[i] = index
+	}
+	data, err = json.Marshal(&trimmed)
+	if err != nil || len(data) <= MaxResultSize {
+		return data, err
+	}
+
+	short := &cachev1.RestoreResult{
+		Outcome:    result.Outcome,
+		SnapshotID: trimReason(result.SnapshotID, 255),
+		Reason:     trimReason(result.Reason, 255) + " (the result of " + strconv.Itoa(len(data)) + " bytes was too large to report)",
+	}
+	return json.Marshal(short)
+}
+
+// trimReason returns s cut to at most maxLength bytes without splitting a character, marked with an ellipsis
+func trimReason(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	end := maxLength - len("...")
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + "..."
+}
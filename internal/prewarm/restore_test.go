@@ -0,0 +1,269 @@
+package prewarm
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+}
+
+func newHomes(t *testing.T) Options {
+	opts := Options{SharedHome: t.TempDir(), LocalHome: t.TempDir()}
+	snapshotDir := filepath.Join(opts.SharedHome, "index-snapshots")
+	assert.NoError(t, os.MkdirAll(snapshotDir, 0755))
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_main_index_1.zip"), map[string]string{"segments_2": "main", "_0.cfs": "main"})
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_change_index_1.zip"), map[string]string{"segments_1": "change"})
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_edge_index_1.zip"), map[string]string{"segments_1": "edge"})
+	for _, name := range []string{"main_index", "change_index"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(snapshotDir, "IndexSnapshot_"+name+"_journal_id"), []byte("42"), 0644))
+	}
+	return opts
+}
+
+func TestRestoreMissingIndex(t *testing.T) {
+	opts := newHomes(t)
+	// stale files are removed
+	assert.NoError(t, os.MkdirAll(filepath.Join(opts.LocalHome, "index"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(opts.LocalHome, "index", "stale"), nil, 0644))
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Equal(t, "1", result.SnapshotID)
+	assert.Equal(t, int64(4), result.FilesRestored)
+	assert.Equal(t, int64(18), result.BytesRestored)
+	assert.Len(t, result.Indexes, 3)
+
+	for path, content := range map[string]string{
+		"index/segments_2":        "main",
+		"index/_0.cfs":            "main",
+		"index/change/segments_1": "change",
+		"index/edge/segments_1":   "edge",
+		"journal/main_index":      "42",
+		"journal/change_index":    "42",
+	} {
+		data, err := os.ReadFile(filepath.Join(opts.LocalHome, path))
+		assert.NoError(t, err, path)
+		assert.Equal(t, content, string(data), path)
+	}
+	for _, path := range []string{"index/stale", "index/" + LockFile, "journal/edge_index"} {
+		_, err := os.Stat(filepath.Join(opts.LocalHome, path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+
+	// the journal ids of the restored index are those of the snapshot
+	result, err = Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeSkipped, result.Outcome)
+	assert.Equal(t, "1", result.SnapshotID)
+	assert.Equal(t, int64(42), result.Indexes[0].LocalJournalID)
+	assert.Equal(t, int64(42), result.Indexes[0].SnapshotJournalID)
+}
+
+func TestRestoreOutdatedIndex(t *testing.T) {
+	opts := newHomes(t)
+	// the local index is modified after the snapshot but has not caught up with its journal
+	segments := filepath.Join(opts.LocalHome, "index", "segments_1")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(segments), 0755))
+	assert.NoError(t, os.WriteFile(segments, []byte("local"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(opts.LocalHome, "journal"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(opts.LocalHome, "journal", "main_index"), []byte("42\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(opts.LocalHome, "journal", "change_index"), []byte("41\n"), 0644))
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Equal(t, "change_index", result.Indexes[1].Name)
+	assert.Equal(t, int64(41), result.Indexes[1].LocalJournalID)
+	assert.Equal(t, int64(42), result.Indexes[1].SnapshotJournalID)
+	_, err = os.Stat(segments)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreSkipsIndexCaughtUpWithJournal(t *testing.T) {
+	opts := newHomes(t)
+	// modification times are ignored, e.g. after a copy of the local home that did not preserve them
+	segments := filepath.Join(opts.LocalHome, "index", "segments_1")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(segments), 0755))
+	assert.NoError(t, os.WriteFile(segments, []byte("local"), 0644))
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(segments, old, old))
+	assert.NoError(t, os.MkdirAll(filepath.Join(opts.LocalHome, "journal"), 0755))
+	for name, id := range map[string]string{"main_index": "43", "change_index": "42"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(opts.LocalHome, "journal", name), []byte(id), 0644))
+	}
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeSkipped, result.Outcome)
+	data, err := os.ReadFile(segments)
+	assert.NoError(t, err)
+	assert.Equal(t, "local", string(data))
+}
+
+func TestRestoreWithoutJournalID(t *testing.T) {
+	opts := newHomes(t)
+	assert.NoError(t, os.Remove(filepath.Join(opts.SharedHome, "index-snapshots", "IndexSnapshot_main_index_journal_id")))
+	assert.NoError(t, os.MkdirAll(filepath.Join(opts.LocalHome, "index"), 0755))
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Zero(t, result.Indexes[0].SnapshotJournalID)
+}
+
+func TestRestoreWithoutEdgeSnapshot(t *testing.T) {
+	opts := newHomes(t)
+	assert.NoError(t, os.Remove(filepath.Join(opts.SharedHome, "index-snapshots", "IndexSnapshot_edge_index_1.zip")))
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomePartiallyRestored, result.Outcome)
+	assert.Contains(t, result.Reason, "edge_index")
+	assert.Len(t, result.Indexes, 2)
+}
+
+func TestRestoreWithoutSnapshot(t *testing.T) {
+	result, err := Restore(Options{SharedHome: t.TempDir(), LocalHome: t.TempDir()})
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeSkipped, result.Outcome)
+	assert.Empty(t, result.SnapshotID)
+}
+
+func TestRestoreRelocatedSnapshots(t *testing.T) {
+	opts := Options{SharedHome: t.TempDir(), LocalHome: t.TempDir()}
+	opts.SnapshotsPath = filepath.Join(opts.SharedHome, "backups", "index")
+	opts.Layout = cachev1.SnapshotLayout{MainIndex: "main-*.zip", MainIndexJournalID: "main.journal"}
+	assert.NoError(t, os.MkdirAll(opts.SnapshotsPath, 0755))
+	writeZip(t, filepath.Join(opts.SnapshotsPath, "main-20230301.zip"), map[string]string{"segments_2": "main"})
+	assert.NoError(t, os.WriteFile(filepath.Join(opts.SnapshotsPath, "main.journal"), []byte("7"), 0644))
+	// the omitted patterns keep the Confluence names
+	writeZip(t, filepath.Join(opts.SnapshotsPath, "IndexSnapshot_change_index_1.zip"), map[string]string{"segments_1": "change"})
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomePartiallyRestored, result.Outcome)
+	assert.Equal(t, "20230301", result.SnapshotID)
+	assert.Equal(t, int64(7), result.Indexes[0].SnapshotJournalID)
+	for path, content := range map[string]string{
+		"index/segments_2":        "main",
+		"index/change/segments_1": "change",
+		"journal/main_index":      "7",
+	} {
+		data, err := os.ReadFile(filepath.Join(opts.LocalHome, path))
+		assert.NoError(t, err, path)
+		assert.Equal(t, content, string(data), path)
+	}
+}
+
+func TestRestoreJiraIndex(t *testing.T) {
+	opts := Options{Product: cachev1.ProductJira, SharedHome: t.TempDir(), LocalHome: t.TempDir()}
+	snapshotDir := filepath.Join(opts.SharedHome, "export", "indexsnapshots")
+	assert.NoError(t, os.MkdirAll(snapshotDir, 0755))
+	writeZip(t, filepath.Join(snapshotDir, "IndexSnapshot_10100.zip"), map[string]string{"issues/segments_3": "issues", "comments/segments_1": "comments"})
+	indexDir := filepath.Join(opts.LocalHome, "caches", "indexesV1")
+	assert.NoError(t, os.MkdirAll(filepath.Join(indexDir, "issues"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(indexDir, "issues", "stale"), nil, 0644))
+
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Equal(t, "10100", result.SnapshotID)
+	assert.Equal(t, int64(2), result.FilesRestored)
+	data, err := os.ReadFile(filepath.Join(indexDir, "issues", "segments_3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "issues", string(data))
+	for _, path := range []string{"issues/stale", LockFile} {
+		_, err := os.Stat(filepath.Join(indexDir, path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+
+	// the index was restored from the latest snapshot
+	result, err = Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeSkipped, result.Outcome)
+
+	// a newer snapshot is restored
+	newer := filepath.Join(snapshotDir, "IndexSnapshot_10200.zip")
+	writeZip(t, newer, map[string]string{"issues/segments_4": "issues"})
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(newer, later, later))
+	result, err = Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Equal(t, "10200", result.SnapshotID)
+}
+
+func TestWildcard(t *testing.T) {
+	assert.Equal(t, "1", wildcard("IndexSnapshot_main_index_*.zip", "IndexSnapshot_main_index_1.zip"))
+	assert.Equal(t, "main.zip", wildcard("main.zip", "main.zip"))
+	assert.Equal(t, "main-1-2.zip", wildcard("main-*-*.zip", "main-1-2.zip"))
+}
+
+func TestExtractRejectsPathsOutsideDir(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.zip")
+	writeZip(t, archive, map[string]string{"../evil": "evil"})
+	dir := filepath.Join(t.TempDir(), "index")
+	assert.Error(t, extract(archive, dir, &cachev1.IndexRestoreResult{}))
+	_, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWriteResultFitsInTerminationMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+	result := &cachev1.RestoreResult{Outcome: cachev1.RestoreOutcomeRestored, SnapshotID: "42", Reason: "Index restored"}
+	assert.NoError(t, WriteResult(path, result))
+	written := readResult(t, path)
+	assert.Equal(t, result, written)
+
+	// a long reason is trimmed and the index durations dropped
+	result.Reason = strings.Repeat("é", 3000)
+	result.Indexes = []cachev1.IndexRestoreResult{{Name: "main_index", SnapshotJournalID: 42, Duration: metav1.Duration{Duration: time.Minute}}}
+	assert.NoError(t, WriteResult(path, result))
+	written = readResult(t, path)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, written.Outcome)
+	assert.Equal(t, "main_index", written.Indexes[0].Name)
+	assert.Zero(t, written.Indexes[0].Duration.Duration)
+	assert.True(t, strings.HasSuffix(written.Reason, "é..."))
+
+	// a result that still does not fit only keeps its outcome
+	for i := 0; i < 100; i++ {
+		result.Indexes = append(result.Indexes, cachev1.IndexRestoreResult{Name: strings.Repeat("x", 100)})
+	}
+	assert.NoError(t, WriteResult(path, result))
+	written = readResult(t, path)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, written.Outcome)
+	assert.Equal(t, "42", written.SnapshotID)
+	assert.Empty(t, written.Indexes)
+	assert.Contains(t, written.Reason, "too large to report")
+}
+
+func readResult(t *testing.T, path string) *cachev1.RestoreResult {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(data), MaxResultSize)
+	result := &cachev1.RestoreResult{}
+	assert.NoError(t, json.Unmarshal(data, result))
+	return result
+}
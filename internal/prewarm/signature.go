@@ -0,0 +1,127 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prewarm
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SignaturePath returns the path of the signature of a manifest: the base64 ed25519 signature of the manifest bytes
+func SignaturePath(manifestPath string) string {
+	return manifestPath + ".sig"
+}
+
+// SignatureError is returned when a snapshot manifest is not signed by the private key of the verification key
+type SignatureError struct {
+	SnapshotID     string
+	KeyFingerprint string
+	Reason         string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("snapshot %s is not signed by key %s: %s", e.SnapshotID, e.KeyFingerprint, e.Reason)
+}
+
+// ReadPublicKey reads a PEM encoded PKIX ed25519 public key, as written by openssl pkey -pubout
+func ReadPublicKey(name string) (ed25519.PublicKey, error) {
+	der, err := readPEM(name, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the public key %s: %v", name, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is a %T, not an ed25519 key", name, key)
+	}
+	return publicKey, nil
+}
+
+// ReadPrivateKey reads a PEM encoded PKCS #8 ed25519 private key, as written by openssl genpkey -algorithm ed25519
+func ReadPrivateKey(name string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(name, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the private key %s: %v", name, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is a %T, not an ed25519 key", name, key)
+	}
+	return privateKey, nil
+}
+
+func readPEM(name, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not hold a PEM encoded %s", name, strings.ToLower(blockType))
+	}
+	return block.Bytes, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a public key, in the format of ssh-keygen -l
+func Fingerprint(key ed25519.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func writeSignature(name string, data []byte, key ed25519.PrivateKey) error {
+	signature := ed25519.Sign(key, data)
+	return os.WriteFile(name, []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644)
+}
+
+// verifySignature checks the manifest bytes of a snapshot were signed by the private key of the public key
+func verifySignature(manifestPath, snapshotID string, data []byte, key ed25519.PublicKey) error {
+	fail := func(format string, args ...interface{}) error {
+		return &SignatureError{SnapshotID: snapshotID, KeyFingerprint: Fingerprint(key), Reason: fmt.Sprintf(format, args...)}
+	}
+	encoded, err := os.ReadFile(SignaturePath(manifestPath))
+	if os.IsNotExist(err) {
+		return fail("the manifest has no signature %s", SignaturePath(manifestPath))
+	}
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fail("the signature is not base64 encoded: %v", err)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return fail("the signature does not match the manifest")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package prewarm
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	return publicKey, privateKey
+}
+
+func TestRestoreVerifiesSignature(t *testing.T) {
+	opts := newHomes(t)
+	publicKey, privateKey := newKey(t)
+	opts.PublicKey = publicKey
+	_, err := Restore(opts)
+	assert.Regexp(t, "has no manifest", err)
+
+	// an unsigned manifest
+	_, path, err := GenerateManifest(opts, ManifestOptions{})
+	assert.NoError(t, err)
+	_, err = Restore(opts)
+	var signatureErr *SignatureError
+	assert.True(t, errors.As(err, &signatureErr))
+	assert.Equal(t, Fingerprint(publicKey), signatureErr.KeyFingerprint)
+	assert.Regexp(t, "has no signature", err)
+
+	// a manifest signed by another key
+	_, otherKey := newKey(t)
+	_, _, err = GenerateManifest(opts, ManifestOptions{Signer: "mallory", SigningKey: otherKey})
+	assert.NoError(t, err)
+	_, err = Restore(opts)
+	assert.Regexp(t, "snapshot 1 is not signed by key SHA256:.*: the signature does not match the manifest", err)
+	_, err = os.Stat(filepath.Join(opts.LocalHome, "index"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, _, err = GenerateManifest(opts, ManifestOptions{Signer: "ci", SigningKey: privateKey})
+	assert.NoError(t, err)
+	result, err := Restore(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cachev1.RestoreOutcomeRestored, result.Outcome)
+	assert.Equal(t, &cachev1.SignatureResult{Valid: true, Signer: "ci", KeyFingerprint: Fingerprint(publicKey)}, result.Signature)
+
+	// a manifest edited after signing
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, append(data, '\n'), 0644))
+	assert.NoError(t, os.RemoveAll(filepath.Join(opts.LocalHome, "index")))
+	_, err = Restore(opts)
+	assert.Regexp(t, "the signature does not match the manifest", err)
+}
+
+func TestReadKeys(t *testing.T) {
+	publicKey, privateKey := newKey(t)
+	dir := t.TempDir()
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.NoError(t, err)
+	publicKeyFile := filepath.Join(dir, "public-key.pem")
+	assert.NoError(t, os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644))
+	der, err = x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	privateKeyFile := filepath.Join(dir, "private-key.pem")
+	assert.NoError(t, os.WriteFile(privateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	read, err := ReadPublicKey(publicKeyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, read)
+	readPrivate, err := ReadPrivateKey(privateKeyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, readPrivate)
+
+	_, err = ReadPublicKey(privateKeyFile)
+	assert.Regexp(t, "does not hold a PEM encoded public key", err)
+}
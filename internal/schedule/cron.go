@@ -0,0 +1,256 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed standard five field cron expression: minute hour day-of-month month day-of-week, or an
+// "@every <duration>" expression.
+// Expressions are parsed here rather than with a cron library because schedules only accept what a
+// CronJob schedule accepts, without seconds or CRON_TZ prefixes, the location being set by the
+// schedule, and because the window checks need the fields themselves, not just the next fire time.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// when both day fields are restricted a day matches either of them, as in Vixie cron
+	domRestricted, dowRestricted bool
+	// every is the delay of an "@every <duration>" expression, which fires at a fixed interval instead of
+	// at the times of the fields
+	every time.Duration
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted as Sunday and folded into 0
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// everyMacro prefixes a fixed interval, e.g. "@every 6h"
+const everyMacro = "@every "
+
+// cronSearchLimit bounds the search for the next fire time of expressions like "0 0 30 2 *" that never fire
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses a five field cron expression, one of the @yearly, @monthly, @weekly, @daily and @hourly
+// macros or "@every <duration>" with a Go duration of at least a minute, e.g. "@every 1h30m"
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(strings.ToLower(expr), everyMacro) {
+		every, err := time.ParseDuration(strings.TrimSpace(expr[len(everyMacro):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @every duration: %v", err)
+		}
+		if every < time.Minute {
+			return nil, fmt.Errorf("invalid @every duration %s, expected at least 1m", every)
+		}
+		return &Cron{every: every}, nil
+	}
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d: %q", len(fields), expr)
+	}
+
+	c := &Cron{}
+	var err error
+	if c.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if c.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if c.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if c.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if c.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	c.domRestricted = !isWildcard(fields[2])
+	c.dowRestricted = !isWildcard(fields[4])
+	return c, nil
+}
+
+// Next returns the first fire time strictly after t, in the location of t, t plus the delay of an @every
+// expression. The zero time is returned if the expression never fires.
+func (c *Cron) Next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+	loc := t.Location()
+	limit := t.Add(cronSearchLimit)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			// an ambiguous hour at the end of daylight saving time resolves to its first occurrence
+			if !next.After(t) {
+				next = next.Add(time.Hour)
+			}
+			t = next
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// mayFireOn returns true if the expression fires on some of the given days of the week.
+// Days of the month fall on every day of the week over the years.
+func (c *Cron) mayFireOn(day time.Weekday) bool {
+	if c.every > 0 {
+		return true
+	}
+	if c.dowRestricted && !c.domRestricted {
+		return c.dow&(1<<uint(day)) != 0
+	}
+	return true
+}
+
+// firesAt returns true if the expression fires at the given hour and minute of the days it fires on
+func (c *Cron) firesAt(hour, minute int) bool {
+	if c.every > 0 {
+		return true
+	}
+	return c.hour&(1<<uint(hour)) != 0 && c.minute&(1<<uint(minute)) != 0
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parse returns a bit set of the values matched by a comma separated list of
+// values, ranges and steps, e.g. "1,15-20,*/5"
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step in %q", f.name, part)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			low, high = f.min, f.max
+			if f.max == 7 {
+				// Sunday is already included as 0
+				high = 6
+			}
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangePart)
+			}
+		default:
+			var err error
+			if low, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			high = low
+			// "5/15" means every 15 starting at 5
+			if step > 1 {
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected a value between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
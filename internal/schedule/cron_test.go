@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseTime(t *testing.T, value string, loc *time.Location) time.Time {
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	assert.NoError(t, err)
+	return parsed
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr, from, next string
+	}{
+		{"*/15 * * * *", "2023-03-01 10:07", "2023-03-01 10:15"},
+		{"0 2 * * *", "2023-03-01 02:00", "2023-03-02 02:00"},
+		{"30 1 * * mon-fri", "2023-03-03 12:00", "2023-03-06 01:30"},
+		{"0 0 1 jan *", "2023-03-01 00:00", "2024-01-01 00:00"},
+		{"0 0 * * 7", "2023-03-01 00:00", "2023-03-05 00:00"},
+		{"5/20 3 * * *", "2023-03-01 03:06", "2023-03-01 03:25"},
+		{"@weekly", "2023-03-01 00:00", "2023-03-05 00:00"},
+		{"0 0 29 2 *", "2023-03-01 00:00", "2024-02-29 00:00"},
+		// day of month and day of week match either of them when both are restricted
+		{"0 0 13 * fri", "2023-03-01 00:00", "2023-03-03 00:00"},
+		{"0 0 1 * mon", "2023-03-01 00:00", "2023-03-06 00:00"},
+		{"0 0 1 * mon", "2023-03-27 00:00", "2023-04-01 00:00"},
+		// and only the restricted one matters when the other is a wildcard
+		{"0 0 */10 * *", "2023-03-01 00:00", "2023-03-11 00:00"},
+		{"0 0 13 * ?", "2023-03-01 00:00", "2023-03-13 00:00"},
+		{"0 0 ? * sun", "2023-03-01 00:00", "2023-03-05 00:00"},
+		// 7 is Sunday, alone, in a list or ending a range
+		{"0 0 * * 0,7", "2023-03-01 00:00", "2023-03-05 00:00"},
+		{"0 0 * * 5-7", "2023-03-01 00:00", "2023-03-03 00:00"},
+		{"0 0 * * 5-7", "2023-03-04 00:00", "2023-03-05 00:00"},
+		{"0 0 * * 6-7", "2023-03-05 00:00", "2023-03-11 00:00"},
+		// @every fires at a fixed interval from the previous fire time
+		{"@every 90m", "2023-03-01 10:07", "2023-03-01 11:37"},
+		{"@every 24h", "2023-03-01 10:07", "2023-03-02 10:07"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, mustParseTime(t, tt.next, time.UTC), c.Next(mustParseTime(t, tt.from, time.UTC)))
+		})
+	}
+}
+
+func TestCronNextNeverFires(t *testing.T) {
+	c, err := ParseCron("0 0 30 2 *")
+	assert.NoError(t, err)
+	assert.True(t, c.Next(time.Now()).IsZero())
+}
+
+func TestCronNextAcrossDaylightSavingTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	assert.NoError(t, err)
+	c, err := ParseCron("30 2 * * *")
+	assert.NoError(t, err)
+
+	// 02:30 does not exist on 2023-03-26, the clock jumps from 02:00 to 03:00
+	next := c.Next(mustParseTime(t, "2023-03-25 03:00", loc))
+	assert.Equal(t, mustParseTime(t, "2023-03-27 02:30", loc), next)
+
+	hourly, err := ParseCron("0 * * * *")
+	assert.NoError(t, err)
+	next = hourly.Next(mustParseTime(t, "2023-10-29 01:30", loc))
+	assert.Equal(t, 2, next.Hour())
+	assert.True(t, hourly.Next(next).After(next))
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *",
+		"@every", "@every 1d", "@every 0s", "@every -1h", "@every 30s"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
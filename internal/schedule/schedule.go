@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schedule decides when pre-warming runs may start
+package schedule
+
+import (
+	"time"
+)
+
+// windowSearchLimit bounds the search for a time allowed by maintenance and blackout windows,
+// windows repeat weekly so nothing is found later if nothing is found within a week
+const windowSearchLimit = 8 * 24 * time.Hour
+
+// Schedule combines a cron expression or a fixed interval with the windows runs may start in
+type Schedule struct {
+	// Cron, if set, takes precedence over Interval
+	Cron     *Cron
+	Interval time.Duration
+	// Location the cron expression and the windows are evaluated in
+	Location *time.Location
+	// Maintenance windows, if any, are the only times a run may start
+	Maintenance []Window
+	// Blackout windows are times a run never starts, they take precedence over maintenance windows
+	Blackout []Window
+}
+
+// Allowed returns true if a run may start at t
+func (s *Schedule) Allowed(t time.Time) bool {
+	t = t.In(s.location())
+	return s.allowedAt(t.Weekday(), t.Hour()*60+t.Minute())
+}
+
+func (s *Schedule) allowedAt(day time.Weekday, minute int) bool {
+	for _, w := range s.Blackout {
+		if w.contains(day, minute) {
+			return false
+		}
+	}
+	if len(s.Maintenance) == 0 {
+		return true
+	}
+	for _, w := range s.Maintenance {
+		if w.contains(day, minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// cronFiresInWindows returns false if the cron expression never fires at a time of the week the
+// windows allow, e.g. "0 12 * * *" with a 01:00-05:00 maintenance window. Next would otherwise
+// go through every fire time within cronSearchLimit before giving up.
+func (s *Schedule) cronFiresInWindows() bool {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if !s.Cron.mayFireOn(day) {
+			continue
+		}
+		for minute := 0; minute < 24*60; minute++ {
+			if s.Cron.firesAt(minute/60, minute%60) && s.allowedAt(day, minute) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Next returns the time the run following one that completed at last is due: the first
+// allowed cron fire time, or the first allowed time once the interval, or the delay of an
+// @every expression, has elapsed.
+// The zero time is returned if no run can ever start. Once the cron expression is known to fire
+// at a time of the week the windows allow, such a fire time is found within weeks, or months
+// for expressions restricted to some days of the month.
+func (s *Schedule) Next(last time.Time) time.Time {
+	last = last.In(s.location())
+	if s.Cron == nil {
+		return s.NextAllowed(last.Add(s.Interval))
+	}
+	if s.Cron.every > 0 {
+		return s.NextAllowed(last.Add(s.Cron.every))
+	}
+	if !s.cronFiresInWindows() {
+		return time.Time{}
+	}
+
+	limit := last.Add(cronSearchLimit)
+	for t := s.Cron.Next(last); !t.IsZero() && t.Before(limit); t = s.Cron.Next(t) {
+		if s.Allowed(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// NextAllowed returns t if a run may start at t, otherwise the first minute after t
+// a run may start at. The zero time is returned if no run can ever start.
+func (s *Schedule) NextAllowed(t time.Time) time.Time {
+	t = t.In(s.location())
+	if s.Allowed(t) {
+		return t
+	}
+	limit := t.Add(windowSearchLimit)
+	for t = t.Truncate(time.Minute).Add(time.Minute); t.Before(limit); t = t.Add(time.Minute) {
+		if s.Allowed(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+	return s.Location
+}
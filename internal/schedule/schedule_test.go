@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseWindow(t *testing.T, days []string, start, end string) Window {
+	w, err := ParseWindow(days, start, end)
+	assert.NoError(t, err)
+	return w
+}
+
+func TestWindowContains(t *testing.T) {
+	weekdays := mustParseWindow(t, []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, "08:00", "18:00")
+	// 2023-03-03 is a Friday
+	assert.True(t, weekdays.Contains(mustParseTime(t, "2023-03-03 08:00", time.UTC)))
+	assert.False(t, weekdays.Contains(mustParseTime(t, "2023-03-03 18:00", time.UTC)))
+	assert.False(t, weekdays.Contains(mustParseTime(t, "2023-03-04 12:00", time.UTC)))
+
+	overnight := mustParseWindow(t, []string{"Fri"}, "22:00", "04:00")
+	assert.True(t, overnight.Contains(mustParseTime(t, "2023-03-03 23:00", time.UTC)))
+	assert.True(t, overnight.Contains(mustParseTime(t, "2023-03-04 03:59", time.UTC)))
+	assert.False(t, overnight.Contains(mustParseTime(t, "2023-03-03 03:00", time.UTC)))
+
+	wholeDay := mustParseWindow(t, []string{"Sun"}, "00:00", "00:00")
+	assert.True(t, wholeDay.Contains(mustParseTime(t, "2023-03-05 13:00", time.UTC)))
+	assert.False(t, wholeDay.Contains(mustParseTime(t, "2023-03-06 13:00", time.UTC)))
+}
+
+func TestParseWindowRejectsInvalidValues(t *testing.T) {
+	_, err := ParseWindow([]string{"Someday"}, "08:00", "18:00")
+	assert.Error(t, err)
+	_, err = ParseWindow(nil, "8am", "18:00")
+	assert.Error(t, err)
+	_, err = ParseWindow(nil, "08:00", "24:00")
+	assert.Error(t, err)
+}
+
+func TestIntervalScheduleSkipsBlackoutWindows(t *testing.T) {
+	s := &Schedule{
+		Interval: 30 * time.Minute,
+		Blackout: []Window{mustParseWindow(t, nil, "08:00", "18:00")},
+	}
+	assert.Equal(t, mustParseTime(t, "2023-03-03 07:30", time.UTC), s.Next(mustParseTime(t, "2023-03-03 07:00", time.UTC)))
+	assert.Equal(t, mustParseTime(t, "2023-03-03 18:00", time.UTC), s.Next(mustParseTime(t, "2023-03-03 07:45", time.UTC)))
+	assert.Equal(t, mustParseTime(t, "2023-03-03 18:00", time.UTC), s.NextAllowed(mustParseTime(t, "2023-03-03 12:00", time.UTC)))
+}
+
+func TestEveryScheduleSkipsBlackoutWindows(t *testing.T) {
+	every, err := ParseCron("@every 30m")
+	assert.NoError(t, err)
+	s := &Schedule{
+		Cron:     every,
+		Blackout: []Window{mustParseWindow(t, nil, "08:00", "18:00")},
+	}
+	assert.Equal(t, mustParseTime(t, "2023-03-03 07:30", time.UTC), s.Next(mustParseTime(t, "2023-03-03 07:00", time.UTC)))
+	assert.Equal(t, mustParseTime(t, "2023-03-03 18:00", time.UTC), s.Next(mustParseTime(t, "2023-03-03 07:45", time.UTC)))
+}
+
+func TestCronScheduleInMaintenanceWindowsAndTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	hourly, err := ParseCron("@hourly")
+	assert.NoError(t, err)
+	s := &Schedule{
+		Cron:        hourly,
+		Location:    loc,
+		Maintenance: []Window{mustParseWindow(t, []string{"Sat", "Sun"}, "01:00", "05:00")},
+		Blackout:    []Window{mustParseWindow(t, nil, "03:00", "04:00")},
+	}
+
+	// Friday noon in New York, the first allowed fire time is Saturday 01:00
+	next := s.Next(mustParseTime(t, "2023-03-03 12:00", loc))
+	assert.Equal(t, mustParseTime(t, "2023-03-04 01:00", loc), next)
+	next = s.Next(mustParseTime(t, "2023-03-04 02:00", loc))
+	assert.Equal(t, mustParseTime(t, "2023-03-04 04:00", loc), next)
+	assert.Equal(t, loc, next.Location())
+}
+
+func TestScheduleThatNeverAllowsARun(t *testing.T) {
+	s := &Schedule{
+		Interval: time.Hour,
+		Blackout: []Window{mustParseWindow(t, nil, "00:00", "00:00")},
+	}
+	assert.True(t, s.Next(time.Now()).IsZero())
+	assert.True(t, s.NextAllowed(time.Now()).IsZero())
+}
+
+func TestCronScheduleOutsideMaintenanceWindows(t *testing.T) {
+	everyOddMinute, err := ParseCron("1-59/2 * * * *")
+	assert.NoError(t, err)
+	s := &Schedule{
+		Cron:        everyOddMinute,
+		Maintenance: []Window{mustParseWindow(t, []string{"Sat"}, "01:00", "01:01")},
+	}
+	assert.True(t, s.Next(mustParseTime(t, "2023-03-03 12:00", time.UTC)).IsZero())
+
+	// the 1st of the month is a Saturday in April 2023
+	firstOfMonth, err := ParseCron("0 2 1 * *")
+	assert.NoError(t, err)
+	s = &Schedule{
+		Cron:        firstOfMonth,
+		Maintenance: []Window{mustParseWindow(t, []string{"Sat"}, "01:00", "03:00")},
+	}
+	assert.Equal(t, mustParseTime(t, "2023-04-01 02:00", time.UTC), s.Next(mustParseTime(t, "2023-03-03 12:00", time.UTC)))
+
+	mondays, err := ParseCron("0 2 * * Mon")
+	assert.NoError(t, err)
+	s.Cron = mondays
+	assert.True(t, s.Next(mustParseTime(t, "2023-03-03 12:00", time.UTC)).IsZero())
+}
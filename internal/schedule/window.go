@@ -0,0 +1,90 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a time of day range repeated on some days of the week
+type Window struct {
+	// days the window opens on, a window spanning midnight closes the day after
+	days uint8
+	// start and end are minutes since midnight, start == end is a whole day
+	start, end int
+}
+
+// ParseWindow parses a window opening at start and closing at end, both HH:MM, on the
+// given days (Mon, Tue, ...). A window opens every day when no days are given.
+func ParseWindow(days []string, start, end string) (Window, error) {
+	w := Window{}
+	for _, day := range days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return Window{}, fmt.Errorf("invalid day of week %q", day)
+		}
+		w.days |= 1 << uint(weekday)
+	}
+	if w.days == 0 {
+		w.days = 1<<7 - 1
+	}
+
+	var err error
+	if w.start, err = parseTimeOfDay(start); err != nil {
+		return Window{}, err
+	}
+	if w.end, err = parseTimeOfDay(end); err != nil {
+		return Window{}, err
+	}
+	return w, nil
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains returns true if t, in its own location, falls within the window
+func (w Window) Contains(t time.Time) bool {
+	return w.contains(t.Weekday(), t.Hour()*60+t.Minute())
+}
+
+// contains returns true if the minute since midnight of the given day falls within the window
+func (w Window) contains(day time.Weekday, minute int) bool {
+	opensOn := func(day time.Weekday) bool { return w.days&(1<<uint(day)) != 0 }
+	yesterday := (day + 6) % 7
+
+	switch {
+	case w.start == w.end:
+		return opensOn(day)
+	case w.start < w.end:
+		return opensOn(day) && minute >= w.start && minute < w.end
+	default:
+		// spans midnight
+		return (opensOn(day) && minute >= w.start) || (opensOn(yesterday) && minute < w.end)
+	}
+}
@@ -17,21 +17,30 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"os"
+	"strconv"
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	cachev1 "bianchi2/dc-cache-backup-operator/api/v1"
 	cachev1beta1 "bianchi2/dc-cache-backup-operator/api/v1beta1"
 	"bianchi2/dc-cache-backup-operator/controllers"
+	prewarmpkg "bianchi2/dc-cache-backup-operator/internal/prewarm"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -44,19 +53,57 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(cachev1beta1.AddToScheme(scheme))
+	utilruntime.Must(cachev1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	// the pre-warmer pod runs the operator image with the prewarm subcommand
+	if len(os.Args) > 1 && os.Args[1] == "prewarm" {
+		os.Exit(prewarm(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "manifest" {
+		os.Exit(manifest(os.Args[2:]))
+	}
 
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var defaultCPURequest, defaultMemoryRequest string
+	var emergencyStop controllers.EmergencyStop
+	var preWarmerImage string
+	defaults := cachev1.ConfluenceDefaults()
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&defaults.SharedHomePVCName, "default-shared-home-pvc-name", defaults.SharedHomePVCName,
+		"Shared home PVC used when a CacheBackupRequest omits it. Defaults to <instanceName>-shared-home.")
+	flag.StringVar((*string)(&defaults.Product), "default-product", string(defaults.Product),
+		"Product pre-warmed when neither a CacheBackupRequest nor its Helm release names one: confluence or jira.")
+	flag.StringVar(&defaults.SharedHomePath, "default-shared-home-path", defaults.SharedHomePath,
+		"Shared home mount path used when a CacheBackupRequest omits it.")
+	flag.StringVar(&defaults.LocalHomePath, "default-local-home-path", defaults.LocalHomePath,
+		"Local home mount path used when a CacheBackupRequest omits it. Defaults to the local home path of the product's Helm chart.")
+	flag.StringVar(&defaults.ConfigMapName, "default-configmap-name", defaults.ConfigMapName,
+		"ConfigMap with an index restore script replacing the built-in restore, used when a CacheBackupRequest omits it.")
+	flag.StringVar(&preWarmerImage, "prewarmer-image", "",
+		"Image of pre-warmer pods running the built-in restore. Defaults to the image of the operator pod, "+
+			"read from the pod named by the POD_NAME environment variable.")
+	flag.DurationVar(&defaults.Interval, "default-interval", defaults.Interval,
+		"Interval between pre-warming runs used when a CacheBackupRequest omits it.")
+	flag.StringVar(&defaultCPURequest, "default-pod-cpu-request", defaults.PodRequests.Cpu().String(),
+		"CPU request of pre-warmer pods that do not set resources.")
+	flag.StringVar(&defaultMemoryRequest, "default-pod-memory-request", defaults.PodRequests.Memory().String(),
+		"Memory request of pre-warmer pods that do not set resources.")
+	flag.StringVar(&defaults.PVCStorageRequest, "default-pvc-storage-request", defaults.PVCStorageRequest,
+		"Storage request of local home PVCs created by the operator when a CacheBackupRequest omits it.")
+	flag.BoolVar(&emergencyStop.Enabled, "emergency-stop", false,
+		"Stop pre-warming for all CacheBackupRequests, pods that are already running are not deleted.")
+	flag.StringVar(&emergencyStop.ConfigMap.Name, "emergency-stop-configmap", "dc-cache-backup-operator-emergency-stop",
+		"ConfigMap in the operator namespace that stops pre-warming for all CacheBackupRequests while it exists. "+
+			"The operator namespace is read from the POD_NAMESPACE environment variable, the ConfigMap is ignored when it is not set.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,8 +112,34 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if !defaults.Product.Known() {
+		setupLog.Error(nil, "unknown default product", "product", defaults.Product)
+		os.Exit(1)
+	}
+	for name, value := range map[corev1.ResourceName]string{corev1.ResourceCPU: defaultCPURequest, corev1.ResourceMemory: defaultMemoryRequest} {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			setupLog.Error(err, "invalid default pod "+string(name)+" request")
+			os.Exit(1)
+		}
+		defaults.PodRequests[name] = quantity
+	}
+
+	// only the emergency stop ConfigMap is cached, the operator does not read other ConfigMaps
+	emergencyStop.ConfigMap.Namespace = os.Getenv("POD_NAMESPACE")
+	if emergencyStop.ConfigMap.Namespace == "" {
+		emergencyStop.ConfigMap.Name = ""
+	}
+	cacheOptions := cache.Options{SelectorsByObject: cache.SelectorsByObject{
+		&corev1.ConfigMap{}: {Field: fields.SelectorFromSet(fields.Set{
+			"metadata.namespace": emergencyStop.ConfigMap.Namespace,
+			"metadata.name":      emergencyStop.ConfigMap.Name,
+		})},
+	}}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
+		NewCache:               cache.BuilderWithOptions(cacheOptions),
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
@@ -89,14 +162,38 @@ func main() {
 		os.Exit(1)
 	}
 
+	kubeClient := controllers.NewKubeClient()
+	if preWarmerImage == "" {
+		preWarmerImage, err = controllers.OperatorImage(context.Background(), kubeClient, os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME"))
+		if err != nil {
+			setupLog.Error(err, "unable to read the operator image, pre-warmer pods need --prewarmer-image or spec.configMapName")
+		}
+	}
+
 	if err = (&controllers.CacheBackupRequestReconciler{
-		Client:    mgr.GetClient(),
-		Scheme:    mgr.GetScheme(),
-		K8sClient: controllers.NewKubeClient(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		K8sClient:      kubeClient,
+		Defaults:       defaults,
+		EmergencyStop:  emergencyStop,
+		PreWarmerImage: preWarmerImage,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CacheBackupRequest")
 		os.Exit(1)
 	}
+	if err = (&controllers.ClusterCacheBackupPolicyReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCacheBackupPolicy")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&cachev1.CacheBackupRequest{}).SetupWebhookWithManager(mgr, defaults); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CacheBackupRequest")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -114,3 +211,143 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// snapshotFlags binds the flags locating the index snapshots, they default to the environment of pre-warmer pods
+func snapshotFlags(flags *flag.FlagSet, opts *prewarmpkg.Options) {
+	flags.StringVar((*string)(&opts.Product), "product", os.Getenv("PRODUCT"), "Product whose index is restored, confluence or jira. Defaults to $PRODUCT or else confluence.")
+	flags.StringVar(&opts.SharedHome, "shared-home", os.Getenv("SHARED_HOME"), "Shared home path, defaults to $SHARED_HOME.")
+	flags.StringVar(&opts.SnapshotsPath, "index-snapshots", os.Getenv("INDEX_SNAPSHOTS_PATH"),
+		"Index snapshot directory, defaults to $INDEX_SNAPSHOTS_PATH or else the product's directory in shared home.")
+	for _, f := range []struct {
+		name, env string
+		pattern   *string
+	}{
+		{"main-index-snapshot", "MAIN_INDEX_SNAPSHOT", &opts.Layout.MainIndex},
+		{"change-index-snapshot", "CHANGE_INDEX_SNAPSHOT", &opts.Layout.ChangeIndex},
+		{"edge-index-snapshot", "EDGE_INDEX_SNAPSHOT", &opts.Layout.EdgeIndex},
+		{"main-index-journal-id", "MAIN_INDEX_JOURNAL_ID", &opts.Layout.MainIndexJournalID},
+		{"change-index-journal-id", "CHANGE_INDEX_JOURNAL_ID", &opts.Layout.ChangeIndexJournalID},
+		{"edge-index-journal-id", "EDGE_INDEX_JOURNAL_ID", &opts.Layout.EdgeIndexJournalID},
+	} {
+		flags.StringVar(f.pattern, f.name, os.Getenv(f.env),
+			"Glob pattern of the snapshot file in the snapshot directory, defaults to $"+f.env+" or else the product's file name.")
+	}
+}
+
+// prewarm restores the local home index from shared home, it is the entrypoint of pre-warmer pods
+func prewarm(args []string) int {
+	var opts prewarmpkg.Options
+	var terminationLog, publicKey string
+	flags := flag.NewFlagSet("prewarm", flag.ExitOnError)
+	snapshotFlags(flags, &opts)
+	flags.StringVar(&opts.LocalHome, "local-home", os.Getenv("LOCAL_HOME"), "Local home path, defaults to $LOCAL_HOME.")
+	requireManifest, _ := strconv.ParseBool(os.Getenv("REQUIRE_MANIFEST"))
+	flags.BoolVar(&opts.RequireManifest, "require-manifest", requireManifest,
+		"Fail when the snapshot has no manifest, defaults to $REQUIRE_MANIFEST. Snapshots with a manifest are always verified.")
+	verifyIndex, _ := strconv.ParseBool(os.Getenv("VERIFY_INDEX"))
+	flags.BoolVar(&opts.VerifyIndex, "verify-index", verifyIndex,
+		"Check the restored Lucene indexes and put the previous index back if the check fails, defaults to $VERIFY_INDEX.")
+	keepPreviousIndexes, _ := strconv.Atoi(os.Getenv("KEEP_PREVIOUS_INDEXES"))
+	flags.IntVar(&opts.KeepPreviousIndexes, "keep-previous-indexes", keepPreviousIndexes,
+		"Generations of replaced indexes kept in the local home for rollbacks, defaults to $KEEP_PREVIOUS_INDEXES.")
+	rollbackTo, _ := strconv.Atoi(os.Getenv("ROLLBACK_TO"))
+	flags.IntVar(&opts.RollbackTo, "rollback-to", rollbackTo,
+		"Put back the kept index of this generation instead of restoring from shared home, defaults to $ROLLBACK_TO. 1 is the index replaced by the last restore.")
+	flags.StringVar(&publicKey, "public-key", os.Getenv("PUBLIC_KEY_FILE"),
+		"PEM ed25519 public key the snapshot manifest must be signed with, defaults to $PUBLIC_KEY_FILE. Empty to restore unsigned snapshots.")
+	flags.StringVar(&terminationLog, "termination-log", "/dev/termination-log",
+		"File the JSON restore result is written to, read by the operator from the container termination message. Empty to disable.")
+	zapOpts := zap.Options{}
+	zapOpts.BindFlags(flags)
+	_ = flags.Parse(args)
+
+	log := zap.New(zap.UseFlagOptions(&zapOpts)).WithName("prewarm")
+	if opts.SharedHome == "" || opts.LocalHome == "" {
+		log.Error(nil, "shared and local home paths are required")
+		return 2
+	}
+	if opts.Product != "" && !opts.Product.Known() {
+		log.Error(nil, "unknown product", "product", opts.Product)
+		return 2
+	}
+	if publicKey != "" {
+		key, err := prewarmpkg.ReadPublicKey(publicKey)
+		if err != nil {
+			log.Error(err, "unable to read the verification key")
+			return 2
+		}
+		opts.PublicKey = key
+	}
+	restore := prewarmpkg.Restore
+	if opts.RollbackTo > 0 {
+		restore = prewarmpkg.Rollback
+	}
+	result, err := restore(opts)
+	exitCode := 0
+	if err != nil {
+		log.Error(err, "unable to restore the index")
+		result = &cachev1.RestoreResult{Outcome: cachev1.RestoreOutcomeFailed, Reason: err.Error()}
+		var signatureErr *prewarmpkg.SignatureError
+		if errors.As(err, &signatureErr) {
+			result.SnapshotID = signatureErr.SnapshotID
+			result.Signature = &cachev1.SignatureResult{KeyFingerprint: signatureErr.KeyFingerprint}
+		}
+		var indexErr *prewarmpkg.IndexError
+		if errors.As(err, &indexErr) {
+			result.SnapshotID = indexErr.SnapshotID
+			result.IndexVerification = &cachev1.IndexVerificationResult{RolledBack: indexErr.RolledBack}
+		}
+		exitCode = 1
+	} else {
+		log.Info(result.Reason, "outcome", result.Outcome, "snapshotId", result.SnapshotID,
+			"filesRestored", result.FilesRestored, "bytesRestored", result.BytesRestored)
+	}
+	if terminationLog != "" {
+		if err := prewarmpkg.WriteResult(terminationLog, result); err != nil {
+			log.Error(err, "unable to write the restore result", "path", terminationLog)
+		}
+	}
+	return exitCode
+}
+
+// manifest writes the manifest of the latest index snapshot in shared home, for restores to verify it
+func manifest(args []string) int {
+	var opts prewarmpkg.Options
+	var manifestOpts prewarmpkg.ManifestOptions
+	var signingKey string
+	flags := flag.NewFlagSet("manifest", flag.ExitOnError)
+	snapshotFlags(flags, &opts)
+	flags.StringVar(&manifestOpts.ProductVersion, "product-version", "", "Version of the product that wrote the snapshot, recorded in the manifest.")
+	flags.StringVar(&signingKey, "signing-key", os.Getenv("SIGNING_KEY_FILE"),
+		"PEM ed25519 private key signing the manifest, defaults to $SIGNING_KEY_FILE. Empty to leave the manifest unsigned.")
+	flags.StringVar(&manifestOpts.Signer, "signer", "", "Name of the signer, recorded in the signed manifest.")
+	zapOpts := zap.Options{}
+	zapOpts.BindFlags(flags)
+	_ = flags.Parse(args)
+
+	log := zap.New(zap.UseFlagOptions(&zapOpts)).WithName("manifest")
+	if opts.SharedHome == "" && opts.SnapshotsPath == "" {
+		log.Error(nil, "the shared home or the index snapshot path is required")
+		return 2
+	}
+	if opts.Product != "" && !opts.Product.Known() {
+		log.Error(nil, "unknown product", "product", opts.Product)
+		return 2
+	}
+	if signingKey != "" {
+		key, err := prewarmpkg.ReadPrivateKey(signingKey)
+		if err != nil {
+			log.Error(err, "unable to read the signing key")
+			return 2
+		}
+		manifestOpts.SigningKey = key
+	}
+	m, path, err := prewarmpkg.GenerateManifest(opts, manifestOpts)
+	if err != nil {
+		log.Error(err, "unable to write the snapshot manifest")
+		return 1
+	}
+	log.Info("Snapshot manifest written", "path", path, "snapshotId", m.SnapshotID, "indexes", len(m.Indexes),
+		"signed", manifestOpts.SigningKey != nil)
+	return 0
+}